@@ -0,0 +1,38 @@
+// Package buildinfo tells which build of gopress is running.
+// The values are set when building, like
+//
+//	go build -ldflags "-X github.com/nebisin/gopress/buildinfo.Version=v1.2.0
+//	    -X github.com/nebisin/gopress/buildinfo.Commit=$(git rev-parse HEAD)
+//	    -X github.com/nebisin/gopress/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"runtime"
+)
+
+var (
+	// Version is the released version or dev.
+	Version = "dev"
+	// Commit is the git commit the binary is built from.
+	Commit = "unknown"
+	// Date is when the binary is built.
+	Date = "unknown"
+)
+
+// Info is the build of the running program.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get returns the build of the running program.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+	}
+}
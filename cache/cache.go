@@ -0,0 +1,57 @@
+// Package cache stores values by key for a while, in the memory of the
+// process or in a server speaking the Redis protocol which is shared by
+// every instance of the application.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Backends of the cache.
+const (
+	None   = "none"
+	Memory = "memory"
+	Redis  = "redis"
+)
+
+// Cache stores values by key. Values expire after their ttl, or never
+// if it is zero, and may be dropped earlier when the cache is full.
+type Cache interface {
+	// Get returns the value of key and if it is found.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value of key for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete drops the keys. Missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Config is the settings of a cache.
+type Config struct {
+	// Backend is none, memory or redis.
+	Backend string
+	// Size is how many values the memory cache holds.
+	Size int
+
+	// Addr is the host and port of the Redis server.
+	Addr string
+	// Password authenticates to the Redis server if it is set.
+	Password string
+	// DB is the number of the Redis database.
+	DB int
+}
+
+// New returns the cache of the config. It returns nil for none.
+func New(config Config) (Cache, error) {
+	switch config.Backend {
+	case None:
+		return nil, nil
+	case Memory:
+		return NewMemory(config.Size), nil
+	case Redis:
+		return NewRedis(config.Addr, config.Password, config.DB), nil
+	}
+
+	return nil, fmt.Errorf("%q is not none, memory or redis", config.Backend)
+}
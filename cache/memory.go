@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"github.com/nebisin/gopress/utils/lru"
+	"sync"
+	"time"
+)
+
+// MemoryCache is a cache in the memory of the process. Expired values
+// are dropped when they are read, and the least recently used ones
+// when the cache is full.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries *lru.LRU
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// NewMemory returns a cache holding up to size values.
+func NewMemory(size int) *MemoryCache {
+	return &MemoryCache{entries: lru.New(size, nil)}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	entry := value.(*memoryEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.entries.Remove(key)
+		return nil, false, nil
+	}
+
+	return entry.value, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.entries.Add(key, entry)
+
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		c.entries.Remove(key)
+	}
+
+	return nil
+}
@@ -0,0 +1,286 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxIdleConns is how many connections to the server are kept open.
+const maxIdleConns = 10
+
+// timeout limits the commands whose context has no deadline.
+const timeout = 5 * time.Second
+
+// RedisError is an error sent by the server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+var errProtocol = errors.New("redis: unexpected reply")
+
+// RedisCache keeps the values in a server speaking the Redis protocol,
+// like Redis, Valkey or KeyDB. Connections are opened when needed and
+// reused by the next commands.
+type RedisCache struct {
+	addr     string
+	password string
+	db       int
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// NewRedis returns a cache on the server at addr.
+func NewRedis(addr string, password string, db int) *RedisCache {
+	return &RedisCache{addr: addr, password: password, db: db}
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, errProtocol
+	}
+	return value, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+
+	_, err := c.do(ctx, args...)
+	return err
+}
+
+func (c *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	_, err := c.do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Ping checks that the server answers.
+func (c *RedisCache) Ping(ctx context.Context) error {
+	reply, err := c.do(ctx, "PING")
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return errProtocol
+	}
+	return nil
+}
+
+// Close closes the idle connections.
+func (c *RedisCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, conn := range c.idle {
+		conn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+// do sends a command and reads its reply. Replies are strings for
+// status replies, []byte or nil for bulk strings, int64 for integers
+// and []interface{} for arrays. Error replies are returned as a
+// RedisError.
+func (c *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, reused, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(ctx, args...)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection is in an unknown state.
+		conn.Close()
+		// Idle connections may be closed by the server, the
+		// commands of the cache can be sent again safely.
+		if reused && ctx.Err() == nil {
+			return c.do(ctx, args...)
+		}
+		return nil, err
+	}
+	c.release(conn)
+
+	return reply, err
+}
+
+// conn returns an idle connection or opens a new one.
+// It reports if the connection is an idle one.
+func (c *RedisCache) conn(ctx context.Context) (*redisConn, bool, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, true, nil
+	}
+	c.mu.Unlock()
+
+	var dialer net.Dialer
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	netConn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("redis: %w", err)
+	}
+	conn := &redisConn{Conn: netConn, r: bufio.NewReader(netConn), w: bufio.NewWriter(netConn)}
+
+	if c.password != "" {
+		if _, err := conn.do(ctx, "AUTH", c.password); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := conn.do(ctx, "SELECT", strconv.Itoa(c.db)); err != nil {
+			conn.Close()
+			return nil, false, err
+		}
+	}
+
+	return conn, false, nil
+}
+
+// release keeps the connection for the next commands.
+func (c *RedisCache) release(conn *redisConn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle) >= maxIdleConns {
+		conn.Close()
+		return
+	}
+	c.idle = append(c.idle, conn)
+}
+
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (conn *redisConn) do(ctx context.Context, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// Commands are sent as arrays of bulk strings.
+	fmt.Fprintf(conn.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(conn.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := conn.w.Flush(); err != nil {
+		return nil, fmt.Errorf("redis: %w", err)
+	}
+
+	return readReply(conn.r)
+}
+
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errProtocol
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errProtocol
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errProtocol
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("redis: %w", err)
+		}
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errProtocol
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			item, err := readReply(r)
+			if err != nil {
+				// Errors of the items are kept in the array.
+				var redisErr RedisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				item = redisErr
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+
+	return nil, errProtocol
+}
+
+// readLine reads a line of the protocol without its CRLF.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("redis: %w", err)
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errProtocol
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,341 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		input string
+		want  interface{}
+	}{
+		{"+OK\r\n", "OK"},
+		{":42\r\n", int64(42)},
+		{":-1\r\n", int64(-1)},
+		{"$5\r\nhello\r\n", []byte("hello")},
+		{"$0\r\n\r\n", []byte{}},
+		{"$7\r\nline\r\n2\r\n", []byte("line\r\n2")},
+		{"$-1\r\n", nil},
+		{"*-1\r\n", nil},
+		{"*0\r\n", []interface{}{}},
+		{"*3\r\n$1\r\na\r\n:2\r\n$-1\r\n", []interface{}{[]byte("a"), int64(2), nil}},
+		{"*2\r\n*1\r\n+x\r\n-ERR inner\r\n", []interface{}{[]interface{}{"x"}, RedisError("ERR inner")}},
+	}
+
+	for _, test := range tests {
+		got, err := readReply(bufio.NewReader(strings.NewReader(test.input)))
+		if err != nil {
+			t.Errorf("reply %q: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("reply %q = %#v, want %#v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestReadReplyErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  error
+	}{
+		{"-ERR unknown command\r\n", RedisError("ERR unknown command")},
+		{"?what\r\n", errProtocol},
+		{"\r\n", errProtocol},
+		{"+OK\n", errProtocol},
+		{":x\r\n", errProtocol},
+		{"$x\r\n", errProtocol},
+		{"*x\r\n", errProtocol},
+		{"*2\r\n?\r\n:1\r\n", errProtocol},
+	}
+
+	for _, test := range tests {
+		_, err := readReply(bufio.NewReader(strings.NewReader(test.input)))
+		if err != test.want {
+			t.Errorf("reply %q: error %v, want %v", test.input, err, test.want)
+		}
+	}
+
+	// A reply cut short is an error of the connection.
+	for _, input := range []string{"+OK", "$5\r\nhel", "*2\r\n:1\r\n"} {
+		_, err := readReply(bufio.NewReader(strings.NewReader(input)))
+		if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("reply %q: error %v, want an EOF", input, err)
+		}
+	}
+}
+
+// fakeRedis is a server speaking enough of the Redis protocol for the
+// cache. It records the commands it gets with the connection they are
+// sent on.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string]string
+	commands []string
+	conns    []net.Conn
+	// hangUp closes connections getting a command
+	// other than AUTH and SELECT without answering.
+	hangUp bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRedis{listener: listener, password: password, values: make(map[string]string)}
+	go f.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		f.closeConns()
+	})
+	return f
+}
+
+func (f *fakeRedis) addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.conns = append(f.conns, conn)
+		n := len(f.conns)
+		f.mu.Unlock()
+
+		go f.handle(conn, n)
+	}
+}
+
+// closeConns closes every connection like a server
+// dropping idle clients does.
+func (f *fakeRedis) closeConns() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func (f *fakeRedis) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.commands...)
+}
+
+func (f *fakeRedis) handle(conn net.Conn, n int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	authenticated := f.password == ""
+	for {
+		reply, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, arg := range reply.([]interface{}) {
+			args = append(args, string(arg.([]byte)))
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strconv.Itoa(n)+" "+strings.Join(args, " "))
+		hangUp := f.hangUp
+		f.mu.Unlock()
+
+		var answer string
+		switch {
+		case args[0] == "AUTH":
+			if args[1] != f.password {
+				answer = "-WRONGPASS invalid password\r\n"
+				break
+			}
+			authenticated = true
+			answer = "+OK\r\n"
+		case !authenticated:
+			answer = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			answer = "+OK\r\n"
+		case hangUp:
+			return
+		default:
+			answer = f.run(args)
+		}
+		if _, err := io.WriteString(conn, answer); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) run(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch args[0] {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	case "SET":
+		f.values[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.values[key]; ok {
+				delete(f.values, key)
+				deleted++
+			}
+		}
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	}
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestRedis(t *testing.T) {
+	f := newFakeRedis(t, "")
+	c := NewRedis(f.addr(), "", 0)
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok, err := c.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("Get of a missing key = %v, %v", ok, err)
+	}
+
+	value := "binary\r\n\x00value"
+	if err := c.Set(ctx, "a", []byte(value), 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "b", []byte("forever"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok, err := c.Get(ctx, "a")
+	if err != nil || !ok || string(got) != value {
+		t.Fatalf("Get = %q, %v, %v, want %q", got, ok, err, value)
+	}
+
+	if err := c.Delete(ctx, "a", "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b is found after it is deleted")
+	}
+
+	want := []string{
+		"1 PING",
+		"1 GET a",
+		"1 SET a " + value + " PX 1500",
+		"1 SET b forever",
+		"1 GET a",
+		"1 DEL a b c",
+		"1 GET b",
+	}
+	if got := f.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+
+	if _, err := c.do(ctx, "NOPE"); err != RedisError("ERR unknown command 'NOPE'") {
+		t.Errorf("error = %v, want the error of the server", err)
+	}
+	// An error reply leaves the connection usable.
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.recorded(); got[len(got)-1] != "1 PING" {
+		t.Errorf("the last command is %q, want it on the first connection", got[len(got)-1])
+	}
+}
+
+func TestRedisAuthAndSelect(t *testing.T) {
+	f := newFakeRedis(t, "secret")
+	ctx := context.Background()
+
+	c := NewRedis(f.addr(), "secret", 3)
+	defer c.Close()
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1 AUTH secret", "1 SELECT 3", "1 PING"}
+	if got := f.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+
+	wrong := NewRedis(f.addr(), "wrong", 3)
+	defer wrong.Close()
+	var redisErr RedisError
+	if err := wrong.Ping(ctx); !errors.As(err, &redisErr) || !strings.HasPrefix(string(redisErr), "WRONGPASS") {
+		t.Errorf("error = %v, want WRONGPASS", err)
+	}
+
+	none := NewRedis(f.addr(), "", 0)
+	defer none.Close()
+	if err := none.Ping(ctx); !errors.As(err, &redisErr) || !strings.HasPrefix(string(redisErr), "NOAUTH") {
+		t.Errorf("error = %v, want NOAUTH", err)
+	}
+}
+
+func TestRedisRetriesReusedConnections(t *testing.T) {
+	f := newFakeRedis(t, "")
+	c := NewRedis(f.addr(), "", 0)
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// The idle connection is closed by the server,
+	// the command is sent again on a new one.
+	f.closeConns()
+	got, ok, err := c.Get(ctx, "a")
+	if err != nil || !ok || string(got) != "1" {
+		t.Fatalf("Get = %q, %v, %v", got, ok, err)
+	}
+	want := []string{"1 SET a 1", "2 GET a"}
+	if got := f.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+
+	// A new connection failing is not tried again.
+	f.closeConns()
+	f.mu.Lock()
+	f.hangUp = true
+	f.mu.Unlock()
+	if _, _, err := c.Get(ctx, "a"); err == nil {
+		t.Fatal("Get succeeded on a closed connection")
+	}
+	want = append(want, "3 GET a")
+	if got := f.recorded(); !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %q, want %q", got, want)
+	}
+}
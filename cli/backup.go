@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/nebisin/gopress/migrations"
+	"github.com/nebisin/gopress/repository"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func runReindex(c *command, args []string) error {
+	cfg, rest, err := c.setup(c.flags(), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := repository.NewPostRepository(db).Reindex(); err != nil {
+		return err
+	}
+
+	fmt.Println("The search index is rebuilt")
+	return nil
+}
+
+// runBackup writes the backup into a temporary file first
+// so a failing backup does not replace an older one.
+func runBackup(c *command, args []string) error {
+	cfg, rest, err := c.setup(c.flags(), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	path := rest[0]
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := repository.Backup(db, file, migrator.Latest()); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+
+	fmt.Printf("The database is backed up to %s\n", path)
+	return nil
+}
+
+func runRestore(c *command, args []string) error {
+	cfg, rest, err := c.setup(c.flags(), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+
+	file, err := os.Open(rest[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	if err := repository.Restore(db, file, migrator.Latest()); err != nil {
+		return err
+	}
+
+	// The search index has to be built for the restored posts.
+	if err := repository.NewPostRepository(db).Reindex(); err != nil {
+		return err
+	}
+
+	fmt.Printf("The database is restored from %s\n", rest[0])
+	return nil
+}
@@ -0,0 +1,205 @@
+// Package cli is the command line interface of gopress. Every command
+// reads the same configuration as the server and works through the
+// same repositories.
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nebisin/gopress/cache"
+	"github.com/nebisin/gopress/config"
+	"github.com/nebisin/gopress/database"
+	"github.com/nebisin/gopress/migrations"
+	"github.com/nebisin/gopress/repository"
+	"github.com/nebisin/gopress/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io"
+	"os"
+	"strings"
+)
+
+// errUsage is returned by commands which are called wrong.
+// Their usage is printed instead of the error.
+var errUsage = errors.New("usage")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *command, args []string) error
+	// tokens is true for the commands which issue tokens
+	// and need the auth settings.
+	tokens bool
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"serve", "", "start the server, the default command", runServe, true},
+		{"migrate", "up|down [n]|to <version>|status", "change the database schema", runMigrate, false},
+		{"user create", "--username <name> --email <email> [--password <password>] [--admin]", "create a user", runUserCreate, false},
+		{"user promote", "[--revoke] <username or email>", "grant or revoke admin rights", runUserPromote, false},
+		{"user lock", "[--unlock] <username or email>", "lock or unlock an account", runUserLock, false},
+		{"user reset-password", "[--password <password>] <username or email>", "set a new password", runUserResetPassword, false},
+		{"post import", "[--author <username>] <file>", "import posts from a JSON file", runPostImport, false},
+		{"post export", "[--output <file>]", "export all posts as JSON", runPostExport, false},
+		{"seed", "[--posts <n>]", "create a demo user with posts", runSeed, false},
+		{"reindex", "", "rebuild the search index", runReindex, false},
+		{"backup", "<file>", "write the whole database into a file", runBackup, false},
+		{"restore", "<file>", "read a backup into an empty database", runRestore, false},
+		{"config check", "[--connect]", "validate and print the configuration", runConfigCheck, false},
+	}
+}
+
+// Run runs the command in args and returns the exit code.
+// The server is started if there is no command.
+func Run(args []string) int {
+	c, rest := find(args)
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "gopress: unknown command %q\n\n", strings.Join(args, " "))
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	err := c.run(c, rest)
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintf(os.Stderr, "usage: gopress %s %s\n", c.name, c.args)
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "gopress: %v\n", err)
+		return 1
+	}
+}
+
+// find returns the command named by the first words of args
+// and the arguments after its name.
+func find(args []string) (*command, []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return commands[0], args
+	}
+	if args[0] == "help" {
+		return &command{name: "help", run: func(*command, []string) error {
+			printUsage(os.Stdout)
+			return nil
+		}}, nil
+	}
+
+	for _, c := range commands {
+		words := strings.Fields(c.name)
+		if len(args) < len(words) {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == c.name {
+			return c, args[len(words):]
+		}
+	}
+
+	return nil, nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gopress <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-20s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command takes the flags of the configuration, see gopress <command> -h.")
+}
+
+// setup parses the flags of a command together with the flags of
+// the configuration and returns the validated configuration and the
+// arguments which are not flags. Flags can come after the arguments.
+func (c *command) setup(fs *flag.FlagSet, args []string) (config.Config, []string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gopress %s %s\n\n%s\n\nflags:\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	loader := config.NewLoader(fs)
+
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return config.Config{}, nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	cfg, err := loader.Load()
+	if err == nil {
+		err = cfg.Validate(c.tokens)
+	}
+
+	return cfg, rest, err
+}
+
+func (c *command) flags() *flag.FlagSet {
+	return flag.NewFlagSet(c.name, flag.ContinueOnError)
+}
+
+// openDatabase connects to the database of the config and makes
+// sure its schema is up to date.
+func openDatabase(cfg config.Config) (*gorm.DB, error) {
+	db, err := database.Open(cfg.Database.Options())
+	if err != nil {
+		return nil, err
+	}
+	db.Logger = logger.Default.LogMode(logger.Silent)
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return nil, err
+	}
+	version, err := migrator.Version()
+	if err != nil {
+		return nil, err
+	}
+	if version != migrator.Latest() {
+		return nil, fmt.Errorf("the database schema is at version %d but %d is needed, run gopress migrate up", version, migrator.Latest())
+	}
+
+	if err := search.Register(db); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// randomPassword is used when no password is given.
+func randomPassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// openReadCache returns the cache of the repositories when it is shared
+// with the server, so changes made by the commands invalidate it. The
+// memory cache of the server can not be reached and is left to expire.
+func openReadCache(cfg config.Config) *repository.ReadCache {
+	if cfg.Cache.Backend != cache.Redis {
+		return nil
+	}
+
+	store, err := cache.New(cfg.Cache.Options())
+	if err != nil {
+		return nil
+	}
+	return repository.NewReadCache(store, cfg.Cache.TTL)
+}
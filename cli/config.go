@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nebisin/gopress/config"
+	"github.com/nebisin/gopress/database"
+	"github.com/nebisin/gopress/migrations"
+	"os"
+	"text/tabwriter"
+)
+
+// runConfigCheck prints the configuration with the secrets hidden,
+// and every problem when it is not valid.
+func runConfigCheck(c *command, args []string) error {
+	fs := c.flags()
+	connect := fs.Bool("connect", false, "also connect to the database")
+
+	cfg, rest, err := c.setup(fs, args)
+	var problems config.Problems
+	if errors.As(err, &problems) {
+		fmt.Println(problems.Error())
+		return errors.New("the configuration has problems")
+	}
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tENV\tVALUE")
+	for _, setting := range config.Settings(&cfg) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", setting.Key, setting.Env, setting)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if *connect {
+		db, err := database.Open(cfg.Database.Options())
+		if err != nil {
+			return fmt.Errorf("connecting to the database: %w", err)
+		}
+		migrator, err := migrations.New(db)
+		if err != nil {
+			return err
+		}
+		version, err := migrator.Version()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("\nThe database is reachable, its schema is at version %d of %d\n", version, migrator.Latest())
+	}
+
+	fmt.Println("\nThe configuration is valid")
+	if cfg.Auth.Secret == "" {
+		fmt.Println("auth.secret is not set, the server needs it to start")
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"github.com/nebisin/gopress/database"
+	"github.com/nebisin/gopress/migrations"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// runMigrate applies or rolls back the migrations. It is used like
+//
+//	migrate up          applies all migrations
+//	migrate down [n]    rolls back the last n migrations, one by default
+//	migrate to <v>      applies or rolls back until v is the newest one
+//	migrate status      lists the migrations
+func runMigrate(c *command, args []string) error {
+	cfg, args, err := c.setup(c.flags(), args)
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Open(cfg.Database.Options())
+	if err != nil {
+		return err
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+
+	subcommand := "up"
+	if len(args) > 0 {
+		subcommand = args[0]
+	}
+
+	var count int
+	switch subcommand {
+	case "up":
+		count, err = migrator.Up()
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				return fmt.Errorf("the number of migrations to roll back must be a positive number")
+			}
+		}
+		count, err = migrator.Down(n)
+	case "to":
+		if len(args) < 2 {
+			return errUsage
+		}
+		version, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			return fmt.Errorf("%s is not a valid version", args[1])
+		}
+		count, err = migrator.To(uint(version))
+	case "status":
+		return printMigrations(migrator)
+	default:
+		return errUsage
+	}
+
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Ran %d migrations, the schema is at version %d\n", count, version)
+	return nil
+}
+
+func printMigrations(migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"io"
+	"os"
+	"time"
+)
+
+// exportedPost is a post in the files of post import and export.
+// Authors are referred to by their usernames so the files can be
+// moved between sites.
+type exportedPost struct {
+	Title       string     `json:"title"`
+	Body        string     `json:"body"`
+	Excerpt     string     `json:"excerpt,omitempty"`
+	Author      string     `json:"author"`
+	Tags        []string   `json:"tags"`
+	IsPublished bool       `json:"isPublished"`
+	PublishedAt *time.Time `json:"publishedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+func runPostExport(c *command, args []string) error {
+	fs := c.flags()
+	output := fs.String("output", "-", "file to write, - is the standard output")
+
+	cfg, rest, err := c.setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	// Posts are written one by one to not keep them all in memory.
+	count := 0
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	err = repository.NewPostRepository(db).Each(func(post models.Post) error {
+		exported := exportedPost{
+			Title:       post.Title,
+			Body:        post.Body,
+			Tags:        make([]string, len(post.Tags)),
+			IsPublished: post.IsPublished,
+			PublishedAt: post.PublishedAt,
+			CreatedAt:   post.CreatedAt,
+			UpdatedAt:   post.UpdatedAt,
+		}
+		if post.CustomExcerpt {
+			exported.Excerpt = post.Excerpt
+		}
+		if post.Author != nil {
+			exported.Author = post.Author.Username
+		}
+		for i, tag := range post.Tags {
+			exported.Tags[i] = tag.Name
+		}
+
+		content, err := json.MarshalIndent(exported, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		separator := "\n  "
+		if count > 0 {
+			separator = ",\n  "
+		}
+		if _, err := io.WriteString(w, separator+string(content)); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "\n]\n"); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %d posts\n", count)
+	return nil
+}
+
+func runPostImport(c *command, args []string) error {
+	fs := c.flags()
+	author := fs.String("author", "", "username of the author of posts without one")
+
+	cfg, rest, err := c.setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if rest[0] != "-" {
+		file, err := os.Open(rest[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var posts []exportedPost
+	if err := json.NewDecoder(r).Decode(&posts); err != nil {
+		return fmt.Errorf("reading %s: %w", rest[0], err)
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+
+	authors := make(map[string]uint)
+	repo := repository.NewPostRepository(db)
+	for i, exported := range posts {
+		username := exported.Author
+		if username == "" {
+			username = *author
+		}
+		if username == "" {
+			return fmt.Errorf("post %d has no author, use --author", i+1)
+		}
+
+		authorID, ok := authors[username]
+		if !ok {
+			user, err := findUser(db, username)
+			if err != nil {
+				return fmt.Errorf("post %d: %w", i+1, err)
+			}
+			authorID = user.ID
+			authors[username] = authorID
+		}
+
+		post := models.Post{
+			Title:         exported.Title,
+			Body:          exported.Body,
+			Excerpt:       exported.Excerpt,
+			CustomExcerpt: exported.Excerpt != "",
+			AuthorID:      &authorID,
+			Tags:          models.NamesToTags(exported.Tags),
+			IsPublished:   exported.IsPublished,
+			PublishedAt:   exported.PublishedAt,
+		}
+		post.CreatedAt = exported.CreatedAt
+		post.UpdatedAt = exported.UpdatedAt
+
+		if err := repo.Save(&post); err != nil {
+			return fmt.Errorf("post %d %q: %w", i+1, exported.Title, err)
+		}
+	}
+
+	fmt.Printf("Imported %d posts\n", len(posts))
+	return nil
+}
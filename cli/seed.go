@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+var seedWords = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit
+	sed do eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad minim
+	veniam quis nostrud exercitation ullamco laboris nisi aliquip ex ea commodo
+	consequat duis aute irure in reprehenderit voluptate velit esse cillum fugiat
+	nulla pariatur excepteur sint occaecat cupidatat non proident sunt culpa qui
+	officia deserunt mollit anim id est laborum`)
+
+var seedTags = []string{"go", "web", "databases", "design", "notes", "travel"}
+
+// runSeed creates the demo user and posts for trying out the API.
+// Running it again adds more posts to the same user.
+func runSeed(c *command, args []string) error {
+	fs := c.flags()
+	count := fs.Int("posts", 20, "how many posts to create")
+
+	cfg, rest, err := c.setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 || *count < 0 {
+		return errUsage
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+
+	var password string
+	user, err := repository.NewUserRepository(db).FindByEmailOrUsername("", "demo")
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if password, err = randomPassword(); err != nil {
+			return err
+		}
+		user = models.User{
+			Email:       "demo@example.com",
+			Username:    "demo",
+			Password:    password,
+			DisplayName: "Demo User",
+		}
+		if err := repository.NewUserRepository(db).Save(&user); err != nil {
+			return err
+		}
+	}
+
+	repo := repository.NewPostRepository(db)
+	start := time.Now().Add(-time.Duration(*count) * 24 * time.Hour)
+	for i := 0; i < *count; i++ {
+		created := start.Add(time.Duration(i) * 24 * time.Hour)
+		post := models.Post{
+			Title:       seedText(i, 3+i%5),
+			Body:        seedParagraphs(i),
+			AuthorID:    &user.ID,
+			Tags:        models.NamesToTags([]string{seedTags[i%len(seedTags)], seedTags[(i*7+3)%len(seedTags)]}),
+			IsPublished: i%4 != 3,
+		}
+		post.CreatedAt = created
+		post.UpdatedAt = created
+		if post.IsPublished {
+			post.PublishedAt = &created
+		}
+
+		if err := repo.Save(&post); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Created %d posts for the user demo\n", *count)
+	if password != "" {
+		fmt.Printf("The user demo is created with the password %s\n", password)
+	}
+	return nil
+}
+
+// seedText makes a sentence of n words starting
+// at a different word for every i.
+func seedText(i int, n int) string {
+	words := make([]string, n)
+	for j := range words {
+		words[j] = seedWords[(i*11+j*3)%len(seedWords)]
+	}
+	text := strings.Join(words, " ")
+
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+func seedParagraphs(i int) string {
+	paragraphs := make([]string, 2+i%3)
+	for j := range paragraphs {
+		sentences := make([]string, 4+j%3)
+		for k := range sentences {
+			sentences[k] = seedText(i+j*5+k, 6+(i+k)%9) + "."
+		}
+		paragraphs[j] = strings.Join(sentences, " ")
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
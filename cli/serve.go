@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"github.com/nebisin/gopress/controllers"
+)
+
+func runServe(c *command, args []string) error {
+	cfg, rest, err := c.setup(c.flags(), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return errUsage
+	}
+
+	handler := controllers.Handler{}
+	handler.Initialize(cfg)
+
+	return handler.Run()
+}
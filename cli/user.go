@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"gorm.io/gorm"
+)
+
+func runUserCreate(c *command, args []string) error {
+	fs := c.flags()
+	username := fs.String("username", "", "username of the user")
+	email := fs.String("email", "", "email of the user")
+	password := fs.String("password", "", "password of the user, a random one is printed if it is empty")
+	displayName := fs.String("display-name", "", "display name of the user")
+	admin := fs.Bool("admin", false, "grant admin rights")
+
+	cfg, rest, err := c.setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 || *username == "" || *email == "" {
+		return errUsage
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+
+	generated := *password == ""
+	if generated {
+		if *password, err = randomPassword(); err != nil {
+			return err
+		}
+	}
+
+	user := models.User{
+		Email:       *email,
+		Username:    *username,
+		Password:    *password,
+		DisplayName: *displayName,
+	}
+	users := repository.NewUserRepository(db)
+	if err := users.Save(&user); err != nil {
+		return err
+	}
+	if *admin {
+		if err := users.SetAdmin(user.ID, true); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Created the user %s with the id %d\n", user.Username, user.ID)
+	if generated {
+		fmt.Printf("Password: %s\n", *password)
+	}
+	return nil
+}
+
+func runUserPromote(c *command, args []string) error {
+	fs := c.flags()
+	revoke := fs.Bool("revoke", false, "revoke the admin rights instead")
+
+	return updateUser(c, fs, args, func(users repository.UserRepository, user models.User) (string, error) {
+		if err := users.SetAdmin(user.ID, !*revoke); err != nil {
+			return "", err
+		}
+		if *revoke {
+			return "is not an admin anymore", nil
+		}
+		return "is an admin now", nil
+	})
+}
+
+func runUserLock(c *command, args []string) error {
+	fs := c.flags()
+	unlock := fs.Bool("unlock", false, "unlock the account instead")
+
+	return updateUser(c, fs, args, func(users repository.UserRepository, user models.User) (string, error) {
+		if err := users.SetLocked(user.ID, !*unlock); err != nil {
+			return "", err
+		}
+		if *unlock {
+			return "is unlocked", nil
+		}
+		return "is locked", nil
+	})
+}
+
+func runUserResetPassword(c *command, args []string) error {
+	fs := c.flags()
+	password := fs.String("password", "", "the new password, a random one is printed if it is empty")
+
+	return updateUser(c, fs, args, func(users repository.UserRepository, user models.User) (string, error) {
+		generated := *password == ""
+		if generated {
+			var err error
+			if *password, err = randomPassword(); err != nil {
+				return "", err
+			}
+		}
+
+		if err := users.SetPassword(user.ID, *password); err != nil {
+			return "", err
+		}
+		if generated {
+			return "has the new password " + *password, nil
+		}
+		return "has a new password", nil
+	})
+}
+
+// updateUser changes the user named in the only argument
+// and prints what is changed.
+func updateUser(c *command, fs *flag.FlagSet, args []string,
+	change func(users repository.UserRepository, user models.User) (string, error)) error {
+	cfg, rest, err := c.setup(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errUsage
+	}
+
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+
+	user, err := findUser(db, rest[0])
+	if err != nil {
+		return err
+	}
+
+	// Users cached by a shared cache are dropped from it,
+	// so the server sees the change right away.
+	users := repository.NewCachedUserRepository(db, openReadCache(cfg))
+	result, err := change(users, user)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("The user %s %s\n", user.Username, result)
+	return nil
+}
+
+func findUser(db *gorm.DB, login string) (models.User, error) {
+	user, err := repository.NewUserRepository(db).FindByEmailOrUsername(login, login)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, fmt.Errorf("there is no user %s", login)
+	}
+	return user, err
+}
@@ -0,0 +1,350 @@
+// Package config loads the settings of the application. Values come
+// from the defaults, a YAML file, environment variables and command
+// line flags, each one overriding the ones before it.
+package config
+
+import (
+	"github.com/nebisin/gopress/cache"
+	"github.com/nebisin/gopress/database"
+	"github.com/nebisin/gopress/middlewares"
+	"github.com/nebisin/gopress/tracing"
+	"time"
+)
+
+// Config is every setting of the application. The yaml tags are the
+// keys of the config file and the env tags the environment variables.
+// Every setting with an env tag also has a flag named after it, like
+// --db-dsn for DB_DSN.
+type Config struct {
+	Server   Server   `yaml:"server"`
+	Auth     Auth     `yaml:"auth"`
+	Database Database `yaml:"database"`
+	Posts    Posts    `yaml:"posts"`
+	Feeds    Feeds    `yaml:"feeds"`
+	Sitemaps Sitemaps `yaml:"sitemaps"`
+	Storage  Storage  `yaml:"storage"`
+	Media    Media    `yaml:"media"`
+	Tracing  Tracing  `yaml:"tracing"`
+	Logging  Logging  `yaml:"logging"`
+	Cache    Cache    `yaml:"cache"`
+	CORS     CORS     `yaml:"cors"`
+	Security Security `yaml:"security"`
+}
+
+type Server struct {
+	// Addr is the address the server listens to.
+	Addr string `yaml:"addr" env:"ADDR"`
+	// PublicURL is the url clients reach the site at, like
+	// https://blog.example.com. Links in feeds, sitemaps
+	// and media are made with it.
+	PublicURL string `yaml:"public_url" env:"PUBLIC_URL"`
+	// MetricsAddr is the address the metrics are served at, apart
+	// from the site so they are not public. Empty turns it off.
+	MetricsAddr string `yaml:"metrics_addr" env:"METRICS_ADDR"`
+
+	// ReadHeaderTimeout is how long reading the headers of a request can take.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"SERVER_READ_HEADER_TIMEOUT"`
+	// ReadTimeout is how long reading a whole request can take,
+	// which also limits the time of uploads.
+	ReadTimeout time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	// WriteTimeout is how long writing a response can take.
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	// IdleTimeout is how long a keep-alive connection is kept open.
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// RequestTimeout is how long handling a request can take before
+	// its context is cancelled, which stops its database queries.
+	// Uploads are only limited by ReadTimeout.
+	RequestTimeout time.Duration `yaml:"request_timeout" env:"SERVER_REQUEST_TIMEOUT"`
+	// MaxBodySize is the largest request body in bytes.
+	// Uploads are limited by the media settings instead.
+	MaxBodySize int64 `yaml:"max_body_size" env:"SERVER_MAX_BODY_SIZE"`
+	// Compression compresses texts and JSON responses with
+	// brotli or gzip when the client accepts them.
+	Compression bool `yaml:"compression" env:"SERVER_COMPRESSION"`
+	// CompressionMinSize is the smallest response in bytes
+	// which is compressed.
+	CompressionMinSize int `yaml:"compression_min_size" env:"SERVER_COMPRESSION_MIN_SIZE"`
+	// ShutdownTimeout is how long to wait for requests and
+	// background jobs to finish when the server is stopped.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+
+	// TLSCertFile and TLSKeyFile turn on HTTPS. The files are
+	// read again when they change, so certificates can be renewed
+	// without restarting the server.
+	TLSCertFile string `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile  string `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+}
+
+type Auth struct {
+	// Secret signs the tokens.
+	Secret string `yaml:"secret" env:"API_SECRET" secret:"true"`
+	// TokenTTL is how long a token is valid.
+	TokenTTL time.Duration `yaml:"token_ttl" env:"TOKEN_TTL"`
+}
+
+type Database struct {
+	Driver          string        `yaml:"driver" env:"DB_DRIVER"`
+	DSN             string        `yaml:"dsn" env:"DB_DSN" secret:"true"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	// Migrate applies pending migrations when the server starts.
+	Migrate bool `yaml:"migrate" env:"DB_MIGRATE"`
+}
+
+// Options are the settings for opening the database.
+func (d Database) Options() database.Config {
+	return database.Config{
+		Driver:          d.Driver,
+		DSN:             d.DSN,
+		MaxOpenConns:    d.MaxOpenConns,
+		MaxIdleConns:    d.MaxIdleConns,
+		ConnMaxLifetime: d.ConnMaxLifetime,
+		ConnMaxIdleTime: d.ConnMaxIdleTime,
+	}
+}
+
+type Posts struct {
+	// RequireIfMatch makes the If-Match header mandatory
+	// for changing and deleting posts.
+	RequireIfMatch bool `yaml:"require_if_match" env:"REQUIRE_IF_MATCH"`
+	// TrashRetention is how long deleted posts stay in the trash.
+	// Zero keeps them forever.
+	TrashRetention time.Duration `yaml:"trash_retention" env:"TRASH_RETENTION"`
+	// CacheMaxAge is how long clients and proxies can
+	// keep published posts without asking again.
+	CacheMaxAge time.Duration `yaml:"cache_max_age" env:"POSTS_CACHE_MAX_AGE"`
+	// CacheSize is how many responses of published posts are kept
+	// in memory for anonymous users. Zero turns the cache off.
+	CacheSize int `yaml:"cache_size" env:"POSTS_CACHE_SIZE"`
+	// CacheTTL is how long a response stays in the cache. Changes
+	// of the posts drop them earlier.
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"POSTS_CACHE_TTL"`
+}
+
+type Feeds struct {
+	// SiteTitle is the name of the blog used in the feeds.
+	SiteTitle string `yaml:"site_title" env:"SITE_TITLE"`
+	// Items is how many posts the feeds have.
+	Items int `yaml:"items" env:"FEED_ITEMS"`
+	// FullContent puts whole posts into the feeds
+	// instead of their excerpts.
+	FullContent bool `yaml:"full_content" env:"FEED_FULL_CONTENT"`
+}
+
+type Sitemaps struct {
+	// RobotsTxt is the path of a robots.txt to serve
+	// instead of the default one.
+	RobotsTxt string `yaml:"robots_txt" env:"ROBOTS_TXT"`
+}
+
+type Storage struct {
+	// Backend is local or s3.
+	Backend string `yaml:"backend" env:"STORAGE_BACKEND"`
+	// Path is the directory of the local storage.
+	Path string `yaml:"path" env:"STORAGE_PATH"`
+	S3   S3     `yaml:"s3"`
+}
+
+type S3 struct {
+	Endpoint  string `yaml:"endpoint" env:"S3_ENDPOINT"`
+	Region    string `yaml:"region" env:"S3_REGION"`
+	Bucket    string `yaml:"bucket" env:"S3_BUCKET"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY" secret:"true"`
+	PathStyle bool   `yaml:"path_style" env:"S3_PATH_STYLE"`
+}
+
+type Media struct {
+	// MaxSize is the largest file in bytes which can be uploaded.
+	MaxSize int64 `yaml:"max_size" env:"MEDIA_MAX_SIZE"`
+	// Quota is how many bytes of media a user can have.
+	// Zero means there is no limit.
+	Quota int64 `yaml:"quota" env:"MEDIA_QUOTA"`
+	// Types are the types of files which can be uploaded.
+	Types []string `yaml:"types" env:"MEDIA_TYPES"`
+	// ImageVariants are the sizes uploaded images are resized to
+	// like thumbnail:150x150,small:480.
+	ImageVariants string `yaml:"image_variants" env:"IMAGE_VARIANTS"`
+}
+
+type Tracing struct {
+	// Exporter is none, otlp or stdout.
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	// Endpoint is the host and port of an OTLP/HTTP collector.
+	Endpoint string `yaml:"endpoint" env:"OTLP_ENDPOINT"`
+	// Insecure sends the spans to the collector over plain HTTP.
+	Insecure bool `yaml:"insecure" env:"OTLP_INSECURE"`
+	// SampleRatio is the share of new traces which are recorded.
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Options are the settings for setting up tracing.
+func (t Tracing) Options() tracing.Config {
+	return tracing.Config{
+		Exporter:    t.Exporter,
+		Endpoint:    t.Endpoint,
+		Insecure:    t.Insecure,
+		SampleRatio: t.SampleRatio,
+	}
+}
+
+type Logging struct {
+	// Level is the least important level logged:
+	// debug, info, warn or error.
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// SlowQuery is how long a query can take
+	// before it is logged as slow. Zero turns it off.
+	SlowQuery time.Duration `yaml:"slow_query" env:"LOG_SLOW_QUERY"`
+}
+
+type Cache struct {
+	// Backend is none, memory or redis.
+	Backend string `yaml:"backend" env:"CACHE_BACKEND"`
+	// Size is how many posts and users the memory cache holds.
+	Size int `yaml:"size" env:"CACHE_SIZE"`
+	// TTL is how long posts and users are cached. Changes made
+	// without going through the cache show up after it.
+	TTL time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+	// RedisAddr is the host and port of the Redis server.
+	RedisAddr     string `yaml:"redis_addr" env:"REDIS_ADDR"`
+	RedisPassword string `yaml:"redis_password" env:"REDIS_PASSWORD" secret:"true"`
+	RedisDB       int    `yaml:"redis_db" env:"REDIS_DB"`
+}
+
+// Options are the settings for setting up the cache.
+func (c Cache) Options() cache.Config {
+	return cache.Config{
+		Backend:  c.Backend,
+		Size:     c.Size,
+		Addr:     c.RedisAddr,
+		Password: c.RedisPassword,
+		DB:       c.RedisDB,
+	}
+}
+
+type CORS struct {
+	// AllowedOrigins are the origins which can call the API from
+	// a browser, like https://example.com. * allows every origin
+	// and empty turns CORS off.
+	AllowedOrigins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	// AllowedMethods and AllowedHeaders are what cross-origin
+	// requests can use.
+	AllowedMethods []string `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS"`
+	AllowedHeaders []string `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS"`
+	// ExposedHeaders are the response headers scripts can read.
+	ExposedHeaders []string `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS"`
+	// AllowCredentials lets browsers send cookies and
+	// the Authorization header.
+	AllowCredentials bool `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	// MaxAge is how long browsers cache a preflight response.
+	MaxAge time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+// Options are the settings of the CORS middleware.
+func (c CORS) Options() middlewares.CORSConfig {
+	return middlewares.CORSConfig{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   c.ExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+type Security struct {
+	// HSTSMaxAge is how long browsers only use HTTPS for the site.
+	// It is only sent over HTTPS and zero turns it off.
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age" env:"HSTS_MAX_AGE"`
+	// HSTSIncludeSubdomains applies HSTS to the subdomains too.
+	HSTSIncludeSubdomains bool `yaml:"hsts_include_subdomains" env:"HSTS_INCLUDE_SUBDOMAINS"`
+	// ContentSecurityPolicy and ReferrerPolicy are the values
+	// of their headers. Empty leaves them out.
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"CONTENT_SECURITY_POLICY"`
+	ReferrerPolicy        string `yaml:"referrer_policy" env:"REFERRER_POLICY"`
+}
+
+// Options are the settings of the security headers middleware.
+func (s Security) Options() middlewares.SecurityConfig {
+	return middlewares.SecurityConfig{
+		HSTSMaxAge:            s.HSTSMaxAge,
+		HSTSIncludeSubdomains: s.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: s.ContentSecurityPolicy,
+		ReferrerPolicy:        s.ReferrerPolicy,
+	}
+}
+
+// Default returns the settings used when nothing else is given.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:               ":8080",
+			PublicURL:          "http://localhost:8080",
+			MetricsAddr:        "localhost:9090",
+			ReadHeaderTimeout:  5 * time.Second,
+			ReadTimeout:        time.Minute,
+			WriteTimeout:       time.Minute,
+			IdleTimeout:        2 * time.Minute,
+			RequestTimeout:     30 * time.Second,
+			MaxBodySize:        1 << 20,
+			Compression:        true,
+			CompressionMinSize: 1024,
+			ShutdownTimeout:    30 * time.Second,
+		},
+		Auth: Auth{TokenTTL: 8 * 24 * time.Hour},
+		Database: Database{
+			Driver:  database.SQLite,
+			Migrate: true,
+		},
+		Posts: Posts{
+			TrashRetention: 30 * 24 * time.Hour,
+			CacheMaxAge:    time.Minute,
+			CacheSize:      1000,
+			CacheTTL:       5 * time.Minute,
+		},
+		Feeds: Feeds{
+			SiteTitle:   "gopress",
+			Items:       20,
+			FullContent: true,
+		},
+		Storage: Storage{
+			Backend: "local",
+			Path:    "uploads",
+		},
+		Media: Media{
+			MaxSize:       10 << 20,
+			Quota:         100 << 20,
+			Types:         []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+			ImageVariants: "thumbnail:150x150,small:480,medium:1024,large:2048",
+		},
+		Tracing: Tracing{
+			Exporter:    tracing.None,
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			SampleRatio: 1,
+		},
+		Logging: Logging{
+			Level:     "info",
+			SlowQuery: 200 * time.Millisecond,
+		},
+		Cache: Cache{
+			Backend:   cache.Memory,
+			Size:      10000,
+			TTL:       5 * time.Minute,
+			RedisAddr: "localhost:6379",
+		},
+		CORS: CORS{
+			AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "X-Request-ID"},
+			ExposedHeaders: []string{"ETag", "Link", "X-Request-ID"},
+			MaxAge:         10 * time.Minute,
+		},
+		Security: Security{
+			HSTSMaxAge:            180 * 24 * time.Hour,
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			ReferrerPolicy:        "strict-origin-when-cross-origin",
+		},
+	}
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setting is a field of the config with an env tag.
+type Setting struct {
+	Key   string
+	Env   string
+	Flag  string
+	Value reflect.Value
+	// Secret settings are hidden when the config is printed.
+	Secret bool
+}
+
+// Loader reads the config for a command with its own flags.
+type Loader struct {
+	config   Config
+	settings []Setting
+	path     *string
+	flags    []given
+}
+
+// given is a setting given as a flag.
+type given struct {
+	setting Setting
+	value   string
+}
+
+// NewLoader adds --config and a flag for every setting to fs.
+// Load must be called after fs is parsed.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{config: Default()}
+	l.settings = Settings(&l.config)
+	l.path = fs.String("config", "", "path of the YAML config file, same as CONFIG_FILE")
+
+	// Flags are only recorded while parsing and applied
+	// at the end since they override the other sources.
+	for _, s := range l.settings {
+		s := s
+		fs.Func(s.Flag, "sets "+s.Key+", same as "+s.Env, func(value string) error {
+			l.flags = append(l.flags, given{s, value})
+			return nil
+		})
+	}
+
+	return l
+}
+
+// Load reads the config from the defaults, the file given with
+// --config or CONFIG_FILE, the environment and the flags. A .env
+// file in the working directory is read into the environment first
+// if there is one.
+func (l *Loader) Load() (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return l.config, fmt.Errorf("reading .env: %w", err)
+	}
+
+	path := *l.path
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return l.config, fmt.Errorf("reading the config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(content, &l.config); err != nil {
+			return l.config, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+
+	var problems Problems
+	for _, s := range l.settings {
+		// Empty values are only used for texts, others keep
+		// their defaults like when the variable is not set.
+		value, ok := os.LookupEnv(s.Env)
+		if ok && (value != "" || s.Value.Kind() == reflect.String) {
+			if err := set(s.Value, value); err != nil {
+				problems = append(problems, Problem{s.Env, err.Error()})
+			}
+		}
+	}
+	for _, f := range l.flags {
+		if err := set(f.setting.Value, f.value); err != nil {
+			problems = append(problems, Problem{"--" + f.setting.Flag, err.Error()})
+		}
+	}
+	if len(problems) > 0 {
+		return l.config, problems
+	}
+
+	return l.config, nil
+}
+
+// Settings lists the fields of the config which can be set
+// with environment variables and flags.
+func Settings(config *Config) []Setting {
+	var settings []Setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			key := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), key+".")
+				continue
+			}
+
+			env := field.Tag.Get("env")
+			if env == "" {
+				continue
+			}
+			settings = append(settings, Setting{
+				Key:    key,
+				Env:    env,
+				Flag:   strings.ReplaceAll(strings.ToLower(env), "_", "-"),
+				Value:  v.Field(i),
+				Secret: field.Tag.Get("secret") == "true",
+			})
+		}
+	}
+	walk(reflect.ValueOf(config).Elem(), "")
+
+	return settings
+}
+
+// set parses the text into the field.
+func set(v reflect.Value, text string) error {
+	switch v.Interface().(type) {
+	case string:
+		v.SetString(text)
+	case bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", text)
+		}
+		v.SetBool(b)
+	case int, int64:
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", text)
+		}
+		v.SetInt(n)
+	case float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", text)
+		}
+		v.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration like 30m or 12h", text)
+		}
+		v.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("settings of type %s are not supported", v.Type())
+	}
+
+	return nil
+}
+
+// String returns the value of the setting as text.
+func (s Setting) String() string {
+	if s.Secret && !s.Value.IsZero() {
+		return "********"
+	}
+
+	switch value := s.Value.Interface().(type) {
+	case []string:
+		return strings.Join(value, ",")
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment of a test. Every variable of the
+// settings is unset first so the environment of the shell running
+// the tests does not leak in.
+func setenv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	var config Config
+	names := []string{"CONFIG_FILE"}
+	for _, s := range Settings(&config) {
+		names = append(names, s.Env)
+	}
+
+	for _, name := range names {
+		value, ok := os.LookupEnv(name)
+		os.Unsetenv(name)
+		if ok {
+			t.Cleanup(func() { os.Setenv(name, value) })
+		}
+	}
+	for name, value := range env {
+		os.Setenv(name, value)
+		name := name
+		t.Cleanup(func() { os.Unsetenv(name) })
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "gopress.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func load(t *testing.T, args ...string) (Config, error) {
+	t.Helper()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	loader := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return loader.Load()
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setenv(t, nil)
+
+	config, err := load(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, Default()) {
+		t.Errorf("config = %+v, want the defaults", config)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  addr: ":1001"
+  public_url: https://file.example
+  metrics_addr: localhost:1002
+  shutdown_timeout: 1m
+feeds:
+  items: 5
+`)
+	setenv(t, map[string]string{
+		"CONFIG_FILE":      path,
+		"PUBLIC_URL":       "https://env.example",
+		"METRICS_ADDR":     "localhost:2002",
+		"SHUTDOWN_TIMEOUT": "2m",
+	})
+
+	config, err := load(t, "--metrics-addr", "localhost:3002", "--shutdown-timeout=3m", "--cors-allowed-origins", "https://a.example, https://b.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		setting   string
+		got, want interface{}
+	}{
+		{"default", config.Server.ReadTimeout, Default().Server.ReadTimeout},
+		{"file", config.Server.Addr, ":1001"},
+		{"file", config.Feeds.Items, 5},
+		{"env", config.Server.PublicURL, "https://env.example"},
+		{"flag", config.Server.MetricsAddr, "localhost:3002"},
+		{"flag", config.Server.ShutdownTimeout, 3 * time.Minute},
+		{"flag", config.CORS.AllowedOrigins, []string{"https://a.example", "https://b.example"}},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.got, test.want) {
+			t.Errorf("setting from the %s = %v, want %v", test.setting, test.got, test.want)
+		}
+	}
+}
+
+func TestLoadConfigFlag(t *testing.T) {
+	path := writeFile(t, "server:\n  addr: \":1001\"\n")
+	setenv(t, map[string]string{"CONFIG_FILE": writeFile(t, "server:\n  addr: \":2001\"\n")})
+
+	config, err := load(t, "--config", path)
+	if err != nil || config.Server.Addr != ":1001" {
+		t.Errorf("addr = %q, %v, want the one of the --config file", config.Server.Addr, err)
+	}
+}
+
+// Empty variables clear texts, other settings keep their defaults.
+func TestLoadEmptyEnv(t *testing.T) {
+	setenv(t, map[string]string{"METRICS_ADDR": "", "SHUTDOWN_TIMEOUT": "", "SERVER_COMPRESSION": ""})
+
+	config, err := load(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Server.MetricsAddr != "" {
+		t.Errorf("metrics addr = %q, want it cleared", config.Server.MetricsAddr)
+	}
+	if config.Server.ShutdownTimeout != Default().Server.ShutdownTimeout || !config.Server.Compression {
+		t.Errorf("server = %+v, want the defaults", config.Server)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	setenv(t, map[string]string{"SHUTDOWN_TIMEOUT": "soon", "SERVER_COMPRESSION": "maybe"})
+
+	_, err := load(t, "--feed-items", "many")
+	var problems Problems
+	if !errors.As(err, &problems) {
+		t.Fatalf("error = %v, want the problems", err)
+	}
+	want := []string{"SERVER_COMPRESSION", "SHUTDOWN_TIMEOUT", "--feed-items"}
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.Setting)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems = %v, want %v", got, want)
+	}
+
+	setenv(t, map[string]string{"CONFIG_FILE": writeFile(t, "server:\n  adr: \":1001\"\n")})
+	if _, err := load(t); err == nil {
+		t.Error("a file with an unknown key is loaded")
+	}
+
+	setenv(t, map[string]string{"CONFIG_FILE": filepath.Join(t.TempDir(), "missing.yaml")})
+	if _, err := load(t); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("error of a missing file = %v", err)
+	}
+}
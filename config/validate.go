@@ -0,0 +1,161 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/nebisin/gopress/cache"
+	"github.com/nebisin/gopress/database"
+	"github.com/nebisin/gopress/images"
+	"github.com/nebisin/gopress/logging"
+	"github.com/nebisin/gopress/tracing"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Problem is a setting which is not valid.
+type Problem struct {
+	Setting string
+	Message string
+}
+
+// Problems is returned when the config is not valid.
+// Its message lists every problem on its own line.
+type Problems []Problem
+
+func (p Problems) Error() string {
+	var b strings.Builder
+	b.WriteString("the configuration is not valid:")
+	for _, problem := range p {
+		fmt.Fprintf(&b, "\n  %s: %s", problem.Setting, problem.Message)
+	}
+	return b.String()
+}
+
+// Validate checks every setting and reports all problems at once.
+// The auth settings are only checked with tokens, for the commands
+// which issue tokens, so the others run without a secret.
+func (c Config) Validate(tokens bool) error {
+	var problems Problems
+	check := func(ok bool, setting, message string) {
+		if !ok {
+			problems = append(problems, Problem{setting, message})
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr", "must be set")
+	u, err := url.Parse(c.Server.PublicURL)
+	valid := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.RawQuery == "" && u.Fragment == "" && u.User == nil
+	check(valid, "server.public_url", fmt.Sprintf("%q is not a url like https://blog.example.com", c.Server.PublicURL))
+	check(c.Server.MetricsAddr == "" || c.Server.MetricsAddr != c.Server.Addr, "server.metrics_addr",
+		"must be different from server.addr")
+	check(c.Server.ReadHeaderTimeout >= 0, "server.read_header_timeout", "can not be negative")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout", "can not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout", "can not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout", "can not be negative")
+	check(c.Server.RequestTimeout >= 0, "server.request_timeout", "can not be negative")
+	check(c.Server.MaxBodySize > 0, "server.max_body_size", "must be a positive number of bytes")
+	check(c.Server.CompressionMinSize >= 0, "server.compression_min_size", "can not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout", "must be positive")
+	switch {
+	case c.Server.TLSCertFile == "" && c.Server.TLSKeyFile == "":
+	case c.Server.TLSCertFile == "" || c.Server.TLSKeyFile == "":
+		check(false, "server.tls_cert_file", "must be set together with server.tls_key_file")
+	default:
+		_, err := tls.LoadX509KeyPair(c.Server.TLSCertFile, c.Server.TLSKeyFile)
+		check(err == nil, "server.tls_cert_file", fmt.Sprintf("can not be loaded: %v", err))
+	}
+
+	if tokens {
+		check(c.Auth.Secret != "", "auth.secret", "must be set, for example with API_SECRET")
+		check(c.Auth.TokenTTL > 0, "auth.token_ttl", "must be positive")
+	}
+
+	switch c.Database.Driver {
+	case database.SQLite:
+	case database.Postgres, database.MySQL:
+		check(c.Database.DSN != "", "database.dsn", "must be set for "+c.Database.Driver)
+	default:
+		check(false, "database.driver", fmt.Sprintf("%q is not sqlite, postgres or mysql", c.Database.Driver))
+	}
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns", "can not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns", "can not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime", "can not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time", "can not be negative")
+
+	check(c.Posts.TrashRetention >= 0, "posts.trash_retention", "can not be negative")
+	check(c.Posts.CacheMaxAge >= 0, "posts.cache_max_age", "can not be negative")
+	check(c.Posts.CacheSize >= 0, "posts.cache_size", "can not be negative")
+	check(c.Posts.CacheTTL > 0, "posts.cache_ttl", "must be positive")
+
+	check(c.Feeds.Items > 0, "feeds.items", "must be positive")
+
+	if c.Sitemaps.RobotsTxt != "" {
+		_, err := os.Stat(c.Sitemaps.RobotsTxt)
+		check(err == nil, "sitemaps.robots_txt", fmt.Sprintf("%s can not be read", c.Sitemaps.RobotsTxt))
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+		check(c.Storage.Path != "", "storage.path", "must be set for the local storage")
+	case "s3":
+		check(c.Storage.S3.Endpoint != "", "storage.s3.endpoint", "must be set for the s3 storage")
+		check(c.Storage.S3.Bucket != "", "storage.s3.bucket", "must be set for the s3 storage")
+	default:
+		check(false, "storage.backend", fmt.Sprintf("%q is not local or s3", c.Storage.Backend))
+	}
+
+	check(c.Media.MaxSize > 0, "media.max_size", "must be a positive number of bytes")
+	check(c.Media.Quota >= 0, "media.quota", "can not be negative")
+	check(len(c.Media.Types) > 0, "media.types", "must have at least one type")
+	if _, err := images.ParseVariants(c.Media.ImageVariants); err != nil {
+		check(false, "media.image_variants", err.Error())
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.None, tracing.Stdout:
+	case tracing.OTLP:
+		check(c.Tracing.Endpoint != "", "tracing.endpoint", "must be set for the otlp exporter")
+	default:
+		check(false, "tracing.exporter", fmt.Sprintf("%q is not none, otlp or stdout", c.Tracing.Exporter))
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1")
+
+	if _, err := logging.ParseLevel(c.Logging.Level); err != nil {
+		check(false, "logging.level", err.Error())
+	}
+	check(c.Logging.SlowQuery >= 0, "logging.slow_query", "can not be negative")
+
+	switch c.Cache.Backend {
+	case cache.None:
+	case cache.Memory:
+		check(c.Cache.Size > 0, "cache.size", "must be positive for the memory cache")
+	case cache.Redis:
+		check(c.Cache.RedisAddr != "", "cache.redis_addr", "must be set for the redis cache")
+		check(c.Cache.RedisDB >= 0, "cache.redis_db", "can not be negative")
+	default:
+		check(false, "cache.backend", fmt.Sprintf("%q is not none, memory or redis", c.Cache.Backend))
+	}
+	check(c.Cache.TTL > 0, "cache.ttl", "must be positive")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			check(!c.CORS.AllowCredentials, "cors.allowed_origins", "can not be * when cors.allow_credentials is true")
+			continue
+		}
+		u, err := url.Parse(origin)
+		valid := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+			u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil
+		check(valid, "cors.allowed_origins", fmt.Sprintf("%q is not an origin like https://example.com", origin))
+	}
+	check(len(c.CORS.AllowedOrigins) == 0 || len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods", "must have at least one method")
+	check(c.CORS.MaxAge >= 0, "cors.max_age", "can not be negative")
+
+	check(c.Security.HSTSMaxAge >= 0, "security.hsts_max_age", "can not be negative")
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
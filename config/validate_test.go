@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	config := Default()
+	if err := config.Validate(false); err != nil {
+		t.Errorf("the defaults are not valid without tokens: %v", err)
+	}
+
+	// Only the commands issuing tokens need the secret.
+	var problems Problems
+	if err := config.Validate(true); !errors.As(err, &problems) ||
+		!reflect.DeepEqual(problems, Problems{{"auth.secret", "must be set, for example with API_SECRET"}}) {
+		t.Errorf("error without a secret = %v", err)
+	}
+
+	config.Auth.Secret = "secret"
+	if err := config.Validate(true); err != nil {
+		t.Errorf("the defaults with a secret are not valid: %v", err)
+	}
+}
+
+func TestValidateProblems(t *testing.T) {
+	config := Default()
+	config.Server.PublicURL = "blog.example"
+	config.Server.MetricsAddr = config.Server.Addr
+	config.Server.ReadTimeout = -1
+	config.Auth.TokenTTL = 0
+	config.Database.Driver = "oracle"
+	config.Storage.Backend = "s3"
+	config.Media.ImageVariants = "small"
+	config.Logging.Level = "loud"
+	config.CORS.AllowedOrigins = []string{"*", "https://a.example/path"}
+	config.CORS.AllowCredentials = true
+
+	var problems Problems
+	if err := config.Validate(true); !errors.As(err, &problems) {
+		t.Fatalf("error = %v, want the problems", err)
+	}
+
+	want := []string{
+		"server.public_url",
+		"server.metrics_addr",
+		"server.read_timeout",
+		"auth.secret",
+		"auth.token_ttl",
+		"database.driver",
+		"storage.s3.endpoint",
+		"storage.s3.bucket",
+		"media.image_variants",
+		"logging.level",
+		"cors.allowed_origins",
+		"cors.allowed_origins",
+	}
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.Setting)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems = %v, want %v", got, want)
+	}
+
+	// The message has every problem on its own line.
+	message := problems.Error()
+	if lines := strings.Count(message, "\n"); lines != len(want) {
+		t.Errorf("message has %d problem lines, want %d:\n%s", lines, len(want), message)
+	}
+}
@@ -1,47 +1,49 @@
 package controllers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"github.com/nebisin/gopress/metrics"
 	"github.com/nebisin/gopress/models"
 	"github.com/nebisin/gopress/repository"
+	"github.com/nebisin/gopress/tracing"
 	"github.com/nebisin/gopress/utils/auth"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"github.com/nebisin/gopress/utils/pagination"
 	"github.com/nebisin/gopress/utils/responses"
 	"golang.org/x/crypto/bcrypt"
-	"io/ioutil"
-	"log"
+	"gorm.io/gorm"
 	"net/http"
-	"strings"
 )
 
 func (handler *Handler) handleAuthRegister(w http.ResponseWriter, r *http.Request)  {
 	var userPayload models.UserPayload
-	if err := json.NewDecoder(r.Body).Decode(&userPayload); err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	if err := decodeJSON(r.Body, &userPayload); err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
 		return
 	}
 
 	user := models.PayloadToUser(userPayload)
 
-	db := repository.NewUserRepository(handler.DB)
+	db := handler.users(r.Context())
 
 	if err := db.Save(&user); err != nil {
-		if strings.Contains(err.Error(), "users.email") {
-			responses.ERROR(w, http.StatusBadRequest, errors.New("email is already taken"))
-			return
-		}
-		if strings.Contains(err.Error(), "users.username") {
-			responses.ERROR(w, http.StatusBadRequest, errors.New("username is already taken"))
+		if errors.Is(err, repository.ErrDuplicateEmail) || errors.Is(err, repository.ErrDuplicateUsername) {
+			responses.ERROR(w, http.StatusBadRequest, err)
 			return
 		}
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
+	metrics.Registrations.Inc()
 
-	token, err := auth.CreateToken(user.ID)
+	token, err := handler.Tokens.CreateToken(user.ID, user.TokenVersion)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
-		log.Println(err)
+		logError(r, err)
 		return
 	}
 
@@ -50,79 +52,170 @@ func (handler *Handler) handleAuthRegister(w http.ResponseWriter, r *http.Reques
 
 func (handler Handler) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
 	var userPayload models.UserPayload
-	if err := json.NewDecoder(r.Body).Decode(&userPayload); err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	if err := decodeJSON(r.Body, &userPayload); err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
 		return
 	}
 
-	db := repository.NewUserRepository(handler.DB)
+	db := handler.users(r.Context())
 
 	user, err := db.FindByEmailOrUsername(userPayload.Email, userPayload.Username)
 	if err != nil {
+		metrics.FailedLogins.WithLabelValues("credentials").Inc()
 		responses.ERROR(w, http.StatusNotFound, errors.New("email or password is wrong"))
 		return
 	}
 
+	_, span := tracing.Tracer().Start(r.Context(), "bcrypt.CompareHashAndPassword")
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(userPayload.Password))
+	span.End()
 	if err != nil {
+		metrics.FailedLogins.WithLabelValues("credentials").Inc()
 		responses.ERROR(w, http.StatusNotFound, errors.New("email or password is wrong"))
 		return
 	}
 
-	token, err := auth.CreateToken(user.ID)
+	if user.IsLocked {
+		metrics.FailedLogins.WithLabelValues("locked").Inc()
+		responses.ERROR(w, http.StatusForbidden, errors.New("the account is locked"))
+		return
+	}
+
+	token, err := handler.Tokens.CreateToken(user.ID, user.TokenVersion)
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
+	metrics.Logins.Inc()
 
 	responses.JSON(w, http.StatusCreated, token)
 }
 
-// handleMyPosts method gets users own posts
+// checkToken method revokes the tokens of locked and deleted users,
+// and the tokens given before the password of the user is reset.
+func (handler *Handler) checkToken(ctx context.Context, uid uint, version uint) error {
+	user, err := repository.NewUserRepository(handler.DB.WithContext(ctx)).FindForToken(uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return auth.ErrRevoked
+		}
+		return err
+	}
+
+	if user.IsLocked || user.TokenVersion != version {
+		return auth.ErrRevoked
+	}
+
+	return nil
+}
+
+// handleMyPosts method gets one page of users own posts
 // including both published and unpublished ones.
 func (handler Handler) handleMyPosts(w http.ResponseWriter, r *http.Request) {
-	uid, err := auth.ExtractTokenID(r)
+	uid, err := handler.Tokens.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
 		return
 	}
 
-	db := repository.NewPostRepository(handler.DB)
-	posts, err := db.FindMyPosts(uid)
+	query, err := postQueryFromRequest(r)
 	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	db := handler.posts(r.Context())
+	posts, meta, err := db.FindMyPosts(uid, query, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) || errors.Is(err, fieldset.ErrUnknownField) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
 		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
 
-	responses.JSON(w, http.StatusOK, posts)
+	handler.writePostPage(w, r, posts, meta, query.Fields)
 }
 
 // handleMe method return the authenticated user info.
 func (handler Handler) handleMe(w http.ResponseWriter, r *http.Request) {
-	uid, err := auth.ExtractTokenID(r)
+	uid, err := handler.Tokens.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
 		return
 	}
 
-	db := repository.NewUserRepository(handler.DB)
-	user, err := db.FindById(uid)
+	fields := fieldset.FromRequest(r)
+
+	db := handler.users(r.Context())
+	user, err := db.FindByIdWithFields(uid, fields)
 	if err != nil {
+		if errors.Is(err, fieldset.ErrUnknownField) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
 		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
 
-	responses.JSON(w, http.StatusOK, user)
+	writeUser(w, r, user, fields)
 }
 
+// handleUpdateMe method replaces the profile of the authenticated user.
+// Display name is cleared if it is missing in the body
+// and the password is only changed when it is given.
 func (handler Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
-	uid, err := auth.ExtractTokenID(r)
+	uid, err := handler.Tokens.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	db := handler.users(r.Context())
+
+	user, err := db.FindById(uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, err)
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
+		return
+	}
+
+	var userUpdate models.UserDTO
+
+	if err = decodeJSON(bytes.NewReader(body), &userUpdate); err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
+		return
+	}
+
+	handler.replaceUser(w, r, &user, userUpdate)
+}
+
+// handlePatchMe method changes the profile of the authenticated user
+// with a JSON Merge Patch or a JSON Patch. Only the fields in the patch
+// are changed and display name can be cleared by setting it to null.
+func (handler Handler) handlePatchMe(w http.ResponseWriter, r *http.Request) {
+	uid, err := handler.Tokens.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
 		return
 	}
 
-	db := repository.NewUserRepository(handler.DB)
+	db := handler.users(r.Context())
 
 	user, err := db.FindById(uid)
 	if err != nil {
@@ -130,33 +223,57 @@ func (handler Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	body, err := ioutil.ReadAll(r.Body)
+	body, err := readBody(r)
 	if err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
+		return
+	}
+
+	doc, err := json.Marshal(models.UserToDTO(user))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	patched, err := applyPatch(r, doc, body)
+	if err != nil {
+		if errors.Is(err, errUnsupportedPatch) {
+			responses.ERROR(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
 	var userUpdate models.UserDTO
 
-	if err = json.Unmarshal(body, &userUpdate); err != nil {
+	if err = decodeJSON(bytes.NewReader(patched), &userUpdate); err != nil {
 		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
+	handler.replaceUser(w, r, &user, userUpdate)
+}
+
+// replaceUser method writes the new profile of the user
+// and sends it back to the client.
+func (handler Handler) replaceUser(w http.ResponseWriter, r *http.Request, user *models.User, userUpdate models.UserDTO) {
+	db := handler.users(r.Context())
+
 	newUser := models.DTOToUser(userUpdate)
 
-	if err := db.UpdateById(&user, &newUser); err != nil {
-		if strings.Contains(err.Error(), "users.email") {
-			responses.ERROR(w, http.StatusBadRequest, errors.New("email is already taken"))
+	if err := db.UpdateById(user, &newUser); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEmail) || errors.Is(err, repository.ErrDuplicateUsername) {
+			responses.ERROR(w, http.StatusBadRequest, err)
 			return
 		}
-		if strings.Contains(err.Error(), "users.username") {
-			responses.ERROR(w, http.StatusBadRequest, errors.New("username is already taken"))
-			return
-		}
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
+	// Posts have the profile of their authors.
+	handler.postsChanged(r.Context())
 
 	responses.JSON(w, http.StatusCreated, user)
-}
\ No newline at end of file
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRevokedTokens(t *testing.T) {
+	handler := newTestHandler(t, nil)
+	users := handler.users(context.Background())
+
+	tests := []struct {
+		name   string
+		revoke func(id uint) error
+	}{
+		{"lock", func(id uint) error { return users.SetLocked(id, true) }},
+		{"reset password", func(id uint) error { return users.SetPassword(id, "new password") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := strings.ReplaceAll(tt.name, " ", "")
+			token := register(t, handler, name)
+
+			w := serve(handler, "GET", "/me", token, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status before = %d, want %d", w.Code, http.StatusOK)
+			}
+			var me struct {
+				ID uint `json:"id"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&me); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.revoke(me.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, target := range []string{"/me", "/me/posts"} {
+				if w := serve(handler, "GET", target, token, nil); w.Code != http.StatusUnauthorized {
+					t.Errorf("GET %s status = %d, want %d", target, w.Code, http.StatusUnauthorized)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenOfUnlockedUser(t *testing.T) {
+	handler := newTestHandler(t, nil)
+	users := handler.users(context.Background())
+
+	register(t, handler, "author")
+	user, err := users.FindByEmailOrUsername("author@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetLocked(user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetLocked(user.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(handler, "POST", "/login", "", strings.NewReader(`{"email":"author@example.com","password":"password"}`))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("login status = %d, body = %s", w.Code, w.Body)
+	}
+	var token string
+	if err := json.NewDecoder(w.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serve(handler, "GET", "/me", token, nil); w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
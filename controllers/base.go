@@ -1,53 +1,426 @@
 package controllers
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
-	"github.com/nebisin/gopress/models"
-	"gorm.io/driver/sqlite"
+	"github.com/nebisin/gopress/cache"
+	"github.com/nebisin/gopress/config"
+	"github.com/nebisin/gopress/database"
+	"github.com/nebisin/gopress/httpcache"
+	"github.com/nebisin/gopress/images"
+	"github.com/nebisin/gopress/logging"
+	"github.com/nebisin/gopress/metrics"
+	"github.com/nebisin/gopress/migrations"
+	"github.com/nebisin/gopress/repository"
+	"github.com/nebisin/gopress/search"
+	"github.com/nebisin/gopress/sitemaps"
+	"github.com/nebisin/gopress/storage"
+	"github.com/nebisin/gopress/tracing"
+	"github.com/nebisin/gopress/utils/auth"
+	"github.com/nebisin/gopress/utils/certs"
 	"gorm.io/gorm"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type Handler struct {
 	Router *mux.Router
 	DB     *gorm.DB
+
+	// Config is the config the handler is initialized with.
+	Config config.Config
+	Tokens auth.Tokens
+
+	// RequireIfMatch makes the If-Match header mandatory
+	// for changing and deleting posts.
+	RequireIfMatch bool
+
+	// SiteTitle is the name of the blog used in the feeds.
+	SiteTitle string
+	// FeedItems is how many posts the feeds have.
+	FeedItems int
+	// FeedFullContent puts whole posts into the feeds
+	// instead of their excerpts.
+	FeedFullContent bool
+
+	Sitemaps *sitemaps.Generator
+	// postCache keeps the responses of the posts read by anonymous
+	// users. It is nil when the cache is turned off.
+	postCache *httpcache.Cache
+	// cache keeps the posts and the users read by the repositories.
+	// Both are nil when the cache is turned off.
+	cache     cache.Cache
+	readCache *repository.ReadCache
+	// RobotsTxt is the content of robots.txt.
+	// A default one is used if it is empty.
+	RobotsTxt string
+
+	// Storage keeps the uploaded media.
+	Storage storage.Storage
+	// MediaMaxSize is the largest file in bytes which can be uploaded.
+	MediaMaxSize int64
+	// MediaQuota is how many bytes of media a user can have.
+	// Zero means there is no limit.
+	MediaQuota int64
+	// MediaTypes are the types of files which can be uploaded.
+	MediaTypes map[string]bool
+	// ImageVariants are the sizes uploaded images are resized to.
+	ImageVariants []images.Variant
+	mediaQueue    chan struct{}
+
+	workers *workers
+	// flushTraces sends the spans which are not exported yet.
+	flushTraces func(ctx context.Context) error
 }
 
-func (handler *Handler) Initialize() {
-	getEnv()
+// Initialize sets up the handler with the given config,
+// which must be validated before.
+func (handler *Handler) Initialize(config config.Config) {
+	handler.Config = config
+	handler.Tokens = auth.Tokens{Secret: []byte(config.Auth.Secret), TTL: config.Auth.TokenTTL, Check: handler.checkToken}
+	handler.RequireIfMatch = config.Posts.RequireIfMatch
+	handler.initializeLogging()
+	handler.initializeTracing()
+	handler.initializeFeeds()
 	handler.initializeDatabase()
+	handler.initializeSitemaps()
+	handler.initializeCache()
+	handler.initializeStorage()
+	handler.initializeWorkers()
 	handler.initializeRoutes()
 }
 
-func getEnv() {
-	log.Println("We are getting the env values...")
+// initializeLogging makes every log of the server, including the
+// ones of the standard log package, JSON entries of the configured level.
+func (handler *Handler) initializeLogging() {
+	level, err := logging.ParseLevel(handler.Config.Logging.Level)
+	if err != nil {
+		log.Fatalf("Error setting up logging: %v", err)
+	}
+	logging.SetDefault(logging.New(os.Stderr, level))
+}
 
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Error getting env, not comming through %v", err)
+// initializeTracing sets up the exporter of the spans.
+func (handler *Handler) initializeTracing() {
+	flush, err := tracing.Setup(handler.Config.Tracing.Options())
+	if err != nil {
+		log.Fatalf("Error setting up tracing: %v", err)
 	}
+	handler.flushTraces = flush
 }
 
 func (handler *Handler) initializeDatabase() {
 	log.Println("We are initializing the database...")
 
+	handler.openDatabase()
+
+	handler.instrumentDatabase()
+
+	handler.migrateDatabase()
+
+	if err := search.Register(handler.DB); err != nil {
+		log.Fatalf("Error setting up search: %v", err)
+	}
+
+	if err := repository.NewPostRepository(handler.DB).SummarizeAll(); err != nil {
+		log.Fatalf("Error summarizing the posts: %v", err)
+	}
+}
+
+// openDatabase connects to the database of the config.
+func (handler *Handler) openDatabase() {
 	var err error
 
-	handler.DB, err = gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	handler.DB, err = database.Open(handler.Config.Database.Options())
 	if err != nil {
 		log.Fatalf("failed to connect database: %v", err)
 	} else {
 		log.Println("🌍 Database connection is successful")
 	}
+}
+
+// instrumentDatabase adds the metrics of the queries and the connection pool,
+// the spans of the queries and logs failed and slow queries.
+func (handler *Handler) instrumentDatabase() {
+	handler.DB.Logger = logging.GormLogger{SlowThreshold: handler.Config.Logging.SlowQuery}
+
+	if err := handler.DB.Use(metrics.GormPlugin{}); err != nil {
+		log.Fatalf("Error adding the database metrics: %v", err)
+	}
+	if err := handler.DB.Use(tracing.GormPlugin{}); err != nil {
+		log.Fatalf("Error adding the database tracing: %v", err)
+	}
+
+	sqlDB, err := handler.DB.DB()
+	if err != nil {
+		log.Fatalf("Error adding the database metrics: %v", err)
+	}
+	if err := metrics.RegisterPool(sqlDB); err != nil {
+		log.Fatalf("Error adding the database metrics: %v", err)
+	}
+}
+
+// migrateDatabase applies the migrations which are not applied yet.
+// When migrations on start are turned off the schema is only checked, so migrations
+// can be run separately with the migrate command before deploying.
+func (handler *Handler) migrateDatabase() {
+	migrator, err := migrations.New(handler.DB)
+	if err != nil {
+		log.Fatalf("Error loading the migrations: %v", err)
+	}
+
+	if !handler.Config.Database.Migrate {
+		version, err := migrator.Version()
+		if err != nil {
+			log.Fatalf("Error reading the schema version: %v", err)
+		}
+		if version < migrator.Latest() {
+			log.Fatalf("The database schema is at version %d but %d is needed, run the migrate command", version, migrator.Latest())
+		}
+		return
+	}
+
+	count, err := migrator.Up()
+	if err != nil {
+		log.Fatalf("Error migrating the database: %v", err)
+	}
+	if count > 0 {
+		log.Printf("Applied %d migrations", count)
+	}
+}
+
+func (handler *Handler) initializeFeeds() {
+	handler.SiteTitle = handler.Config.Feeds.SiteTitle
+	handler.FeedItems = handler.Config.Feeds.Items
+	handler.FeedFullContent = handler.Config.Feeds.FullContent
+}
+
+func (handler *Handler) initializeSitemaps() {
+	handler.Sitemaps = sitemaps.New(handler.DB, handler.baseURL())
+
+	if path := handler.Config.Sitemaps.RobotsTxt; path != "" {
+		robots, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error reading robots.txt: %v", err)
+		}
+		handler.RobotsTxt = string(robots)
+	}
+}
+
+func (handler *Handler) initializeCache() {
+	handler.postCache = httpcache.New(handler.Config.Posts.CacheSize, handler.Config.Posts.CacheTTL)
+
+	var err error
+	if handler.cache, err = cache.New(handler.Config.Cache.Options()); err != nil {
+		log.Fatalf("Error setting up the cache: %v", err)
+	}
+	handler.readCache = repository.NewReadCache(handler.cache, handler.Config.Cache.TTL)
 
-	// Migrate the schema
-	if err := handler.DB.AutoMigrate(&models.Post{}, &models.User{}); err != nil {
-		log.Fatalf("Error auto migration: %v", err)
+	// The repositories read from the database while the
+	// cache is down, so the server can start without it.
+	if pinger, ok := handler.cache.(interface{ Ping(context.Context) error }); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := pinger.Ping(ctx); err != nil {
+			logging.Default().Warn("the cache can not be reached", "error", err)
+		}
 	}
 }
 
-func (handler *Handler) Run(addr string) {
-	log.Println("🚀 Listening to port 8080")
-	log.Fatal(http.ListenAndServe(addr, handler.Router))
+// posts returns the repository of the posts for a request.
+func (handler Handler) posts(ctx context.Context) repository.PostRepository {
+	return repository.NewCachedPostRepository(handler.DB.WithContext(ctx), handler.readCache)
+}
+
+// users returns the repository of the users for a request.
+func (handler Handler) users(ctx context.Context) repository.UserRepository {
+	return repository.NewCachedUserRepository(handler.DB.WithContext(ctx), handler.readCache)
+}
+
+func (handler *Handler) initializeStorage() {
+	config := handler.Config.Storage
+
+	switch config.Backend {
+	case "local":
+		local, err := storage.NewLocal(config.Path)
+		if err != nil {
+			log.Fatalf("Error setting up the storage: %v", err)
+		}
+		handler.Storage = local
+	case "s3":
+		handler.Storage = &storage.S3{
+			Endpoint:  config.S3.Endpoint,
+			Region:    config.S3.Region,
+			Bucket:    config.S3.Bucket,
+			AccessKey: config.S3.AccessKey,
+			SecretKey: config.S3.SecretKey,
+			PathStyle: config.S3.PathStyle,
+		}
+	}
+
+	handler.MediaMaxSize = handler.Config.Media.MaxSize
+	handler.MediaQuota = handler.Config.Media.Quota
+
+	handler.MediaTypes = make(map[string]bool)
+	for _, t := range handler.Config.Media.Types {
+		handler.MediaTypes[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+
+	var err error
+	if handler.ImageVariants, err = images.ParseVariants(handler.Config.Media.ImageVariants); err != nil {
+		log.Fatalf("Image variants are not valid: %v", err)
+	}
+	handler.mediaQueue = make(chan struct{}, 1)
+}
+
+// initializeWorkers starts the jobs running in the background.
+func (handler *Handler) initializeWorkers() {
+	handler.workers = newWorkers()
+
+	if retention := handler.Config.Posts.TrashRetention; retention > 0 {
+		handler.workers.Go(func(ctx context.Context) {
+			handler.purgeTrash(ctx, retention, time.Hour)
+		})
+	}
+
+	handler.workers.Go(handler.processMedia)
+}
+
+// Run serves the requests until the program gets SIGINT or SIGTERM,
+// or until the server can not listen anymore. Then it stops taking new
+// requests, waits for the running ones and the background jobs up to
+// the shutdown timeout and closes the database. Errors of the metrics
+// server are only logged.
+func (handler *Handler) Run() error {
+	config := handler.Config.Server
+	server := &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler.serverHandler(),
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+
+	tlsEnabled := config.TLSCertFile != ""
+	if tlsEnabled {
+		reloader, err := certs.NewReloader(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		log.Printf("🚀 Listening on %s", config.Addr)
+		if tlsEnabled {
+			errs <- server.ListenAndServeTLS("", "")
+		} else {
+			errs <- server.ListenAndServe()
+		}
+	}()
+
+	var metricsServer *http.Server
+	if config.MetricsAddr != "" {
+		metricsServer = &http.Server{
+			Addr:              config.MetricsAddr,
+			Handler:           handler.metricsHandler(),
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		}
+		go func() {
+			log.Printf("Serving the metrics on %s", config.MetricsAddr)
+			// The requests are served without the metrics,
+			// so the server keeps running when they fail.
+			if err := metricsServer.ListenAndServe(); err != http.ErrServerClosed {
+				logging.Default().Error("the metrics server stopped", "error", err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	// When the server can not listen, everything else
+	// is stopped the same way before giving its error.
+	var result error
+	select {
+	case result = <-errs:
+	case sig := <-signals:
+		log.Printf("Got %s, shutting down...", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil && result == nil {
+		result = fmt.Errorf("not every request is finished: %w", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	if err := handler.Close(ctx); err != nil && result == nil {
+		result = err
+	}
+
+	if result == nil {
+		log.Println("👋 Server is stopped")
+	}
+	return result
+}
+
+// Close stops the background jobs, waiting for them until ctx is done,
+// sends the remaining spans and closes the database.
+func (handler *Handler) Close(ctx context.Context) error {
+	var result error
+	if handler.workers != nil {
+		if err := handler.workers.Stop(ctx); err != nil {
+			result = fmt.Errorf("background jobs did not stop: %w", err)
+		}
+	}
+
+	if handler.flushTraces != nil {
+		if err := handler.flushTraces(ctx); err != nil && result == nil {
+			result = fmt.Errorf("spans could not be sent: %w", err)
+		}
+	}
+
+	if closer, ok := handler.cache.(io.Closer); ok {
+		if err := closer.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	if handler.DB != nil {
+		sqlDB, err := handler.DB.DB()
+		if err != nil {
+			return err
+		}
+		if err := sqlDB.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// logError logs an error which is not shown to the client
+// with the logger of the request, so it has the request id.
+func logError(r *http.Request, err error) {
+	logging.FromContext(r.Context()).Error("request failed", "error", err)
 }
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"github.com/nebisin/gopress/config"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunListenError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	handler := newTestHandler(t, func(c *config.Config) {
+		c.Server.Addr = taken.Addr().String()
+		c.Server.MetricsAddr = ""
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- handler.Run() }()
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("Run gave no error of the taken address")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop when the server could not listen")
+	}
+
+	sqlDB, err := handler.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqlDB.Ping(); err == nil {
+		t.Error("the database is not closed")
+	}
+}
+
+func TestRunMetricsListenError(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	handler := newTestHandler(t, func(c *config.Config) {
+		c.Server.Addr = "127.0.0.1:0"
+		c.Server.MetricsAddr = taken.Addr().String()
+	})
+
+	errs := make(chan error, 1)
+	go func() { errs <- handler.Run() }()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("Run stopped with %v when the metrics server could not listen", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		t.Skip("signals can not be sent:", err)
+	}
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Run = %v after SIGTERM", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop after SIGTERM")
+	}
+}
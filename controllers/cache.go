@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/httpcache"
+	"github.com/nebisin/gopress/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tagPosts is the tag of the cached lists of posts.
+const tagPosts = "posts"
+
+// cachedHeaders are the headers of the handlers kept with the responses.
+// They must only depend on the cache key, the URI of the request, so no
+// other part of a request, like its Host, can get into the response of
+// another one. Link is made on the public URL for this reason. Others,
+// like the CORS headers, depend on the request and are set by the
+// middlewares each time.
+var cachedHeaders = []string{"Cache-Control", "Content-Type", "ETag", "Last-Modified", "Link"}
+
+func postTag(id uint) string {
+	return "post:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// postChanged method is called after a post is created, changed or
+// deleted so the data generated from the posts can be updated.
+func (handler Handler) postChanged(post models.Post) {
+	handler.Sitemaps.PostChanged(post)
+	handler.postCache.Invalidate(postTag(post.ID), tagPosts)
+}
+
+// postsChanged method is called after something embedded in the posts,
+// like their authors or featured media, is changed. Every cached
+// post and response of the posts is dropped since they may have it.
+func (handler Handler) postsChanged(ctx context.Context) {
+	handler.readCache.InvalidatePosts(ctx)
+	handler.postCache.Purge()
+}
+
+// setPostCacheHeaders sets Cache-Control and Last-Modified of a response
+// made of posts last modified at given time. Only public responses can
+// be kept by shared caches and by the cache of the handler.
+func (handler Handler) setPostCacheHeaders(w http.ResponseWriter, public bool, modified time.Time) {
+	if public {
+		maxAge := int(handler.Config.Posts.CacheMaxAge.Seconds())
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(maxAge))
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// lastModified returns the latest time one of the posts is updated.
+func lastModified(posts []models.Post) time.Time {
+	var latest time.Time
+	for _, post := range posts {
+		if post.UpdatedAt.After(latest) {
+			latest = post.UpdatedAt
+		}
+	}
+	return latest
+}
+
+// cachePublic serves the GET requests of anonymous users from the cache
+// of the handler. Responses which the handler marks as public with
+// Cache-Control are kept for the next requests. Single posts are tagged
+// with their id, so a change of a post only drops its own responses
+// and the lists.
+func (handler Handler) cachePublic(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if handler.postCache == nil || r.Header.Get("Authorization") != "" {
+			next(w, r)
+			return
+		}
+
+		key := r.URL.RequestURI()
+		if entry, ok := handler.postCache.Get(key); ok {
+			for name, values := range entry.Header {
+				w.Header()[name] = append([]string(nil), values...)
+			}
+			w.Header().Set("X-Cache", "HIT")
+			// Only single posts have an ETag, lists are not
+			// answered with 304 since a removed post does
+			// not change their Last-Modified.
+			if etag := entry.Header.Get("ETag"); etag != "" {
+				if notModified(w, r, etag) {
+					return
+				}
+				if r.Header.Get("If-None-Match") == "" && notModifiedSince(w, r, lastModifiedHeader(entry.Header)) {
+					return
+				}
+			}
+			w.WriteHeader(entry.Status)
+			_, _ = w.Write(entry.Body)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		version := handler.postCache.Version()
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		if recorder.status != http.StatusOK || !strings.HasPrefix(w.Header().Get("Cache-Control"), "public") {
+			return
+		}
+
+		header := make(http.Header)
+		for _, name := range cachedHeaders {
+			if values := w.Header().Values(name); len(values) > 0 {
+				header[http.CanonicalHeaderKey(name)] = values
+			}
+		}
+		tag := tagPosts
+		if id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64); err == nil {
+			tag = postTag(uint(id))
+		}
+		handler.postCache.Set(key, version, &httpcache.Entry{
+			Status: recorder.status,
+			Header: header,
+			Body:   recorder.body.Bytes(),
+		}, tag)
+	}
+}
+
+func lastModifiedHeader(header http.Header) time.Time {
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return time.Now()
+	}
+	return modified
+}
+
+// responseRecorder keeps a copy of the response it writes.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
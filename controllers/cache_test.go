@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"context"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCachePublicHosts(t *testing.T) {
+	handler := newTestHandler(t, nil)
+	register(t, handler, "author")
+	author, err := handler.users(context.Background()).FindByEmailOrUsername("author@example.com", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var post models.Post
+	for _, title := range []string{"first", "second", "third"} {
+		post = models.Post{Title: title, Body: "body of " + title, AuthorID: &author.ID, IsPublished: true}
+		if err := repository.NewPostRepository(handler.DB).Save(&post); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first request of every page is made with a forged host,
+	// the second one must not get anything of it from the cache.
+	for _, target := range []string{"/posts?per_page=1", "/posts/" + strconv.FormatUint(uint64(post.ID), 10)} {
+		t.Run(target, func(t *testing.T) {
+			requests := []struct {
+				host    string
+				headers map[string]string
+				cache   string
+			}{
+				{"evil.example", map[string]string{"X-Forwarded-Host": "evil.example", "X-Forwarded-Proto": "https"}, "MISS"},
+				{"localhost:8080", nil, "HIT"},
+			}
+
+			for _, request := range requests {
+				r := httptest.NewRequest("GET", target, nil)
+				r.Host = request.host
+				for name, value := range request.headers {
+					r.Header.Set(name, value)
+				}
+				w := httptest.NewRecorder()
+				handler.serverHandler().ServeHTTP(w, r)
+
+				if w.Code != http.StatusOK {
+					t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+				}
+				if cache := w.Header().Get("X-Cache"); cache != request.cache {
+					t.Errorf("X-Cache of %s = %s, want %s", request.host, cache, request.cache)
+				}
+				for name, values := range w.Header() {
+					if strings.Contains(strings.Join(values, " "), "evil.example") {
+						t.Errorf("%s of %s = %q", name, request.host, values)
+					}
+				}
+				if strings.Contains(w.Body.String(), "evil.example") {
+					t.Errorf("body of %s = %s", request.host, w.Body)
+				}
+				if strings.HasPrefix(target, "/posts?") && !strings.HasPrefix(w.Header().Get("Link"), "<http://localhost:8080/posts?") {
+					t.Errorf("Link of %s = %q", request.host, w.Header().Get("Link"))
+				}
+			}
+		})
+	}
+}
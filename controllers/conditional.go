@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/utils/responses"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkIfMatch checks the If-Match header of a request
+// changing a resource against its current entity tag.
+// If the header is missing it is only accepted when
+// RequireIfMatch is off. It writes the error response
+// and returns false if the request can not go on.
+func (handler Handler) checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if handler.RequireIfMatch {
+			responses.ERROR(w, http.StatusPreconditionRequired, errors.New("the request must have an If-Match header"))
+			return false
+		}
+		return true
+	}
+
+	if !etagMatches(header, etag, false) {
+		responses.ERROR(w, http.StatusPreconditionFailed, errors.New("the resource is changed since you read it"))
+		return false
+	}
+
+	return true
+}
+
+// notModified checks the If-None-Match header of a request
+// reading a resource. If the client already has the current
+// version it writes the 304 response and returns true.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatches(header, etag, true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// notModifiedSince checks the If-Modified-Since header of a request
+// reading a resource last modified at given time. If the client
+// already has it, it writes the 304 response and returns true.
+func notModifiedSince(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.Truncate(time.Second).After(since) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches reports if the list of entity tags in a conditional
+// header contains given tag. If-None-Match uses the weak comparison
+// which ignores the W/ prefix while If-Match uses the strong one.
+func etagMatches(header string, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
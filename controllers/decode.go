@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/nebisin/gopress/middlewares"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+var errTrailingData = errors.New("the body must have a single JSON value")
+
+// decodeJSON reads one JSON value from body into v. Unknown fields
+// and anything after the value are rejected, so a misspelled field
+// is not silently ignored.
+func decodeJSON(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		if errors.Is(err, middlewares.ErrBodyTooLarge) {
+			return err
+		}
+		return errTrailingData
+	}
+
+	return nil
+}
+
+// readBody reads the whole body of the request.
+func readBody(r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(r.Body)
+}
+
+// bodyStatus is the status of an error of reading the body. A body
+// which is not a single JSON value is a bad request, while a value
+// which does not fit, like one with an unknown field, is unprocessable.
+func bodyStatus(err error) int {
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.Is(err, middlewares.ErrBodyTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, errTrailingData), errors.As(err, &syntaxErr),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest
+	}
+	return http.StatusUnprocessableEntity
+}
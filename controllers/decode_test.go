@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"github.com/nebisin/gopress/config"
+	"github.com/nebisin/gopress/middlewares"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"username":"ann"}`, 0},
+		{`{"username":"ann"}` + "\n", 0},
+		{`{"username":"ann"}{"username":"bob"}`, http.StatusBadRequest},
+		{`{"username":"ann"} x`, http.StatusBadRequest},
+		{`{"username":`, http.StatusBadRequest},
+		{`{"username":"ann",}`, http.StatusBadRequest},
+		{``, http.StatusBadRequest},
+		{`{"name":"ann"}`, http.StatusUnprocessableEntity},
+		{`{"username":1}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		var v struct {
+			Username string `json:"username"`
+		}
+		err := decodeJSON(strings.NewReader(tt.body), &v)
+		if tt.status == 0 {
+			if err != nil || v.Username != "ann" {
+				t.Errorf("decodeJSON(%q) = %v, %+v", tt.body, err, v)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("decodeJSON(%q) gave no error", tt.body)
+		} else if status := bodyStatus(err); status != tt.status {
+			t.Errorf("bodyStatus of %q = %d, want %d", tt.body, status, tt.status)
+		}
+	}
+}
+
+func TestDecodeJSONTooLarge(t *testing.T) {
+	body := middlewares.LimitBody(httptest.NewRecorder(), ioutil.NopCloser(strings.NewReader(`{"username":"ann"}`)), 8)
+
+	var v struct {
+		Username string `json:"username"`
+	}
+	err := decodeJSON(body, &v)
+	if status := bodyStatus(err); status != http.StatusRequestEntityTooLarge {
+		t.Errorf("bodyStatus(%v) = %d, want %d", err, status, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestBodyErrors(t *testing.T) {
+	handler := newTestHandler(t, func(c *config.Config) {
+		c.Server.MaxBodySize = 128
+	})
+	token := register(t, handler, "author")
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{"too large", "POST", "/register", `{"username":"` + strings.Repeat("a", 128) + `"}`, http.StatusRequestEntityTooLarge},
+		{"trailing data", "POST", "/register", `{"username":"ann"}{}`, http.StatusBadRequest},
+		{"unknown field", "POST", "/register", `{"name":"ann"}`, http.StatusUnprocessableEntity},
+		{"too large update", "PUT", "/me", `{"displayName":"` + strings.Repeat("a", 128) + `"}`, http.StatusRequestEntityTooLarge},
+		{"trailing data of an update", "PUT", "/me", `{"username":"author"} []`, http.StatusBadRequest},
+		{"unknown field of an update", "PUT", "/me", `{"name":"author"}`, http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(handler, tt.method, tt.target, token, strings.NewReader(tt.body))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
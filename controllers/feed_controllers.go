@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/feeds"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"github.com/nebisin/gopress/utils/responses"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handleFeed method renders the latest published posts
+// of the whole blog as a feed.
+func (handler Handler) handleFeed(w http.ResponseWriter, r *http.Request) {
+	handler.writeFeed(w, r, handler.SiteTitle, repository.PostFilter{})
+}
+
+// handleUserFeed method renders the latest published posts
+// of the user with given id as a feed.
+func (handler Handler) handleUserFeed(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	uid, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	db := handler.users(r.Context())
+
+	user, err := db.FindById(uint(uid))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responses.ERROR(w, http.StatusNotFound, errors.New("the user with id "+id+" could not found"))
+		} else {
+			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			logError(r, err)
+		}
+		return
+	}
+
+	title := fmt.Sprintf("%s - posts by %s", handler.SiteTitle, authorName(&user))
+	handler.writeFeed(w, r, title, repository.PostFilter{AuthorID: user.ID})
+}
+
+// handleTagFeed method renders the latest published posts
+// with given tag as a feed.
+func (handler Handler) handleTagFeed(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	db := repository.NewTagRepository(handler.DB.WithContext(r.Context()))
+
+	tag, err := db.FindByName(name)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responses.ERROR(w, http.StatusNotFound, errors.New("the tag "+name+" could not found"))
+		} else {
+			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			logError(r, err)
+		}
+		return
+	}
+
+	title := fmt.Sprintf("%s - posts tagged %s", handler.SiteTitle, tag.Name)
+	handler.writeFeed(w, r, title, repository.PostFilter{Tag: tag.Name})
+}
+
+// writeFeed method renders the posts matching the filter in the format
+// given in the url. Feeds can be cached by clients and proxies and
+// they are modified when the latest of their posts is updated.
+func (handler Handler) writeFeed(w http.ResponseWriter, r *http.Request, title string, filter repository.PostFilter) {
+	format := mux.Vars(r)["format"]
+
+	db := handler.posts(r.Context())
+
+	posts, err := db.FindRecent(filter, handler.FeedItems)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	base := handler.baseURL()
+	feed := feeds.Feed{
+		Title:       title,
+		Description: "Latest posts of " + title,
+		Link:        base + "/posts",
+		URL:         base + r.URL.Path,
+	}
+
+	for _, post := range posts {
+		if post.UpdatedAt.After(feed.Updated) {
+			feed.Updated = post.UpdatedAt
+		}
+		feed.Items = append(feed.Items, handler.feedItem(base, post))
+	}
+
+	w.Header().Set("Content-Type", feeds.ContentType(format))
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if !feed.Updated.IsZero() {
+		w.Header().Set("Last-Modified", feed.Updated.UTC().Format(http.TimeFormat))
+		if notModifiedSince(w, r, feed.Updated) {
+			return
+		}
+	} else {
+		feed.Updated = time.Now()
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if err := feeds.Write(w, format, feed); err != nil {
+		logError(r, err)
+	}
+}
+
+func (handler Handler) feedItem(base string, post models.Post) feeds.Item {
+	link := fmt.Sprintf("%s/posts/%d", base, post.ID)
+
+	published := post.CreatedAt
+	if post.PublishedAt != nil {
+		published = *post.PublishedAt
+	}
+
+	content := feeds.TextToHTML(post.Body)
+	if !handler.FeedFullContent {
+		content = feeds.TextToHTML(post.Excerpt)
+	}
+
+	tags := make([]string, len(post.Tags))
+	for i, tag := range post.Tags {
+		tags[i] = tag.Name
+	}
+
+	return feeds.Item{
+		ID:        link,
+		Title:     post.Title,
+		Link:      link,
+		Author:    authorName(post.Author),
+		Published: published,
+		Updated:   post.UpdatedAt,
+		Content:   content,
+		Tags:      tags,
+	}
+}
+
+// authorName is the name of the user shown to readers.
+func authorName(user *models.User) string {
+	if user == nil {
+		return ""
+	}
+	if user.DisplayName != "" {
+		return user.DisplayName
+	}
+
+	return user.Username
+}
+
+// baseURL returns the public url of the site without a trailing
+// slash. Links are not made from the Host of the requests, so
+// clients can not make the server link to another site.
+func (handler Handler) baseURL() string {
+	return strings.TrimRight(handler.Config.Server.PublicURL, "/")
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/nebisin/gopress/config"
+	"github.com/nebisin/gopress/search"
+	"github.com/nebisin/gopress/utils/auth"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestHandler sets up a handler on a SQLite database in a temporary
+// directory. Logging, tracing and the metrics of the database are left
+// out, they are global. No background job is started.
+// The config can be changed by configure before the handler is set up.
+func newTestHandler(t *testing.T, configure func(c *config.Config)) *Handler {
+	t.Helper()
+
+	c := config.Default()
+	c.Auth.Secret = "secret"
+	c.Database.DSN = filepath.Join(t.TempDir(), "test.db")
+	c.Storage.Path = t.TempDir()
+	if configure != nil {
+		configure(&c)
+	}
+
+	handler := &Handler{Config: c, RequireIfMatch: c.Posts.RequireIfMatch}
+	handler.Tokens = auth.Tokens{Secret: []byte(c.Auth.Secret), TTL: c.Auth.TokenTTL, Check: handler.checkToken}
+	handler.initializeFeeds()
+	handler.openDatabase()
+	handler.migrateDatabase()
+	if err := search.Register(handler.DB); err != nil {
+		t.Fatal(err)
+	}
+	handler.initializeSitemaps()
+	handler.initializeCache()
+	handler.initializeStorage()
+	handler.workers = newWorkers()
+	handler.initializeRoutes()
+
+	t.Cleanup(func() {
+		sqlDB, err := handler.DB.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	return handler
+}
+
+// serve sends a request to the handler. The token is
+// sent as a bearer token unless it is empty.
+func serve(handler *Handler, method string, target string, token string, body io.Reader) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, body)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	handler.serverHandler().ServeHTTP(w, r)
+	return w
+}
+
+// register makes a user with the password "password"
+// and returns the token given to it.
+func register(t *testing.T, handler *Handler, name string) string {
+	t.Helper()
+
+	body := `{"username":"` + name + `","email":"` + name + `@example.com","password":"password"}`
+	w := serve(handler, "POST", "/register", "", strings.NewReader(body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register %s: status = %d, body = %s", name, w.Code, w.Body)
+	}
+
+	var token string
+	if err := json.NewDecoder(w.Body).Decode(&token); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
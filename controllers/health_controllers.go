@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/nebisin/gopress/buildinfo"
+	"github.com/nebisin/gopress/migrations"
+	"github.com/nebisin/gopress/utils/responses"
+	"net/http"
+	"time"
+)
+
+// checkTimeout is how long one readiness check can take.
+const checkTimeout = 2 * time.Second
+
+// check is the result of one readiness check. The errors of
+// the checks are logged, they are not given to the public.
+type check struct {
+	Status     string  `json:"status"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+type readiness struct {
+	Status string           `json:"status"`
+	Checks map[string]check `json:"checks"`
+}
+
+// handleHealthz method tells the process is alive.
+func (handler Handler) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz method tells whether the server can take requests.
+// The database must be reachable with every migration applied and
+// the background jobs must be running.
+func (handler Handler) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"database", handler.checkDatabase},
+		{"migrations", handler.checkMigrations},
+		{"workers", func(context.Context) error { return handler.workers.Check() }},
+	}
+
+	result := readiness{Status: "ok", Checks: make(map[string]check)}
+	for _, c := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		start := time.Now()
+		err := c.run(ctx)
+		cancel()
+
+		status := check{
+			Status:     "ok",
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			status.Status = "fail"
+			result.Status = "fail"
+			logError(r, fmt.Errorf("%s check: %w", c.name, err))
+		}
+		result.Checks[c.name] = status
+	}
+
+	code := http.StatusOK
+	if result.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	responses.JSON(w, code, result)
+}
+
+// handleVersion method writes the build of the running server.
+func (handler Handler) handleVersion(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, buildinfo.Get())
+}
+
+func (handler Handler) checkDatabase(ctx context.Context) error {
+	sqlDB, err := handler.DB.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+func (handler Handler) checkMigrations(ctx context.Context) error {
+	migrator, err := migrations.New(handler.DB.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	if version != migrator.Latest() {
+		return fmt.Errorf("the schema is at version %d but %d is needed", version, migrator.Latest())
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/nebisin/gopress/logging"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	handler := newTestHandler(t, nil)
+
+	w := serve(handler, "GET", "/readyz", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, body = %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	var logs bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(&logs, logging.LevelInfo))
+
+	if err := handler.workers.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := handler.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	w = serve(handler, "GET", "/readyz", "", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	body := w.Body.String()
+
+	var result readiness
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"database", "migrations", "workers"} {
+		if result.Checks[name].Status != "fail" {
+			t.Errorf("%s check = %+v, want fail", name, result.Checks[name])
+		}
+	}
+
+	for _, detail := range []string{"closed", "background jobs", "sql:"} {
+		if strings.Contains(body, detail) {
+			t.Errorf("body %s gives the error %q", body, detail)
+		}
+		if !strings.Contains(logs.String(), detail) {
+			t.Errorf("log %s does not have the error %q", logs.String(), detail)
+		}
+	}
+}
@@ -0,0 +1,596 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/images"
+	"github.com/nebisin/gopress/logging"
+	"github.com/nebisin/gopress/middlewares"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"github.com/nebisin/gopress/storage"
+	"github.com/nebisin/gopress/utils/pagination"
+	"github.com/nebisin/gopress/utils/responses"
+	"gorm.io/gorm"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errTooLarge = errors.New("the file is too large")
+
+// mediaExtensions are the file extensions used in
+// storage keys of the commonly uploaded types.
+var mediaExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// handleMediaUpload method stores a file sent as the "file" field of a
+// multipart form. The type of the file is sniffed from it's content,
+// the name and the type given by the client are not trusted.
+// It requires authentication.
+func (handler Handler) handleMediaUpload(w http.ResponseWriter, r *http.Request) {
+	uid, err := handler.Tokens.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	db := repository.NewMediaRepository(handler.DB.WithContext(r.Context()))
+
+	limit := handler.MediaMaxSize
+	quotaLimited := false
+	if handler.MediaQuota > 0 {
+		usage, err := db.UsageByOwner(uid)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			logError(r, err)
+			return
+		}
+		if remaining := handler.MediaQuota - usage; remaining < limit {
+			limit = remaining
+			quotaLimited = true
+		}
+		if limit <= 0 {
+			responses.ERROR(w, http.StatusRequestEntityTooLarge, errors.New("your storage quota is used up"))
+			return
+		}
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, errors.New("the request must be multipart/form-data"))
+		return
+	}
+
+	var part io.Reader
+	var fileName string
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		if p.FormName() == "file" {
+			part, fileName = p, p.FileName()
+			break
+		}
+	}
+	if part == nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("the file field is required"))
+		return
+	}
+
+	tmp, size, err := spool(part, limit)
+	if err != nil {
+		if errors.Is(err, errTooLarge) {
+			if quotaLimited {
+				err = repository.ErrQuotaExceeded
+			}
+			responses.ERROR(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if size == 0 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("the file is empty"))
+		return
+	}
+
+	contentType, err := sniff(tmp)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+	if !handler.MediaTypes[contentType] {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, fmt.Errorf("files of type %s are not allowed", contentType))
+		return
+	}
+
+	key, err := storageKey(uid, contentType)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	media := models.Media{
+		OwnerID:     uid,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		Size:        size,
+		StorageKey:  key,
+		Status:      models.MediaReady,
+	}
+
+	var content io.Reader = tmp
+	if images.Decodable(contentType) {
+		// Metadata is stripped before the image is stored
+		// so it is never served, variants are made later.
+		data, err := ioutil.ReadAll(tmp)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			logError(r, err)
+			return
+		}
+		if data, err = images.Strip(data, contentType); err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("the image could not be read"))
+			return
+		}
+
+		content = bytes.NewReader(data)
+		media.Size = int64(len(data))
+		media.Status = models.MediaProcessing
+	}
+
+	if err := handler.Storage.Put(r.Context(), key, content, media.Size, contentType); err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	// The quota is checked again while saving since
+	// other uploads of the user may be saved meanwhile.
+	if handler.MediaQuota > 0 {
+		err = db.SaveWithinQuota(&media, handler.MediaQuota)
+	} else {
+		err = db.Save(&media)
+	}
+	if err != nil {
+		if err := handler.Storage.Delete(r.Context(), key); err != nil {
+			logError(r, err)
+		}
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			responses.ERROR(w, http.StatusRequestEntityTooLarge, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	if media.Status == models.MediaProcessing {
+		handler.wakeMediaWorker()
+	}
+
+	media.Variants = make([]models.MediaVariant, 0)
+	handler.setMediaURLs(&media)
+	responses.JSON(w, http.StatusCreated, media)
+}
+
+// handleMyMedia method gets one page of users own uploads.
+func (handler Handler) handleMyMedia(w http.ResponseWriter, r *http.Request) {
+	uid, err := handler.Tokens.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	db := repository.NewMediaRepository(handler.DB.WithContext(r.Context()))
+
+	media, meta, err := db.FindByOwner(uid, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	for i := range media {
+		handler.setMediaURLs(&media[i])
+	}
+
+	responses.PAGE(w, r, handler.baseURL(), media, meta)
+}
+
+// handleMediaGet method gets the details of a media.
+func (handler Handler) handleMediaGet(w http.ResponseWriter, r *http.Request) {
+	media, ok := handler.findMedia(w, r)
+	if !ok {
+		return
+	}
+
+	handler.setMediaURLs(&media)
+	responses.JSON(w, http.StatusOK, media)
+}
+
+// handleMediaContent method sends the content of a media.
+func (handler Handler) handleMediaContent(w http.ResponseWriter, r *http.Request) {
+	media, ok := handler.findMedia(w, r)
+	if !ok {
+		return
+	}
+
+	handler.writeContent(w, r, media, media.StorageKey, media.ContentType, media.Size, media.FileName)
+}
+
+// handleMediaVariant method sends the content of a resized variant of an image.
+func (handler Handler) handleMediaVariant(w http.ResponseWriter, r *http.Request) {
+	media, ok := handler.findMedia(w, r)
+	if !ok {
+		return
+	}
+
+	name := mux.Vars(r)["name"]
+	for _, variant := range media.Variants {
+		if variant.Name == name {
+			handler.writeContent(w, r, media, variant.StorageKey, variant.ContentType, variant.Size, "")
+			return
+		}
+	}
+
+	responses.ERROR(w, http.StatusNotFound, errors.New("variant could not found"))
+}
+
+// writeContent streams a file from the storage.
+// Contents never change so they can be cached forever.
+func (handler Handler) writeContent(w http.ResponseWriter, r *http.Request, media models.Media, key string, contentType string, size int64, fileName string) {
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Last-Modified", media.CreatedAt.UTC().Format(http.TimeFormat))
+	if notModifiedSince(w, r, media.CreatedAt) {
+		return
+	}
+
+	content, err := handler.Storage.Get(r.Context(), key)
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		if errors.Is(err, storage.ErrNotFound) {
+			responses.ERROR(w, http.StatusNotFound, errors.New("the content of the media is missing"))
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if fileName != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": fileName}))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		logError(r, err)
+	}
+}
+
+// handleMediaDelete method removes a media and it's content.
+// It requires authentication and user must be the owner of the media.
+func (handler Handler) handleMediaDelete(w http.ResponseWriter, r *http.Request) {
+	uid, err := handler.Tokens.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	media, ok := handler.findMedia(w, r)
+	if !ok {
+		return
+	}
+
+	if media.OwnerID != uid {
+		responses.ERROR(w, http.StatusForbidden, errors.New("you are not the owner of the media"))
+		return
+	}
+
+	db := repository.NewMediaRepository(handler.DB.WithContext(r.Context()))
+
+	if err := db.DeleteById(media.ID); err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+	handler.postsChanged(r.Context())
+
+	// The record is gone already so a file left behind
+	// is only logged, it can not be reached anymore.
+	keys := []string{media.StorageKey}
+	for _, variant := range media.Variants {
+		keys = append(keys, variant.StorageKey)
+	}
+	for _, key := range keys {
+		if err := handler.Storage.Delete(r.Context(), key); err != nil {
+			logError(r, err)
+		}
+	}
+
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (handler Handler) findMedia(w http.ResponseWriter, r *http.Request) (models.Media, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return models.Media{}, false
+	}
+
+	db := repository.NewMediaRepository(handler.DB.WithContext(r.Context()))
+
+	media, err := db.FindById(uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responses.ERROR(w, http.StatusNotFound, errors.New("media could not found"))
+			return models.Media{}, false
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return models.Media{}, false
+	}
+
+	return media, true
+}
+
+// spool copies an uploaded file into a temporary file so its size
+// and type are known before it is sent to the storage. It fails
+// with errTooLarge if the file is larger than limit bytes or
+// the request body is larger than its limit.
+func spool(r io.Reader, limit int64) (*os.File, int64, error) {
+	tmp, err := ioutil.TempFile("", "gopress-upload-*")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(tmp, io.LimitReader(r, limit+1))
+	if (err == nil && size > limit) || errors.Is(err, middlewares.ErrBodyTooLarge) {
+		err = errTooLarge
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, 0, err
+	}
+
+	return tmp, size, nil
+}
+
+// sniff detects the type of a file from its first bytes
+// and rewinds it to the beginning.
+func sniff(f *os.File) (string, error) {
+	head := make([]byte, 512)
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	return contentType, err
+}
+
+// storageKey makes a random key for a new file of the user.
+func storageKey(uid uint, contentType string) (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	ext, ok := mediaExtensions[contentType]
+	if !ok {
+		if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	return fmt.Sprintf("%d/%s%s", uid, hex.EncodeToString(random), ext), nil
+}
+
+// cleanFileName keeps only the base name of the file name given by
+// the client. It is only used for showing and downloading the file.
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+
+	return name
+}
+
+// setMediaURLs sets the urls of the content and the variants of a media.
+func (handler Handler) setMediaURLs(media *models.Media) {
+	base := handler.baseURL() + "/media/" + strconv.FormatUint(uint64(media.ID), 10)
+
+	media.URL = base + "/content"
+	for i := range media.Variants {
+		media.Variants[i].URL = base + "/variants/" + media.Variants[i].Name
+	}
+}
+
+// wakeMediaWorker tells the media worker there are images to process.
+// It does not block, the worker processes everything waiting each time.
+func (handler Handler) wakeMediaWorker() {
+	select {
+	case handler.mediaQueue <- struct{}{}:
+	default:
+	}
+}
+
+// uploadLimit is the largest body of an upload. It may be a little larger
+// than the file for the multipart boundaries and headers.
+func (handler Handler) uploadLimit() int64 {
+	return handler.MediaMaxSize + 1<<20
+}
+
+// mediaRetryDelay is how long the media worker waits
+// before trying again when the database fails.
+const mediaRetryDelay = time.Minute
+
+// processMedia method makes the variants of uploaded images
+// until ctx is done. Images left waiting when the program
+// stopped before are processed when it starts.
+func (handler *Handler) processMedia(ctx context.Context) {
+	db := repository.NewMediaRepository(handler.DB)
+
+	for {
+		// retry is set when the database fails, the media
+		// are processed again after a while instead of
+		// failing over and over again.
+		retry := false
+		for ctx.Err() == nil && !retry {
+			pending, err := db.FindPending(10)
+			if err != nil {
+				logging.Default().Error("finding media to process failed", "error", err)
+				retry = true
+				break
+			}
+			if len(pending) == 0 {
+				break
+			}
+
+			for _, media := range pending {
+				// Media left unprocessed are picked up
+				// again when the server is started.
+				if ctx.Err() != nil {
+					return
+				}
+				if err := handler.processImage(ctx, &media); err != nil {
+					// Stopping interrupts the processing, which
+					// is not a failure of the image.
+					if ctx.Err() != nil {
+						return
+					}
+					logging.Default().Error("processing media failed", "media_id", media.ID, "error", err)
+					if err := db.MarkFailed(media.ID); err != nil {
+						logging.Default().Error("media could not be marked as failed", "media_id", media.ID, "error", err)
+						retry = true
+					}
+				}
+				// Posts have the variants of their featured media.
+				handler.postsChanged(ctx)
+				if retry {
+					break
+				}
+			}
+		}
+
+		var wait <-chan time.Time
+		if retry {
+			wait = time.After(mediaRetryDelay)
+		}
+		select {
+		case <-handler.mediaQueue:
+		case <-wait:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// processImage reads an image from the storage, stores it's variants
+// and saves them with the dimensions and the blurhash of the image.
+// It stops when ctx is done.
+func (handler *Handler) processImage(ctx context.Context, media *models.Media) error {
+	content, err := handler.Storage.Get(ctx, media.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(content)
+	content.Close()
+	if err != nil {
+		return err
+	}
+
+	img, err := images.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	media.Width, media.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	media.Blurhash = images.Blurhash(img, 4, 3)
+	media.Variants = make([]models.MediaVariant, 0, len(handler.ImageVariants))
+
+	base := strings.TrimSuffix(media.StorageKey, filepath.Ext(media.StorageKey))
+	for _, v := range handler.ImageVariants {
+		resized, ok := images.Resize(img, v)
+		if !ok {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var buf bytes.Buffer
+		contentType, err := images.Encode(&buf, resized)
+		if err != nil {
+			return err
+		}
+
+		variant := models.MediaVariant{
+			Name:        v.Name,
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+			ContentType: contentType,
+			Size:        int64(buf.Len()),
+			StorageKey:  base + "-" + v.Name + mediaExtensions[contentType],
+		}
+		if err := handler.Storage.Put(ctx, variant.StorageKey, &buf, variant.Size, contentType); err != nil {
+			return err
+		}
+		media.Variants = append(media.Variants, variant)
+	}
+
+	return repository.NewMediaRepository(handler.DB.WithContext(ctx)).SaveProcessed(media)
+}
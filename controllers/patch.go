@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/utils/jsonpatch"
+	"mime"
+	"net/http"
+)
+
+var errUnsupportedPatch = errors.New("patch must be " + jsonpatch.MergePatchType + " or " + jsonpatch.JSONPatchType)
+
+// applyPatch applies the patch in the body of a PATCH request to
+// the JSON document of the resource. Bodies sent as plain JSON
+// are treated as merge patches.
+func applyPatch(r *http.Request, doc []byte, patch []byte) ([]byte, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return jsonpatch.MergePatch(doc, patch)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errUnsupportedPatch
+	}
+
+	switch mediaType {
+	case jsonpatch.MergePatchType, "application/json":
+		return jsonpatch.MergePatch(doc, patch)
+	case jsonpatch.JSONPatchType:
+		return jsonpatch.Apply(doc, patch)
+	}
+
+	return nil, errUnsupportedPatch
+}
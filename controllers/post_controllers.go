@@ -1,16 +1,17 @@
 package controllers
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/metrics"
 	"github.com/nebisin/gopress/models"
 	"github.com/nebisin/gopress/repository"
-	"github.com/nebisin/gopress/utils/auth"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"github.com/nebisin/gopress/utils/pagination"
 	"github.com/nebisin/gopress/utils/responses"
 	"gorm.io/gorm"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"strconv"
 )
@@ -19,13 +20,13 @@ import (
 // Only authenticated users create a post.
 func (handler *Handler) handlePostCreate(w http.ResponseWriter, r *http.Request)  {
 	var postDTO models.PostDTO
-	if err := json.NewDecoder(r.Body).Decode(&postDTO); err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+	if err := decodeJSON(r.Body, &postDTO); err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
 		return
 	}
 	post := models.DTOToPost(postDTO)
 
-	uid, err := auth.ExtractTokenID(r)
+	uid, err := handler.Tokens.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
 		return
@@ -33,35 +34,52 @@ func (handler *Handler) handlePostCreate(w http.ResponseWriter, r *http.Request)
 
 	post.AuthorID = &uid
 
-	db := repository.NewPostRepository(handler.DB)
+	db := handler.posts(r.Context())
 
 	if err := db.Save(&post); err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		if errors.Is(err, repository.ErrInvalidFeaturedMedia) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
+	if post.IsPublished {
+		metrics.PostsPublished.Inc()
+	}
+	handler.postChanged(post)
 
+	handler.setPostURLs(&post)
 	responses.JSON(w, http.StatusCreated, post)
 }
 
 // handlePostGet method get the post by given id.
 // If post is published everybody can read it.
 // But post is not published only the author can access it.
+// The version of the post is sent as ETag so clients can make
+// conditional requests with If-None-Match and If-Match.
 func (handler *Handler) handlePostGet(w http.ResponseWriter, r *http.Request)  {
 	// We get the id in url and parse it as uint type
 	vars := mux.Vars(r)
 	id := vars["id"]
 	i, err := strconv.ParseUint(id, 10, 64)
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
 
-	db := repository.NewPostRepository(handler.DB)
+	db := handler.posts(r.Context())
+
+	fields := fieldset.FromRequest(r)
 
 	// We try to find the post with given id
-	post, err := db.FindById(uint(i))
+	post, err := db.FindByIdWithFields(uint(i), fields)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, fieldset.ErrUnknownField) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
 			responses.ERROR(w, http.StatusNotFound, errors.New("the post with id " + id + " could not found"))
 		} else {
 			// If method is failed for another reason than "record not found"
@@ -69,14 +87,14 @@ func (handler *Handler) handlePostGet(w http.ResponseWriter, r *http.Request)  {
 			// Instead we send a generic error to the user
 			// and print the actual error to the console
 			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
-			log.Println(err)
+			logError(r, err)
 		}
 		return
 	}
 
 	// If post is not published only the author can access it.
 	if post.IsPublished == false {
-		uid, err := auth.ExtractTokenID(r)
+		uid, err := handler.Tokens.ExtractTokenID(r)
 		if err != nil {
 			// If the requester not authenticated we pretend like post is not exist
 			// for protection against data leak.
@@ -84,33 +102,122 @@ func (handler *Handler) handlePostGet(w http.ResponseWriter, r *http.Request)  {
 			return
 		}
 
-		if uid != post.Author.ID {
+		if uid != *post.AuthorID {
 			responses.ERROR(w, http.StatusNotFound, errors.New("the post with id " + id + " could not found"))
 			return
 		}
 	}
 
-	responses.JSON(w, http.StatusOK, post)
+	w.Header().Set("ETag", post.ETag())
+	handler.setPostCacheHeaders(w, post.IsPublished, post.UpdatedAt)
+	if notModified(w, r, post.ETag()) {
+		return
+	}
+	// If-Modified-Since is only used by clients without the ETag.
+	if r.Header.Get("If-None-Match") == "" && notModifiedSince(w, r, post.UpdatedAt) {
+		return
+	}
+
+	handler.setPostURLs(&post)
+
+	shaped, err := fields.Apply(post, repository.PostRelations...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusOK, shaped)
 }
 
-// handlePostUpdate method update the post by given id and body.
+// handlePostUpdate method replaces the post by given id with the body.
+// Fields missing in the body are cleared like they are sent empty.
 // It requires authentication and user must be the owner of the post.
 func (handler Handler) handlePostUpdate(w http.ResponseWriter, r *http.Request)  {
+	post, ok := handler.editablePost(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
+		return
+	}
+
+	var postUpdate models.PostDTO
+
+	if err = decodeJSON(bytes.NewReader(body), &postUpdate); err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
+		return
+	}
+
+	handler.replacePost(w, r, &post, postUpdate)
+}
+
+// handlePostPatch method changes the post by given id with a patch.
+// The body is a JSON Merge Patch, or a JSON Patch if it is sent
+// with application/json-patch+json content type. Only the fields
+// in the patch are changed and the ones set to null are cleared.
+// It requires authentication and user must be the owner of the post.
+func (handler Handler) handlePostPatch(w http.ResponseWriter, r *http.Request) {
+	post, ok := handler.editablePost(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		responses.ERROR(w, bodyStatus(err), err)
+		return
+	}
+
+	doc, err := json.Marshal(models.PostToDTO(post))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	patched, err := applyPatch(r, doc, body)
+	if err != nil {
+		if errors.Is(err, errUnsupportedPatch) {
+			responses.ERROR(w, http.StatusUnsupportedMediaType, err)
+			return
+		}
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	var postUpdate models.PostDTO
+
+	if err = decodeJSON(bytes.NewReader(patched), &postUpdate); err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	handler.replacePost(w, r, &post, postUpdate)
+}
+
+// editablePost finds the post in the url and checks that the requester
+// is its owner and has its current version. It writes the error response
+// and returns false if the request can not go on.
+func (handler Handler) editablePost(w http.ResponseWriter, r *http.Request) (models.Post, bool) {
 	// We try to get the user id from auth token:
-	uid, err := auth.ExtractTokenID(r)
+	uid, err := handler.Tokens.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
-		return
+		return models.Post{}, false
 	}
 
 	vars := mux.Vars(r)
 	pid, err := strconv.ParseUint(vars["id"], 10, 64)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
-		return
+		return models.Post{}, false
 	}
 
-	db := repository.NewPostRepository(handler.DB)
+	db := handler.posts(r.Context())
 
 	post, err := db.FindById(uint(pid))
 	if err != nil {
@@ -118,36 +225,51 @@ func (handler Handler) handlePostUpdate(w http.ResponseWriter, r *http.Request)
 			responses.ERROR(w, http.StatusNotFound, errors.New("the post with id " + vars["id"] + " could not found"))
 		} else {
 			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
-			log.Println(err)
+			logError(r, err)
 		}
-		return
+		return models.Post{}, false
 	}
 
 	if post.Author.ID != uid {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("you can not update the post who belongs to someone else"))
-		return
+		return models.Post{}, false
 	}
 
-	body, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+	if !handler.checkIfMatch(w, r, post.ETag()) {
+		return models.Post{}, false
 	}
 
-	var postUpdate models.PostDTO
+	return post, true
+}
 
-	if err = json.Unmarshal(body, &postUpdate); err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
-	}
+// replacePost method writes the new version of the post
+// and sends it back to the client.
+func (handler Handler) replacePost(w http.ResponseWriter, r *http.Request, post *models.Post, postUpdate models.PostDTO) {
+	db := handler.posts(r.Context())
 
 	newPost := models.DTOToPost(postUpdate)
+	firstPublished := newPost.IsPublished && post.PublishedAt == nil
 
-	if err = db.UpdateById(&post, newPost); err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+	if err := db.UpdateById(post, newPost); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			responses.ERROR(w, http.StatusPreconditionFailed, err)
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidFeaturedMedia) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
+	if firstPublished {
+		metrics.PostsPublished.Inc()
+	}
+	handler.postChanged(*post)
 
+	w.Header().Set("ETag", post.ETag())
+	handler.setPostURLs(post)
 	responses.JSON(w, http.StatusCreated, post)
 }
 
@@ -162,7 +284,7 @@ func (handler *Handler) handlePostDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	db := repository.NewPostRepository(handler.DB)
+	db := handler.posts(r.Context())
 
 	post, err := db.FindById(uint(i))
 	if err != nil {
@@ -170,7 +292,7 @@ func (handler *Handler) handlePostDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	uid, err := auth.ExtractTokenID(r)
+	uid, err := handler.Tokens.ExtractTokenID(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
 		return
@@ -181,38 +303,140 @@ func (handler *Handler) handlePostDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if 	err := db.DeleteById(uint(i)); err != nil{
+	if !handler.checkIfMatch(w, r, post.ETag()) {
+		return
+	}
+
+	if 	err := db.DeleteByIdAndVersion(uint(i), post.Version); err != nil{
+		if errors.Is(err, repository.ErrVersionConflict) {
+			responses.ERROR(w, http.StatusPreconditionFailed, err)
+			return
+		}
 		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
-		log.Println(err)
+		logError(r, err)
 		return
 	}
+	handler.postChanged(post)
 
 	responses.JSON(w, http.StatusNoContent, "")
 }
 
-// handlePostGetMany method find many posts within the given limit.
-// It only return published posts.
+// handlePostGetMany method find one page of posts.
+// It only return published posts unless an authenticated user
+// asks for own drafts with the status filter.
 func (handler Handler) handlePostGetMany(w http.ResponseWriter, r *http.Request)  {
-	keys := r.URL.Query()
-	limitStr := keys.Get("limit")
+	query, err := postQueryFromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
 
-	var limit int
-	var err error
-	if len(limitStr) != 0 {
-		limit, err = strconv.Atoi(limitStr)
+	// Drafts are only visible to their authors
+	// so other statuses are limited to own posts.
+	public := query.Filter.Status == "" || query.Filter.Status == repository.StatusPublished
+	if !public {
+		uid, err := handler.Tokens.ExtractTokenID(r)
 		if err != nil {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		query.Filter.AuthorID = uid
+	}
+
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	db := handler.posts(r.Context())
+
+	posts, meta, err := db.FindMany(query, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) || errors.Is(err, fieldset.ErrUnknownField) {
 			responses.ERROR(w, http.StatusUnprocessableEntity, err)
 			return
 		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
 	}
 
-	db := repository.NewPostRepository(handler.DB)
+	handler.setPostCacheHeaders(w, public, lastModified(posts))
+	handler.writePostPage(w, r, posts, meta, query.Fields)
+}
 
-	posts, err := db.FindMany(limit)
+// writePostPage sends one page of posts. Lists have the summaries
+// of the posts, or the whole posts if they are asked with full=true
+// or if only some fields of them are asked.
+func (handler Handler) writePostPage(w http.ResponseWriter, r *http.Request, posts []models.Post, meta pagination.Meta, fields fieldset.Fieldset) {
+	for i := range posts {
+		handler.setPostURLs(&posts[i])
+	}
+
+	var list interface{} = posts
+	if r.URL.Query().Get("full") != "true" && !fields.HasFields() {
+		summaries := make([]models.PostSummary, len(posts))
+		for i, post := range posts {
+			summaries[i] = models.PostToSummary(post)
+		}
+		list = summaries
+	}
+
+	list, err := fields.Apply(list, repository.PostRelations...)
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
 		return
 	}
 
-	responses.JSON(w, http.StatusOK, posts)
-}
\ No newline at end of file
+	responses.PAGE(w, r, handler.baseURL(), list, meta)
+}
+
+// setPostURLs sets the urls of the featured media of a post.
+func (handler Handler) setPostURLs(post *models.Post) {
+	if post.FeaturedMedia != nil {
+		handler.setMediaURLs(post.FeaturedMedia)
+	}
+}
+
+// postQueryFromRequest reads the filters and the order
+// of a post list from the query string.
+func postQueryFromRequest(r *http.Request) (repository.PostQuery, error) {
+	keys := r.URL.Query()
+
+	var query repository.PostQuery
+	var err error
+
+	if author := keys.Get("author"); len(author) != 0 {
+		id, err := strconv.ParseUint(author, 10, 64)
+		if err != nil {
+			return query, errors.New("author must be a user id")
+		}
+		query.Filter.AuthorID = uint(id)
+	}
+
+	query.Filter.Tag = keys.Get("tag")
+	query.Filter.TitleContains = keys.Get("title")
+
+	query.Filter.Status = keys.Get("status")
+	if err := query.Filter.ValidateStatus(); err != nil {
+		return query, err
+	}
+
+	if query.Filter.From, err = parseDate(keys.Get("from")); err != nil {
+		return query, err
+	}
+	if query.Filter.To, err = parseDate(keys.Get("to")); err != nil {
+		return query, err
+	}
+
+	if query.Sort, err = repository.ParsePostSort(keys.Get("sort")); err != nil {
+		return query, err
+	}
+
+	query.Fields = fieldset.FromRequest(r)
+	query.Summary = keys.Get("full") != "true"
+
+	return query, nil
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"bytes"
+	"github.com/nebisin/gopress/logging"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestInternalErrors(t *testing.T) {
+	handler := newTestHandler(t, nil)
+	token := register(t, handler, "author")
+
+	var logs bytes.Buffer
+	defer logging.SetDefault(logging.Default())
+	logging.SetDefault(logging.New(&logs, logging.LevelInfo))
+
+	// The users are still there, so the token is valid
+	// but every query of the posts fails.
+	if err := handler.DB.Exec("DROP TABLE post_tags").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.DB.Exec("DROP TABLE posts").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"/posts", "/me/posts"} {
+		logs.Reset()
+
+		w := serve(handler, "GET", target, token, nil)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s status = %d, want %d", target, w.Code, http.StatusInternalServerError)
+		}
+		if body := w.Body.String(); !strings.Contains(body, "something went wrong") || strings.Contains(body, "posts") {
+			t.Errorf("GET %s body = %s", target, body)
+		}
+		if !strings.Contains(logs.String(), "no such table") {
+			t.Errorf("GET %s did not log the error: %s", target, logs.String())
+		}
+	}
+}
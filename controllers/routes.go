@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/metrics"
 	"github.com/nebisin/gopress/middlewares"
 	"log"
+	"net/http"
+	"time"
 )
 
 func (handler *Handler) initializeRoutes() {
@@ -11,21 +14,83 @@ func (handler *Handler) initializeRoutes() {
 
 	handler.Router = mux.NewRouter()
 
+	handler.Router.Use(middlewares.SetTracingMiddleware)
 	handler.Router.Use(middlewares.SetLoggingMiddleware)
-	handler.Router.Use(middlewares.SetMiddlewareJSON)
+	handler.Router.Use(middlewares.SetMetricsMiddleware)
+	handler.Router.Use(middlewares.SetRecoveryMiddleware)
+	if handler.Config.Server.Compression {
+		handler.Router.Use(middlewares.SetCompressionMiddleware(handler.Config.Server.CompressionMinSize))
+	}
+	handler.Router.Use(middlewares.SetBodyLimitMiddleware(handler.Config.Server.MaxBodySize, map[string]int64{
+		"/media": handler.uploadLimit(),
+	}))
+	handler.Router.Use(middlewares.SetTimeoutMiddleware(handler.Config.Server.RequestTimeout, map[string]time.Duration{
+		// Uploads are limited by the read timeout of the server.
+		"/media": 0,
+	}))
+	handler.Router.Use(middlewares.SetMiddlewareJSON(map[string]bool{
+		"/media": true,
+	}))
 
-	handler.Router.HandleFunc("/posts/{id}", handler.handlePostGet).Methods("GET")
-	handler.Router.HandleFunc("/posts", middlewares.SetMiddlewareAuthentication(handler.handlePostCreate)).Methods("POST")
-	handler.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(handler.handlePostUpdate)).Methods("PUT")
-	handler.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(handler.handlePostDelete)).Methods("DELETE")
-	handler.Router.HandleFunc("/posts", handler.handlePostGetMany).Methods("GET")
+	handler.Router.HandleFunc("/healthz", handler.handleHealthz).Methods("GET")
+	handler.Router.HandleFunc("/readyz", handler.handleReadyz).Methods("GET")
+	handler.Router.HandleFunc("/version", handler.handleVersion).Methods("GET")
+
+	handler.Router.HandleFunc("/posts/{id}", handler.cachePublic(handler.handlePostGet)).Methods("GET")
+	handler.Router.HandleFunc("/posts", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handlePostCreate)).Methods("POST")
+	handler.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handlePostUpdate)).Methods("PUT")
+	handler.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handlePostPatch)).Methods("PATCH")
+	handler.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handlePostDelete)).Methods("DELETE")
+	handler.Router.HandleFunc("/posts", handler.cachePublic(handler.handlePostGetMany)).Methods("GET")
+	handler.Router.HandleFunc("/posts/{id}/restore", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handlePostRestore)).Methods("POST")
+
+	handler.Router.HandleFunc("/search", handler.handleSearch).Methods("GET")
+
+	handler.Router.HandleFunc("/feed.{format:rss|atom|json}", handler.handleFeed).Methods("GET")
+	handler.Router.HandleFunc("/users/{id}/feed.{format:rss|atom|json}", handler.handleUserFeed).Methods("GET")
+	handler.Router.HandleFunc("/tags/{name}/feed.{format:rss|atom|json}", handler.handleTagFeed).Methods("GET")
+
+	handler.Router.HandleFunc("/sitemap.xml", handler.handleSitemapIndex).Methods("GET")
+	handler.Router.HandleFunc("/sitemap.xml.gz", handler.handleSitemapIndex).Methods("GET")
+	handler.Router.HandleFunc("/sitemaps/{name:(?:posts|authors|tags)-[0-9]+}.xml", handler.handleSitemap).Methods("GET")
+	handler.Router.HandleFunc("/sitemaps/{name:(?:posts|authors|tags)-[0-9]+}.xml.gz", handler.handleSitemap).Methods("GET")
+	handler.Router.HandleFunc("/robots.txt", handler.handleRobots).Methods("GET")
+
+	handler.Router.HandleFunc("/media", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleMediaUpload)).Methods("POST")
+	handler.Router.HandleFunc("/media/{id}", handler.handleMediaGet).Methods("GET")
+	handler.Router.HandleFunc("/media/{id}/content", handler.handleMediaContent).Methods("GET")
+	handler.Router.HandleFunc("/media/{id}/variants/{name}", handler.handleMediaVariant).Methods("GET")
+	handler.Router.HandleFunc("/media/{id}", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleMediaDelete)).Methods("DELETE")
 
 	handler.Router.HandleFunc("/register", handler.handleAuthRegister).Methods("POST")
 	handler.Router.HandleFunc("/login", handler.handleAuthLogin).Methods("POST")
-	handler.Router.HandleFunc("/me", middlewares.SetMiddlewareAuthentication(handler.handleMe)).Methods("GET")
-	handler.Router.HandleFunc("/me", middlewares.SetMiddlewareAuthentication(handler.handleUpdateMe)).Methods("PUT")
-	handler.Router.HandleFunc("/me/posts", middlewares.SetMiddlewareAuthentication(handler.handleMyPosts)).Methods("GET")
+	handler.Router.HandleFunc("/me", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleMe)).Methods("GET")
+	handler.Router.HandleFunc("/me", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleUpdateMe)).Methods("PUT")
+	handler.Router.HandleFunc("/me", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handlePatchMe)).Methods("PATCH")
+	handler.Router.HandleFunc("/me/posts", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleMyPosts)).Methods("GET")
+	handler.Router.HandleFunc("/me/media", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleMyMedia)).Methods("GET")
+	handler.Router.HandleFunc("/me/trash", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleMyTrash)).Methods("GET")
+	handler.Router.HandleFunc("/me/trash/{id}", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleTrashPurge)).Methods("DELETE")
 
 	handler.Router.HandleFunc("/users/{id}", handler.handleUserGet).Methods("GET")
 	handler.Router.HandleFunc("/users/{id}/posts", handler.handleUserPostsGet).Methods("GET")
+	handler.Router.HandleFunc("/users/{id}/trash", middlewares.SetMiddlewareAuthentication(handler.Tokens, handler.handleUserTrash)).Methods("GET")
+}
+
+// metricsHandler is the handler of the metrics server, which listens
+// to its own address so the metrics are not served to the public.
+func (handler *Handler) metricsHandler() http.Handler {
+	router := mux.NewRouter()
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	return router
+}
+
+// serverHandler is the handler of the server. CORS and the security
+// headers wrap the router so they also apply to preflight requests
+// and to requests matching no route, which skip its middlewares.
+func (handler *Handler) serverHandler() http.Handler {
+	var h http.Handler = handler.Router
+	h = middlewares.SetCORSMiddleware(handler.Config.CORS.Options())(h)
+	h = middlewares.SetSecurityHeadersMiddleware(handler.Config.Security.Options())(h)
+	return h
 }
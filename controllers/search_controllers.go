@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/search"
+	"github.com/nebisin/gopress/utils/pagination"
+	"github.com/nebisin/gopress/utils/responses"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleSearch method makes a full-text search over the published posts
+// and returns one page of the results.
+// The text is given with q and results can be filtered
+// by author id, tag name and creation date range.
+func (handler Handler) handleSearch(w http.ResponseWriter, r *http.Request) {
+	keys := r.URL.Query()
+
+	query := search.Query{
+		Terms: keys.Get("q"),
+		Tag:   keys.Get("tag"),
+	}
+	if len(query.Terms) == 0 {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("you have to provide a search text with q"))
+		return
+	}
+
+	if author := keys.Get("author"); len(author) != 0 {
+		id, err := strconv.ParseUint(author, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("author must be a user id"))
+			return
+		}
+		query.AuthorID = uint(id)
+	}
+
+	var err error
+	if query.From, err = parseDate(keys.Get("from")); err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if query.To, err = parseDate(keys.Get("to")); err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	db := handler.posts(r.Context())
+
+	results, meta, err := db.Search(query, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	responses.PAGE(w, r, handler.baseURL(), results, meta)
+}
+
+// parseDate parses dates given in query strings.
+// Both full RFC 3339 timestamps and plain dates are accepted.
+func parseDate(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("dates must be in YYYY-MM-DD or RFC 3339 format")
+	}
+
+	return t, nil
+}
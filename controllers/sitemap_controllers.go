@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/sitemaps"
+	"github.com/nebisin/gopress/utils/responses"
+	"net/http"
+	"strings"
+)
+
+// handleSitemapIndex method writes the sitemap index,
+// gzipped if the path ends with .gz.
+func (handler Handler) handleSitemapIndex(w http.ResponseWriter, r *http.Request) {
+	gzipped := strings.HasSuffix(r.URL.Path, ".gz")
+
+	doc, err := handler.Sitemaps.Index(gzipped)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	writeSitemap(w, r, doc, gzipped)
+}
+
+// handleSitemap method writes one of the sitemaps
+// of posts, authors or tags.
+func (handler Handler) handleSitemap(w http.ResponseWriter, r *http.Request) {
+	gzipped := strings.HasSuffix(r.URL.Path, ".gz")
+
+	doc, err := handler.Sitemaps.Sitemap(mux.Vars(r)["name"], gzipped)
+	if err != nil {
+		if errors.Is(err, sitemaps.ErrNotFound) {
+			responses.ERROR(w, http.StatusNotFound, err)
+		} else {
+			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			logError(r, err)
+		}
+		return
+	}
+
+	writeSitemap(w, r, doc, gzipped)
+}
+
+func writeSitemap(w http.ResponseWriter, r *http.Request, doc []byte, gzipped bool) {
+	if gzipped {
+		w.Header().Set("Content-Type", "application/gzip")
+	} else {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	}
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(doc); err != nil {
+		logError(r, err)
+	}
+}
+
+// handleRobots method writes the robots.txt file. If there is not
+// a configured one, it allows everything but the private routes.
+// The sitemap index is added if the file does not have a sitemap.
+func (handler Handler) handleRobots(w http.ResponseWriter, r *http.Request) {
+	robots := handler.RobotsTxt
+	if robots == "" {
+		robots = "User-agent: *\nDisallow: /me\nAllow: /\n"
+	}
+
+	if !strings.Contains(strings.ToLower(robots), "sitemap:") {
+		robots = strings.TrimRight(robots, "\n") + "\n\nSitemap: " + handler.baseURL() + "/sitemap.xml\n"
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write([]byte(robots)); err != nil {
+		logError(r, err)
+	}
+}
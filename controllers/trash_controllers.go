@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/logging"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"github.com/nebisin/gopress/utils/pagination"
+	"github.com/nebisin/gopress/utils/responses"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// handleMyTrash method gets one page of users own deleted posts.
+func (handler Handler) handleMyTrash(w http.ResponseWriter, r *http.Request) {
+	uid, err := handler.Tokens.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	handler.writeTrash(w, r, uid)
+}
+
+// handleUserTrash method gets one page of given users deleted posts.
+// Only admins can see the trash of other users.
+func (handler Handler) handleUserTrash(w http.ResponseWriter, r *http.Request) {
+	uid, err := handler.Tokens.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return
+	}
+
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	if uint(id) != uid && !handler.isAdmin(r.Context(), uid) {
+		responses.ERROR(w, http.StatusForbidden, errors.New("only admins can see the trash of other users"))
+		return
+	}
+
+	handler.writeTrash(w, r, uint(id))
+}
+
+func (handler Handler) writeTrash(w http.ResponseWriter, r *http.Request, uid uint) {
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	db := handler.posts(r.Context())
+
+	posts, meta, err := db.FindTrashed(uid, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	handler.writePostPage(w, r, posts, meta, fieldset.Fieldset{})
+}
+
+// handlePostRestore method takes a deleted post out of the trash.
+// It requires authentication and user must be the owner of the post or an admin.
+func (handler Handler) handlePostRestore(w http.ResponseWriter, r *http.Request) {
+	post, ok := handler.trashedPost(w, r)
+	if !ok {
+		return
+	}
+
+	db := handler.posts(r.Context())
+
+	if err := db.Restore(&post); err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+	handler.postChanged(post)
+
+	handler.setPostURLs(&post)
+	responses.JSON(w, http.StatusOK, post)
+}
+
+// handleTrashPurge method deletes a post in the trash permanently.
+// It requires authentication and user must be the owner of the post or an admin.
+func (handler Handler) handleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	post, ok := handler.trashedPost(w, r)
+	if !ok {
+		return
+	}
+
+	db := handler.posts(r.Context())
+
+	if err := db.Purge(post.ID); err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// trashedPost finds the deleted post in the url and checks
+// the requester can manage it. It writes the error response
+// and returns false if the request can not go on.
+func (handler Handler) trashedPost(w http.ResponseWriter, r *http.Request) (models.Post, bool) {
+	uid, err := handler.Tokens.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
+		return models.Post{}, false
+	}
+
+	id := mux.Vars(r)["id"]
+	pid, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return models.Post{}, false
+	}
+
+	db := handler.posts(r.Context())
+
+	post, err := db.FindTrashedById(uint(pid))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			responses.ERROR(w, http.StatusNotFound, errors.New("the post with id "+id+" could not found in the trash"))
+		} else {
+			responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			logError(r, err)
+		}
+		return models.Post{}, false
+	}
+
+	if *post.AuthorID != uid && !handler.isAdmin(r.Context(), uid) {
+		// Others can not know what is in the trash.
+		responses.ERROR(w, http.StatusNotFound, errors.New("the post with id "+id+" could not found in the trash"))
+		return models.Post{}, false
+	}
+
+	return post, true
+}
+
+// isAdmin method checks if the user with given id is an admin.
+func (handler Handler) isAdmin(ctx context.Context, uid uint) bool {
+	db := handler.users(ctx)
+
+	user, err := db.FindById(uid)
+	if err != nil {
+		return false
+	}
+
+	return user.IsAdmin
+}
+
+// purgeTrash method permanently deletes the posts which are
+// in the trash longer than the retention period.
+// It runs once in every interval until ctx is done.
+func (handler *Handler) purgeTrash(ctx context.Context, retention time.Duration, interval time.Duration) {
+	db := repository.NewPostRepository(handler.DB)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		count, err := db.PurgeTrashedBefore(time.Now().Add(-retention))
+		if err != nil {
+			logging.Default().Error("purging the trash failed", "error", err, "count", count)
+		} else if count > 0 {
+			logging.Default().Info("posts are purged from the trash", "count", count)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -3,9 +3,10 @@ package controllers
 import (
 	"errors"
 	"github.com/gorilla/mux"
-	"github.com/nebisin/gopress/repository"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"github.com/nebisin/gopress/utils/pagination"
 	"github.com/nebisin/gopress/utils/responses"
-	"log"
 	"net/http"
 	"strconv"
 )
@@ -20,15 +21,21 @@ func (handler Handler) handleUserGet(w http.ResponseWriter, r *http.Request)  {
 		return
 	}
 
-	db := repository.NewUserRepository(handler.DB)
+	db := handler.users(r.Context())
 
-	post, err := db.FindById(uint(i))
+	fields := fieldset.FromRequest(r)
+
+	user, err := db.FindByIdWithFields(uint(i), fields)
 	if err != nil {
+		if errors.Is(err, fieldset.ErrUnknownField) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
 		responses.ERROR(w, http.StatusNotFound, err)
 		return
 	}
 
-	responses.JSON(w, http.StatusOK, post)
+	writeUser(w, r, user, fields)
 }
 
 func (handler Handler) handleUserPostsGet(w http.ResponseWriter, r *http.Request) {
@@ -41,14 +48,42 @@ func (handler Handler) handleUserPostsGet(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	db := repository.NewPostRepository(handler.DB)
+	query, err := postQueryFromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	params, err := pagination.FromRequest(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	db := handler.posts(r.Context())
+
+	posts, meta, err := db.FindPostsByUserId(uint(i), query, params)
+	if err != nil {
+		if errors.Is(err, pagination.ErrInvalidCursor) || errors.Is(err, fieldset.ErrUnknownField) {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+		logError(r, err)
+		return
+	}
+
+	handler.writePostPage(w, r, posts, meta, query.Fields)
+}
 
-	posts, err := db.FindPostsByUserId(uint(i))
+// writeUser sends the asked fields of a user.
+func writeUser(w http.ResponseWriter, r *http.Request, user models.User, fields fieldset.Fieldset) {
+	shaped, err := fields.Apply(user)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
-		log.Println(err)
+		logError(r, err)
 		return
 	}
 
-	responses.JSON(w, http.StatusOK, posts)
+	responses.JSON(w, http.StatusOK, shaped)
 }
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// workers runs the jobs of the handler in the background
+// until they are stopped.
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	started int32
+	running int32
+}
+
+func newWorkers() *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, cancel: cancel}
+}
+
+// Go starts a job. The job must return soon after its context is done.
+func (w *workers) Go(job func(ctx context.Context)) {
+	w.wg.Add(1)
+	atomic.AddInt32(&w.started, 1)
+	atomic.AddInt32(&w.running, 1)
+	go func() {
+		defer w.wg.Done()
+		defer atomic.AddInt32(&w.running, -1)
+		job(w.ctx)
+	}()
+}
+
+// Check returns an error if a job is not running.
+func (w *workers) Check() error {
+	if w.ctx.Err() != nil {
+		return errors.New("background jobs are stopped")
+	}
+
+	if running, started := atomic.LoadInt32(&w.running), atomic.LoadInt32(&w.started); running < started {
+		return fmt.Errorf("%d of %d background jobs are not running", started-running, started)
+	}
+	return nil
+}
+
+// Stop tells the jobs to stop and waits for them
+// until they return or ctx is done.
+func (w *workers) Stop(ctx context.Context) error {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,104 @@
+// Package database opens the database the application runs on.
+// SQLite, PostgreSQL and MySQL are supported.
+package database
+
+import (
+	"fmt"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Names of the supported drivers.
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+	MySQL    = "mysql"
+)
+
+// Config is the database to connect to and the settings
+// of the connection pool. Zero values of the pool settings
+// keep the defaults of database/sql.
+type Config struct {
+	Driver string
+	// DSN is the file name for SQLite and the connection
+	// string for PostgreSQL and MySQL.
+	DSN string
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// Open connects to the database and sets up the connection pool.
+func Open(config Config) (*gorm.DB, error) {
+	dialector, err := dialector(config)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if config.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+	if config.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	}
+
+	return db, nil
+}
+
+func dialector(config Config) (gorm.Dialector, error) {
+	switch config.Driver {
+	case "", SQLite:
+		dsn := config.DSN
+		if dsn == "" {
+			dsn = "test.db"
+		}
+		return sqlite.Open(dsn), nil
+	case Postgres:
+		if config.DSN == "" {
+			return nil, fmt.Errorf("a DSN is required for %s", config.Driver)
+		}
+		return postgres.Open(config.DSN), nil
+	case MySQL:
+		if config.DSN == "" {
+			return nil, fmt.Errorf("a DSN is required for %s", config.Driver)
+		}
+
+		// Times can not be read without parseTime
+		// and emojis need the 4 byte encoding.
+		dsn, err := mysqldriver.ParseDSN(config.DSN)
+		if err != nil {
+			return nil, err
+		}
+		dsn.ParseTime = true
+		if dsn.Params == nil {
+			dsn.Params = make(map[string]string)
+		}
+		if _, ok := dsn.Params["charset"]; !ok {
+			dsn.Params["charset"] = "utf8mb4"
+		}
+		return mysql.Open(dsn.FormatDSN()), nil
+	}
+
+	return nil, fmt.Errorf("unknown database driver %s", config.Driver)
+}
@@ -0,0 +1,87 @@
+// Package feeds renders lists of posts as RSS 2.0,
+// Atom and JSON Feed documents.
+package feeds
+
+import (
+	"errors"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// Formats of the feeds and their content types.
+const (
+	RSS  = "rss"
+	Atom = "atom"
+	JSON = "json"
+)
+
+var contentTypes = map[string]string{
+	RSS:  "application/rss+xml; charset=utf-8",
+	Atom: "application/atom+xml; charset=utf-8",
+	JSON: "application/feed+json; charset=utf-8",
+}
+
+var ErrUnknownFormat = errors.New("unknown feed format")
+
+// Feed is a format independent feed.
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the page the feed belongs to
+	// and URL is the address of the feed itself.
+	Link    string
+	URL     string
+	Updated time.Time
+	Items   []Item
+}
+
+// Item is one post of a feed.
+type Item struct {
+	ID        string
+	Title     string
+	Link      string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+	// Content is HTML, either the full post or its excerpt.
+	Content string
+	Tags    []string
+}
+
+// ContentType returns the content type of given format.
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Write renders the feed in given format.
+func Write(w io.Writer, format string, feed Feed) error {
+	switch format {
+	case RSS:
+		return writeRSS(w, feed)
+	case Atom:
+		return writeAtom(w, feed)
+	case JSON:
+		return writeJSON(w, feed)
+	}
+
+	return ErrUnknownFormat
+}
+
+// TextToHTML turns the plain text of a post into HTML paragraphs.
+// Blank lines separate paragraphs and single line breaks are kept.
+func TextToHTML(text string) string {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,158 @@
+// Package httpcache keeps rendered responses in memory so public
+// reads are served without querying the database. Entries are tagged
+// with what they are made of and dropped when one of their tags is
+// invalidated, when they expire or when the cache is full.
+package httpcache
+
+import (
+	"github.com/nebisin/gopress/utils/lru"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Entry is a rendered response.
+type Entry struct {
+	Status int
+	Header http.Header
+	Body   []byte
+
+	tags    []string
+	expires time.Time
+}
+
+// Cache is a least recently used cache of responses. A nil cache
+// is valid and never has any entry.
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries *lru.LRU
+	// tags are the keys of the entries by their tags.
+	tags map[string]map[string]bool
+	// version is increased by every invalidation.
+	version uint64
+}
+
+// New returns a cache holding up to size entries for ttl each.
+// It returns nil if size is zero, turning the cache off.
+func New(size int, ttl time.Duration) *Cache {
+	if size <= 0 {
+		return nil
+	}
+
+	c := &Cache{size: size, ttl: ttl}
+	c.reset()
+	return c
+}
+
+// Get returns the entry of key if it is not expired.
+// The entry must not be changed.
+func (c *Cache) Get(key string) (*Entry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false
+	}
+	entry := value.(*Entry)
+	if c.ttl > 0 && time.Now().After(entry.expires) {
+		c.entries.Remove(key)
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// Version returns the current version of the cache. It must be read
+// before making a response which is stored with Set.
+func (c *Cache) Version() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.version
+}
+
+// Set stores the entry under key with given tags. The entry is not
+// stored if the cache is invalidated since version, as the response
+// may be made from data which is changed since then. The least
+// recently used entry is dropped when the cache is full.
+func (c *Cache) Set(key string, version uint64, entry *Entry, tags ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if version != c.version {
+		return
+	}
+
+	entry.tags = tags
+	entry.expires = time.Now().Add(c.ttl)
+	// The entry replaced by it is removed with its tags first.
+	c.entries.Remove(key)
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]bool)
+		}
+		c.tags[tag][key] = true
+	}
+	c.entries.Add(key, entry)
+}
+
+// Invalidate drops the entries having any of the tags.
+func (c *Cache) Invalidate(tags ...string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			c.entries.Remove(key)
+		}
+	}
+}
+
+// Purge drops every entry.
+func (c *Cache) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.version++
+	c.reset()
+}
+
+// reset empties the cache.
+func (c *Cache) reset() {
+	c.entries = lru.New(c.size, c.removed)
+	c.tags = make(map[string]map[string]bool)
+}
+
+// removed drops the key of a removed entry from its tags.
+func (c *Cache) removed(key string, value interface{}) {
+	for _, tag := range value.(*Entry).tags {
+		delete(c.tags[tag], key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
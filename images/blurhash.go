@@ -0,0 +1,130 @@
+package images
+
+import (
+	"golang.org/x/image/draw"
+	"image"
+	"math"
+	"strings"
+)
+
+const base83 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes an image into a short string which clients
+// can draw as a blurred placeholder while the image is loading.
+// See https://blurha.sh for the algorithm.
+func Blurhash(img image.Image, xComponents int, yComponents int) string {
+	// A small copy of the image is enough for a few components.
+	small := img
+	if b := img.Bounds(); b.Dx() > 64 || b.Dy() > 64 {
+		w, h := 64, 64
+		if b.Dx() > b.Dy() {
+			h = b.Dy() * 64 / b.Dx()
+		} else {
+			w = b.Dx() * 64 / b.Dy()
+		}
+		if w < 1 {
+			w = 1
+		}
+		if h < 1 {
+			h = 1
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+		small = dst
+	}
+
+	b := small.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	// The image is converted to linear RGB once.
+	pixels := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, bl, _ := small.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			pixels[y*width+x] = [3]float64{sRGBToLinear(r >> 8), sRGBToLinear(g >> 8), sRGBToLinear(bl >> 8)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := normalisation *
+						math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+						math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+					p := pixels[y*width+x]
+					factor[0] += basis * p[0]
+					factor[1] += basis * p[1]
+					factor[2] += basis * p[2]
+				}
+			}
+
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	encode83(&hash, (xComponents-1)+(yComponents-1)*9, 1)
+
+	maximum := 1.0
+	if len(factors) > 1 {
+		actual := 0.0
+		for _, f := range factors[1:] {
+			actual = math.Max(actual, math.Max(math.Abs(f[0]), math.Max(math.Abs(f[1]), math.Abs(f[2]))))
+		}
+		quantised := int(math.Max(0, math.Min(82, math.Floor(actual*166-0.5))))
+		maximum = float64(quantised+1) / 166
+		encode83(&hash, quantised, 1)
+	} else {
+		encode83(&hash, 0, 1)
+	}
+
+	dc := factors[0]
+	encode83(&hash, linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4)
+
+	for _, f := range factors[1:] {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximum, 0.5)*9+9.5))))
+		}
+		encode83(&hash, quant(f[0])*19*19+quant(f[1])*19+quant(f[2]), 2)
+	}
+
+	return hash.String()
+}
+
+func encode83(b *strings.Builder, value int, length int) {
+	for i := 1; i <= length; i++ {
+		digit := value / int(math.Pow(83, float64(length-i))) % 83
+		b.WriteByte(base83[digit])
+	}
+}
+
+func sRGBToLinear(value uint32) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v float64, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
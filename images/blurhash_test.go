@@ -0,0 +1,92 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func uniform(width, height int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// decode83 reads a number written with encode83.
+func decode83(s string) int {
+	value := 0
+	for _, c := range s {
+		value = value*83 + strings.IndexRune(base83, c)
+	}
+	return value
+}
+
+func TestBlurhash(t *testing.T) {
+	tests := []struct {
+		name       string
+		img        image.Image
+		x, y       int
+		size       string
+		components int
+	}{
+		{"one component", uniform(8, 8, color.RGBA{255, 0, 0, 255}), 1, 1, "0", 1},
+		{"wide", uniform(200, 20, color.RGBA{255, 0, 0, 255}), 4, 3, "L", 12},
+		{"tall", uniform(20, 200, color.RGBA{255, 0, 0, 255}), 3, 4, "T", 12},
+		{"most components", uniform(9, 9, color.RGBA{255, 0, 0, 255}), 9, 9, "|", 81},
+	}
+
+	for _, test := range tests {
+		hash := Blurhash(test.img, test.x, test.y)
+		if len(hash) != 6+2*(test.components-1) {
+			t.Errorf("%s: length of %q = %d, want %d", test.name, hash, len(hash), 6+2*(test.components-1))
+			continue
+		}
+		if hash[:1] != test.size {
+			t.Errorf("%s: size flag of %q = %s, want %s", test.name, hash, hash[:1], test.size)
+		}
+		// The average color is kept exactly.
+		if dc := decode83(hash[2:6]); dc != 0xFF0000 {
+			t.Errorf("%s: average color of %q = %06x, want ff0000", test.name, hash, dc)
+		}
+		if strings.Trim(hash, base83) != "" {
+			t.Errorf("%s: %q is not base 83", test.name, hash)
+		}
+	}
+}
+
+func TestBlurhashAverage(t *testing.T) {
+	// Half black and half white averages to the middle of the linear
+	// light, which is 188 in sRGB, whichever way the image is split.
+	split := func(vertical bool) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, 100, 100))
+		for y := 0; y < 100; y++ {
+			for x := 0; x < 100; x++ {
+				c := color.RGBA{0, 0, 0, 255}
+				if vertical && x >= 50 || !vertical && y >= 50 {
+					c = color.RGBA{255, 255, 255, 255}
+				}
+				img.Set(x, y, c)
+			}
+		}
+		return img
+	}
+
+	left, top := Blurhash(split(true), 4, 3), Blurhash(split(false), 4, 3)
+	for _, hash := range []string{left, top} {
+		if dc := decode83(hash[2:6]); dc != 0xBCBCBC {
+			t.Errorf("average color of %q = %06x, want bcbcbc", hash, dc)
+		}
+		// The contrast sets the largest component.
+		if hash[1] == '0' {
+			t.Errorf("%q has no contrast", hash)
+		}
+	}
+	if left == top {
+		t.Errorf("the hashes of the images split both ways are the same: %q", left)
+	}
+}
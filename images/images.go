@@ -0,0 +1,224 @@
+// Package images makes the resized variants of uploaded images
+// and strips the metadata of them.
+//
+// JPEG, PNG, GIF and WebP images can be read. Variants are written
+// as JPEG or as PNG if they have transparency, since WebP can not
+// be encoded without cgo.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxPixels is the largest image in pixels which is decoded.
+// Larger ones would take too much memory.
+const MaxPixels = 50000000
+
+var ErrTooLarge = errors.New("the image is too large")
+
+// Decodable reports if images of given type can be processed.
+func Decodable(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+
+	return false
+}
+
+// Variant is a size images are resized to.
+// If Height is zero images are resized to the width keeping their
+// aspect ratio, otherwise they are cropped to exactly the size.
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// ParseVariants parses a list of variants like "thumbnail:150x150,small:480".
+func ParseVariants(s string) ([]Variant, error) {
+	variants := make([]Variant, 0)
+	if strings.TrimSpace(s) == "" {
+		return variants, nil
+	}
+
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("variant %q must look like name:width or name:widthxheight", item)
+		}
+
+		v := Variant{Name: parts[0]}
+		size := strings.SplitN(parts[1], "x", 2)
+
+		var err error
+		if v.Width, err = strconv.Atoi(size[0]); err != nil || v.Width < 1 {
+			return nil, fmt.Errorf("variant %s has an invalid width", v.Name)
+		}
+		if len(size) == 2 {
+			if v.Height, err = strconv.Atoi(size[1]); err != nil || v.Height < 1 {
+				return nil, fmt.Errorf("variant %s has an invalid height", v.Name)
+			}
+		}
+
+		if seen[v.Name] {
+			return nil, fmt.Errorf("variant %s is given twice", v.Name)
+		}
+		seen[v.Name] = true
+		variants = append(variants, v)
+	}
+
+	return variants, nil
+}
+
+// Decode reads an image turning it upright by the orientation
+// in its metadata. Only the first frame of animations is read.
+func Decode(data []byte) (image.Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	var img image.Image
+	switch format {
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(data))
+	default:
+		img, _, err = image.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "jpeg" {
+		img = orient(img, Orientation(data))
+	}
+
+	return img, nil
+}
+
+// Resize makes the variant of an image. Images are never scaled up,
+// it returns false if the image is too small for the variant.
+func Resize(img image.Image, v Variant) (image.Image, bool) {
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+
+	if v.Height == 0 {
+		if w <= v.Width {
+			return nil, false
+		}
+
+		height := h * v.Width / w
+		if height < 1 {
+			height = 1
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, v.Width, height))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, src, draw.Src, nil)
+		return dst, true
+	}
+
+	if w < v.Width || h < v.Height {
+		return nil, false
+	}
+
+	// The largest part of the image with the aspect
+	// ratio of the variant is taken from the center.
+	crop := src
+	if w*v.Height > h*v.Width {
+		cw := h * v.Width / v.Height
+		crop.Min.X += (w - cw) / 2
+		crop.Max.X = crop.Min.X + cw
+	} else {
+		ch := w * v.Height / v.Width
+		crop.Min.Y += (h - ch) / 2
+		crop.Max.Y = crop.Min.Y + ch
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, v.Width, v.Height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst, true
+}
+
+// Encode writes an image as JPEG or as PNG if it has
+// transparency and returns the type it is written as.
+func Encode(w io.Writer, img image.Image) (string, error) {
+	if opaque(img) {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+
+	return "image/png", png.Encode(w, img)
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// orient turns an image by an EXIF orientation. Orientations 5 to 8
+// swap the width and the height of the image.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	if orientation >= 5 {
+		dst = image.NewNRGBA(image.Rect(0, 0, h, w))
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored and rotated 270
+				dx, dy = y, x
+			case 6: // rotated 90
+				dx, dy = h-1-y, x
+			case 7: // mirrored and rotated 90
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 270
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, color.NRGBAModel.Convert(img.At(src.Min.X+x, src.Min.Y+y)))
+		}
+	}
+
+	return dst
+}
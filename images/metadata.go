@@ -0,0 +1,338 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("the image is malformed")
+
+// Strip removes the metadata which may reveal personal information,
+// like the location a photo is taken at, from an image. Images are
+// not decoded so they do not lose any quality. Only the orientation
+// of JPEG images is kept since they are displayed wrong without it.
+func Strip(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	case "image/gif":
+		return stripGIF(data)
+	}
+
+	return data, nil
+}
+
+// Orientation returns the EXIF orientation of a JPEG image.
+// It is 1, upright, if the image does not have one.
+func Orientation(data []byte) int {
+	orientation := 1
+	walkJPEG(data, func(marker byte, segment []byte) bool {
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			if o := exifOrientation(segment[6:]); o != 0 {
+				orientation = o
+			}
+			return false
+		}
+		return true
+	})
+
+	return orientation
+}
+
+// walkJPEG calls fn with the marker and the payload of every segment
+// of a JPEG image before the image data. It stops if fn returns false.
+// It returns the offset the image data starts at.
+func walkJPEG(data []byte, fn func(marker byte, segment []byte) bool) (int, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, errMalformed
+	}
+
+	i := 2
+	for {
+		if i+4 > len(data) || data[i] != 0xFF {
+			return 0, errMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xFF {
+			// fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA {
+			// start of scan, the image data follows
+			return i, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 0, errMalformed
+		}
+		if !fn(marker, data[i+4:i+2+length]) {
+			return i, nil
+		}
+		i += 2 + length
+	}
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	orientation := Orientation(data)
+
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+	wroteExif := false
+
+	start, err := walkJPEG(data, func(marker byte, segment []byte) bool {
+		// APP0 (JFIF) must stay first, the orientation goes after it.
+		if marker != 0xE0 && !wroteExif {
+			if orientation != 1 {
+				out = appendSegment(out, 0xE1, orientationExif(orientation))
+			}
+			wroteExif = true
+		}
+
+		switch {
+		case marker == 0xE0, marker == 0xE2, marker == 0xEE:
+			// JFIF, ICC profile and Adobe color transform are
+			// needed to display the image with the right colors.
+		case marker >= 0xE1 && marker <= 0xEF, marker == 0xFE:
+			// Other application segments have EXIF, XMP, IPTC and
+			// maker notes and COM has free text comments.
+			return true
+		}
+
+		out = appendSegment(out, marker, segment)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(out, data[start:]...), nil
+}
+
+func appendSegment(out []byte, marker byte, segment []byte) []byte {
+	out = append(out, 0xFF, marker, 0, 0)
+	binary.BigEndian.PutUint16(out[len(out)-2:], uint16(len(segment)+2))
+	return append(out, segment...)
+}
+
+// exifOrientation reads the orientation tag from the first IFD
+// of the TIFF structure in an EXIF segment.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// 0x0112 is the orientation, a single SHORT value.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+
+	return 0
+}
+
+// orientationExif makes an EXIF segment which only has the orientation.
+func orientationExif(orientation int) []byte {
+	segment := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08")
+	segment = append(segment, 0, 1)                         // one entry
+	segment = append(segment, 0x01, 0x12, 0, 3, 0, 0, 0, 1) // orientation, SHORT, count 1
+	segment = append(segment, 0, byte(orientation), 0, 0)   // value
+	return append(segment, 0, 0, 0, 0)                      // no next IFD
+}
+
+// pngMetadata are the chunks which have text, EXIF and the modification time.
+var pngMetadata = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if len(data) < 8 || string(data[:8]) != "\x89PNG\r\n\x1a\n" {
+		return nil, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:8]...)
+
+	for i := 8; i < len(data); {
+		if i+12 > len(data) {
+			return nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+
+		if !pngMetadata[string(data[i+4:i+8])] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	return out, nil
+}
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size%2
+		if size < 0 || i+8+size > len(data) {
+			return nil, errMalformed
+		}
+		if end > len(data) {
+			end = len(data)
+		}
+
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				// clear the EXIF and XMP flags
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// gifKeptApplications are the application extensions which change how
+// a GIF is displayed, the loop count of animations and the ICC profile.
+// Others, like XMP, are metadata.
+var gifKeptApplications = map[string]bool{"NETSCAPE2.0": true, "ANIMEXTS1.0": true, "ICCRGBG1012": true}
+
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, errMalformed
+	}
+
+	// The header and the logical screen descriptor
+	// with the global color table if there is one.
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, errMalformed
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+
+	for i < len(data) {
+		start := i
+		switch data[i] {
+		case 0x3B:
+			// The trailer, anything after it is dropped.
+			return append(out, 0x3B), nil
+		case 0x2C:
+			// An image descriptor with its local color table
+			// and the image data after the LZW code size.
+			if i+10 > len(data) {
+				return nil, errMalformed
+			}
+			i += 10
+			if flags := data[i-1]; flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			end, err := skipGIFSubBlocks(data, i+1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, data[start:end]...)
+			i = end
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, errMalformed
+			}
+			label := data[i+1]
+			end, err := skipGIFSubBlocks(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case label == 0xFE:
+				// Comments are free text.
+			case label == 0xFF && !gifKeptApplications[gifApplication(data[i+2:end])]:
+			default:
+				// Graphic control and plain text extensions
+				// are a part of the image.
+				out = append(out, data[start:end]...)
+			}
+			i = end
+		default:
+			return nil, errMalformed
+		}
+	}
+
+	// Some encoders leave the trailer out.
+	return append(out, 0x3B), nil
+}
+
+// skipGIFSubBlocks returns the offset after the sub-blocks starting at i,
+// which end with an empty one.
+func skipGIFSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, errMalformed
+		}
+		size := int(data[i])
+		i++
+		if size == 0 {
+			return i, nil
+		}
+		i += size
+	}
+}
+
+// gifApplication returns the identifier and the authentication code
+// in the first sub-block of an application extension.
+func gifApplication(blocks []byte) string {
+	if len(blocks) < 12 || blocks[0] != 11 {
+		return ""
+	}
+	return string(blocks[1:12])
+}
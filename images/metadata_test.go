@@ -0,0 +1,365 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"golang.org/x/image/webp"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// secret is in every piece of metadata of the fixtures,
+// none of it may be left after they are stripped.
+var secret = []byte("secret")
+
+// testImage is a 4x2 image with a different color in every pixel.
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 60), uint8(y * 200), 100, 255})
+		}
+	}
+	return img
+}
+
+func uint16Bytes(order binary.ByteOrder, v uint16) []byte {
+	b := make([]byte, 2)
+	order.PutUint16(b, v)
+	return b
+}
+
+func uint32Bytes(order binary.ByteOrder, v uint32) []byte {
+	b := make([]byte, 4)
+	order.PutUint32(b, v)
+	return b
+}
+
+// exifTIFF makes the TIFF structure of an EXIF segment with a camera
+// make, a GPS position and the orientation unless it is zero.
+func exifTIFF(order binary.ByteOrder, orientation int) []byte {
+	entries := 2
+	if orientation != 0 {
+		entries++
+	}
+	data := 8 + 2 + entries*12 + 4
+
+	tiff := []byte("MM\x00\x2a")
+	if order == binary.LittleEndian {
+		tiff = []byte("II\x2a\x00")
+	}
+	tiff = append(tiff, uint32Bytes(order, 8)...)
+	tiff = append(tiff, uint16Bytes(order, uint16(entries))...)
+
+	entry := func(tag, kind uint16, count uint32, value []byte) {
+		tiff = append(tiff, uint16Bytes(order, tag)...)
+		tiff = append(tiff, uint16Bytes(order, kind)...)
+		tiff = append(tiff, uint32Bytes(order, count)...)
+		tiff = append(tiff, value...)
+	}
+	// make, ASCII at the offset of the data
+	entry(0x010F, 2, 7, uint32Bytes(order, uint32(data)))
+	if orientation != 0 {
+		// orientation, SHORT padded to four bytes
+		entry(0x0112, 3, 1, append(uint16Bytes(order, uint16(orientation)), 0, 0))
+	}
+	// GPS IFD pointer, LONG
+	entry(0x8825, 4, 1, uint32Bytes(order, uint32(data+7)))
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	tiff = append(tiff, "secret\x00"...)
+	return append(tiff, "secret GPS position"...)
+}
+
+func jpegSegment(marker byte, payload string) []byte {
+	return appendSegment(nil, marker, []byte(payload))
+}
+
+// jpegFixture makes a JPEG image with an EXIF segment, if exif is not
+// empty, and with XMP, IPTC and a comment between JFIF and the ICC profile.
+func jpegFixture(t *testing.T, exif []byte) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte{0xFF, 0xD8}
+	data = append(data, jpegSegment(0xE0, "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")...)
+	if exif != nil {
+		data = append(data, jpegSegment(0xE1, "Exif\x00\x00"+string(exif))...)
+	}
+	data = append(data, jpegSegment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>secret</x:xmpmeta>")...)
+	data = append(data, jpegSegment(0xED, "Photoshop 3.0\x008BIMsecret")...)
+	data = append(data, jpegSegment(0xFE, "a secret comment")...)
+	data = append(data, jpegSegment(0xE2, "ICC_PROFILE\x00\x01\x01profile")...)
+	return append(data, encoded.Bytes()[2:]...)
+}
+
+func TestStripJPEG(t *testing.T) {
+	tests := []struct {
+		name        string
+		exif        []byte
+		orientation int
+	}{
+		{"no EXIF", nil, 1},
+		{"no orientation", exifTIFF(binary.BigEndian, 0), 1},
+		{"upright", exifTIFF(binary.BigEndian, 1), 1},
+		{"big endian", exifTIFF(binary.BigEndian, 6), 6},
+		{"little endian", exifTIFF(binary.LittleEndian, 8), 8},
+		{"mirrored", exifTIFF(binary.LittleEndian, 2), 2},
+		{"invalid orientation", exifTIFF(binary.BigEndian, 9), 1},
+	}
+
+	for _, test := range tests {
+		data := jpegFixture(t, test.exif)
+		if got := Orientation(data); got != test.orientation {
+			t.Errorf("%s: orientation of the fixture = %d, want %d", test.name, got, test.orientation)
+		}
+
+		out, err := Strip(data, "image/jpeg")
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if bytes.Contains(out, secret) {
+			t.Errorf("%s: metadata is left after stripping", test.name)
+		}
+		if got := Orientation(out); got != test.orientation {
+			t.Errorf("%s: orientation = %d, want %d", test.name, got, test.orientation)
+		}
+		if !bytes.HasPrefix(out, []byte{0xFF, 0xD8, 0xFF, 0xE0}) {
+			t.Errorf("%s: JFIF is not the first segment", test.name)
+		}
+		if !bytes.Contains(out, []byte("ICC_PROFILE")) {
+			t.Errorf("%s: the color profile is removed", test.name)
+		}
+
+		if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+			t.Errorf("%s: the stripped image does not decode: %v", test.name, err)
+		}
+		img, err := Decode(out)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		// Orientations from 5 on turn the image sideways.
+		want := image.Point{4, 2}
+		if test.orientation >= 5 {
+			want = image.Point{2, 4}
+		}
+		if size := img.Bounds().Size(); size != want {
+			t.Errorf("%s: size of the decoded image = %v, want %v", test.name, size, want)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	valid := exifTIFF(binary.BigEndian, 3)
+	long := exifTIFF(binary.BigEndian, 3)
+	// The orientation as a LONG is not valid.
+	long[8+2+12+3] = 4
+
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"valid", valid, 3},
+		{"empty", nil, 0},
+		{"short header", valid[:7], 0},
+		{"byte order", append([]byte("XX"), valid[2:]...), 0},
+		{"IFD offset past the end", append(valid[:4:4], 0, 0, 0xFF, 0xFF), 0},
+		{"IFD offset in the header", append(append(valid[:4:4], 0, 0, 0, 4), valid[8:]...), 0},
+		{"entries past the end", valid[:8+2+12], 0},
+		{"wrong type", long, 0},
+	}
+
+	for _, test := range tests {
+		if got := exifOrientation(test.tiff); got != test.want {
+			t.Errorf("%s: orientation = %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func pngChunk(kind string, data string) []byte {
+	chunk := uint32Bytes(binary.BigEndian, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	return append(chunk, uint32Bytes(binary.BigEndian, crc32.ChecksumIEEE(chunk[4:]))...)
+}
+
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata goes after the signature and IHDR.
+	header := encoded.Bytes()[:8+25]
+	data := append([]byte(nil), header...)
+	data = append(data, pngChunk("gAMA", "\x00\x00\xb1\x8f")...)
+	data = append(data, pngChunk("tEXt", "Comment\x00secret")...)
+	data = append(data, pngChunk("zTXt", "Author\x00\x00secret")...)
+	data = append(data, pngChunk("iTXt", "XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta>secret</x:xmpmeta>")...)
+	data = append(data, pngChunk("eXIf", string(exifTIFF(binary.BigEndian, 6)))...)
+	data = append(data, pngChunk("tIME", "\x07\xe5\x05\x01\x0a\x00\x00")...)
+	data = append(data, encoded.Bytes()[len(header):]...)
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("the fixture does not decode: %v", err)
+	}
+
+	out, err := Strip(data, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, secret) || bytes.Contains(out, []byte("tIME")) {
+		t.Error("metadata is left after stripping")
+	}
+	if !bytes.Contains(out, []byte("gAMA")) {
+		t.Error("the gamma is removed")
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("the stripped image does not decode: %v", err)
+	}
+}
+
+func riffChunk(kind string, data string) []byte {
+	chunk := append([]byte(kind), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// lossless1x1 is the VP8L bitstream of a 1x1 image.
+const lossless1x1 = "\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07"
+
+func TestStripWebP(t *testing.T) {
+	// The extended format with the EXIF and XMP flags and a 1x1 canvas.
+	var body []byte
+	body = append(body, "WEBP"...)
+	body = append(body, riffChunk("VP8X", "\x0c\x00\x00\x00\x00\x00\x00\x00\x00\x00")...)
+	body = append(body, riffChunk("VP8L", lossless1x1)...)
+	// The chunk has an odd size so it is padded.
+	body = append(body, riffChunk("EXIF", string(exifTIFF(binary.LittleEndian, 6))+"!")...)
+	body = append(body, riffChunk("XMP ", "<x:xmpmeta>secret</x:xmpmeta>")...)
+	data := append(riffChunk("RIFF", "")[:8], body...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(body)))
+	if _, err := webp.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("the fixture does not decode: %v", err)
+	}
+
+	out, err := Strip(data, "image/webp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, secret) || bytes.Contains(out, []byte("EXIF")) || bytes.Contains(out, []byte("XMP ")) {
+		t.Error("metadata is left after stripping")
+	}
+	if size := binary.LittleEndian.Uint32(out[4:]); int(size) != len(out)-8 {
+		t.Errorf("RIFF size = %d, want %d", size, len(out)-8)
+	}
+	if flags := out[20]; flags&0x0c != 0 {
+		t.Errorf("VP8X flags = %#x, want no EXIF and XMP", flags)
+	}
+	if _, err := webp.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("the stripped image does not decode: %v", err)
+	}
+}
+
+func TestStripGIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	frame := func(c uint8) *image.Paletted {
+		img := image.NewPaletted(image.Rect(0, 0, 4, 2), palette)
+		for i := range img.Pix {
+			img.Pix[i] = c
+		}
+		return img
+	}
+
+	var encoded bytes.Buffer
+	animation := &gif.GIF{Image: []*image.Paletted{frame(0), frame(1)}, Delay: []int{10, 10}, LoopCount: 3}
+	if err := gif.EncodeAll(&encoded, animation); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metadata goes after the header and the global color table.
+	header := 13
+	if flags := encoded.Bytes()[10]; flags&0x80 != 0 {
+		header += 3 << (flags&0x07 + 1)
+	}
+	data := append([]byte(nil), encoded.Bytes()[:header]...)
+	data = append(data, "\x21\xfe\x10a secret comment\x00"...)
+	data = append(data, "\x21\xff\x0bXMP DataXMP\x06secret\x01>\x00"...)
+	data = append(data, encoded.Bytes()[header:]...)
+	data = append(data, "secret after the trailer"...)
+	if _, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+		t.Fatalf("the fixture does not decode: %v", err)
+	}
+
+	out, err := Strip(data, "image/gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(out, secret) || bytes.Contains(out, []byte("XMP")) {
+		t.Error("metadata is left after stripping")
+	}
+
+	stripped, err := gif.DecodeAll(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("the stripped image does not decode: %v", err)
+	}
+	if len(stripped.Image) != 2 || stripped.LoopCount != 3 {
+		t.Errorf("stripped animation has %d frames looping %d times, want 2 and 3", len(stripped.Image), stripped.LoopCount)
+	}
+}
+
+func TestStripMalformed(t *testing.T) {
+	jpegData := jpegFixture(t, exifTIFF(binary.BigEndian, 6))
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, testImage()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		contentType string
+		data        []byte
+	}{
+		{"image/jpeg", nil},
+		{"image/jpeg", []byte("not a jpeg")},
+		{"image/jpeg", jpegData[:30]},
+		{"image/jpeg", append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01}, jpegData[2:]...)},
+		{"image/png", []byte("\x89PNG\r\n\x1a")},
+		{"image/png", pngData.Bytes()[:40]},
+		{"image/png", append(append([]byte(nil), pngData.Bytes()[:8]...), 0xFF, 0xFF, 0xFF, 0xFF, 'I', 'D', 'A', 'T', 0, 0, 0, 0)},
+		{"image/webp", []byte("RIFF\x00\x00\x00\x00WEBP")[:11]},
+		{"image/webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8L\xff\x00\x00\x00\x00")},
+		{"image/webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8")},
+		{"image/gif", []byte("GIF89a")},
+		{"image/gif", []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00")},
+		{"image/gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x2c\x00\x00")},
+		{"image/gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x21\xfe\x05ab")},
+		{"image/gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00\x99")},
+	}
+
+	for _, test := range tests {
+		if _, err := Strip(test.data, test.contentType); err != errMalformed {
+			t.Errorf("Strip(%q, %s): error %v, want %v", test.data, test.contentType, err, errMalformed)
+		}
+	}
+
+	// Other types are left as they are.
+	data := []byte("%PDF-1.4 secret")
+	if out, err := Strip(data, "application/pdf"); err != nil || !bytes.Equal(out, data) {
+		t.Errorf("Strip of a PDF = %q, %v", out, err)
+	}
+}
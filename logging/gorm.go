@@ -0,0 +1,81 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"regexp"
+	"time"
+)
+
+// passwordHash matches bcrypt hashes, which are written
+// into the logged SQL of queries on users.
+var passwordHash = regexp.MustCompile(`\$2[aby]?\$\d\d\$[./A-Za-z0-9]{53}`)
+
+// GormLogger writes the logs of GORM with the logger in the context
+// of the query, so they have the id of the request which made them.
+// Failed queries are errors and slow ones warnings. Every query
+// is logged at the debug level.
+type GormLogger struct {
+	// SlowThreshold is how long a query can take before it is slow.
+	SlowThreshold time.Duration
+	// silent turns off the logs, as LogMode(logger.Silent) does.
+	silent bool
+}
+
+// LogMode only tells whether to log or not, the level
+// of the logger is used for the rest.
+func (g GormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	g.silent = level == logger.Silent
+	return g
+}
+
+func (g GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if !g.silent {
+		FromContext(ctx).Info(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (g GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if !g.silent {
+		FromContext(ctx).Warn(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (g GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if !g.silent {
+		FromContext(ctx).Error(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace logs a query once it is run.
+func (g GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if g.silent {
+		return
+	}
+
+	l := FromContext(ctx)
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.Error("query failed", "error", err, "sql", redactSQL(sql), "rows", rows, "duration_ms", milliseconds(elapsed))
+	case g.SlowThreshold > 0 && elapsed > g.SlowThreshold:
+		sql, rows := fc()
+		l.Warn("slow query", "sql", redactSQL(sql), "rows", rows, "duration_ms", milliseconds(elapsed))
+	case l.Enabled(LevelDebug):
+		sql, rows := fc()
+		l.Debug("query", "sql", redactSQL(sql), "rows", rows, "duration_ms", milliseconds(elapsed))
+	}
+}
+
+func redactSQL(sql string) string {
+	return passwordHash.ReplaceAllString(sql, "[REDACTED]")
+}
+
+// milliseconds returns d in milliseconds with a precision of microseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,192 @@
+// Package logging writes leveled logs as JSON lines, one object per
+// entry. Loggers carry attributes, like the id of a request, which are
+// added to each of their entries and are passed around in contexts.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the importance of an entry.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel reads a level like info or ERROR.
+func ParseLevel(text string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(text, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not debug, info, warn or error", text)
+}
+
+// output is the writer shared by a logger and the loggers made from it.
+type output struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+}
+
+// Logger writes entries at or above its level. Entries have the time,
+// the level, the message and then the attributes of the logger and
+// of the call, which are given as key and value pairs.
+type Logger struct {
+	out   *output
+	attrs []interface{}
+}
+
+// New returns a logger writing the entries of level and above to w.
+func New(w io.Writer, level Level) *Logger {
+	return &Logger{out: &output{w: w, level: level}}
+}
+
+// With returns a logger adding the key and value pairs to every entry.
+func (l *Logger) With(args ...interface{}) *Logger {
+	attrs := make([]interface{}, 0, len(l.attrs)+len(args))
+	attrs = append(attrs, l.attrs...)
+	attrs = append(attrs, args...)
+	return &Logger{out: l.out, attrs: attrs}
+}
+
+// Enabled tells if entries of level are written.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.out.level
+}
+
+func (l *Logger) Debug(msg string, args ...interface{}) { l.Log(LevelDebug, msg, args...) }
+func (l *Logger) Info(msg string, args ...interface{})  { l.Log(LevelInfo, msg, args...) }
+func (l *Logger) Warn(msg string, args ...interface{})  { l.Log(LevelWarn, msg, args...) }
+func (l *Logger) Error(msg string, args ...interface{}) { l.Log(LevelError, msg, args...) }
+
+// Log writes an entry if level is enabled.
+func (l *Logger) Log(level Level, msg string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeValue(&b, time.Now().UTC().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeValue(&b, level.String())
+	b.WriteString(`,"msg":`)
+	writeValue(&b, msg)
+	writeAttrs(&b, l.attrs)
+	writeAttrs(&b, args)
+	b.WriteString("}\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	_, _ = l.out.w.Write(b.Bytes())
+}
+
+func writeAttrs(b *bytes.Buffer, args []interface{}) {
+	for i := 0; i < len(args); i += 2 {
+		key := fmt.Sprint(args[i])
+		if i+1 == len(args) {
+			// A key without a value is kept instead of dropped
+			// so the mistake can be seen in the logs.
+			writeAttr(b, "!BADKEY", key)
+			return
+		}
+		writeAttr(b, key, args[i+1])
+	}
+}
+
+func writeAttr(b *bytes.Buffer, key string, value interface{}) {
+	b.WriteByte(',')
+	writeValue(b, key)
+	b.WriteByte(':')
+	writeValue(b, value)
+}
+
+// writeValue writes value as JSON. Errors and durations are
+// written as text, and values which are not valid JSON are
+// written like fmt.Print does.
+func writeValue(b *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(data)
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = New(os.Stderr, LevelInfo)
+)
+
+// Default returns the logger of the program.
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// SetDefault makes l the logger of the program. The standard
+// log package writes through it too, at the info level.
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defaultLogger = l
+	defaultMu.Unlock()
+
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{l})
+}
+
+// stdWriter turns the lines of the standard logger into entries.
+type stdWriter struct {
+	logger *Logger
+}
+
+func (w stdWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying l.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger in ctx or the default one.
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return l
+	}
+	return Default()
+}
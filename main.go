@@ -1,13 +1,10 @@
 package main
 
 import (
-	"github.com/nebisin/gopress/controllers"
+	"github.com/nebisin/gopress/cli"
+	"os"
 )
 
-var handler = controllers.Handler{}
-
 func main() {
-	handler.Initialize()
-
-	handler.Run(":8080")
+	os.Exit(cli.Run(os.Args[1:]))
 }
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	queryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Time to run database queries.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	queryErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Database queries which failed, not counting missing records.",
+	}, []string{"operation", "table"})
+)
+
+const startKey = "metrics:start"
+
+// GormPlugin times every query and counts the failed ones.
+// It is added with db.Use(metrics.GormPlugin{}).
+type GormPlugin struct{}
+
+// Name is the name of the plugin for GORM.
+func (GormPlugin) Name() string {
+	return "gopress:metrics"
+}
+
+// Initialize registers the callbacks of the plugin. The timer starts
+// before the other callbacks and stops after all of them.
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	errs := []error{
+		callback.Create().Before("*").Register("metrics:before_create", start),
+		callback.Create().After("*").Register("metrics:after_create", observe("create")),
+		callback.Query().Before("*").Register("metrics:before_query", start),
+		callback.Query().After("*").Register("metrics:after_query", observe("query")),
+		callback.Update().Before("*").Register("metrics:before_update", start),
+		callback.Update().After("*").Register("metrics:after_update", observe("update")),
+		callback.Delete().Before("*").Register("metrics:before_delete", start),
+		callback.Delete().After("*").Register("metrics:after_delete", observe("delete")),
+		callback.Row().Before("*").Register("metrics:before_row", start),
+		callback.Row().After("*").Register("metrics:after_row", observe("row")),
+		callback.Raw().Before("*").Register("metrics:before_raw", start),
+		callback.Raw().After("*").Register("metrics:after_raw", observe("raw")),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// observe records the query when its callbacks are done.
+func observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "none"
+		}
+
+		queryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			queryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
@@ -0,0 +1,89 @@
+// Package metrics collects the Prometheus metrics of gopress.
+// They are served by Handler, usually as /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "gopress"
+
+// Registry holds every metric of gopress together with
+// the metrics of the Go runtime and the process.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+var (
+	// HTTPRequests counts the handled requests by their method,
+	// route template and status.
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Handled HTTP requests.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration is how long the requests take to be handled.
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to handle HTTP requests.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+var (
+	// Registrations counts the users who signed up.
+	Registrations = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "registrations_total",
+		Help:      "Users who registered.",
+	})
+
+	// Logins counts the successful logins.
+	Logins = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logins_total",
+		Help:      "Successful logins.",
+	})
+
+	// FailedLogins counts the rejected logins by the reason,
+	// which is credentials or locked.
+	FailedLogins = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_logins_total",
+		Help:      "Rejected logins.",
+	}, []string{"reason"})
+
+	// PostsPublished counts the posts published for the first time.
+	PostsPublished = factory.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_published_total",
+		Help:      "Posts published for the first time.",
+	})
+)
+
+var (
+	// CacheLookups counts the reads of the cache by the kind
+	// of the value, post or user, and the result, hit or miss.
+	CacheLookups = factory.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_lookups_total",
+		Help:      "Reads of the cache of the repositories.",
+	}, []string{"kind", "result"})
+)
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
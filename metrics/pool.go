@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// poolCollector reads the statistics of a connection pool
+// every time the metrics are gathered.
+type poolCollector struct {
+	db *sql.DB
+
+	maxOpen     *prometheus.Desc
+	connections *prometheus.Desc
+	waitCount   *prometheus.Desc
+	waitSeconds *prometheus.Desc
+	closed      *prometheus.Desc
+}
+
+// RegisterPool adds the gauges of the connection pool of db.
+func RegisterPool(db *sql.DB) error {
+	name := func(name string) string {
+		return prometheus.BuildFQName(namespace, "db", name)
+	}
+
+	return Registry.Register(&poolCollector{
+		db: db,
+		maxOpen: prometheus.NewDesc(name("max_open_connections"),
+			"Most connections open at once, 0 is unlimited.", nil, nil),
+		connections: prometheus.NewDesc(name("connections"),
+			"Open connections by their state.", []string{"state"}, nil),
+		waitCount: prometheus.NewDesc(name("wait_count_total"),
+			"Times a query waited for a connection.", nil, nil),
+		waitSeconds: prometheus.NewDesc(name("wait_duration_seconds_total"),
+			"Time spent waiting for a connection.", nil, nil),
+		closed: prometheus.NewDesc(name("closed_connections_total"),
+			"Connections closed by the pool by the reason.", []string{"reason"}, nil),
+	})
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.maxOpen
+	ch <- c.connections
+	ch <- c.waitCount
+	ch <- c.waitSeconds
+	ch <- c.closed
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.maxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.InUse), "in_use")
+	ch <- prometheus.MustNewConstMetric(c.connections, prometheus.GaugeValue, float64(stats.Idle), "idle")
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitSeconds, prometheus.CounterValue, stats.WaitDuration.Seconds())
+	ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.MaxIdleClosed), "max_idle")
+	ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.MaxIdleTimeClosed), "max_idle_time")
+	ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.MaxLifetimeClosed), "max_lifetime")
+}
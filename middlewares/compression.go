@@ -0,0 +1,192 @@
+package middlewares
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() interface{} {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}}
+	brotliWriters = sync.Pool{New: func() interface{} {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}}
+)
+
+// SetCompressionMiddleware compresses responses with brotli or gzip,
+// whichever the client prefers in its Accept-Encoding header. Only
+// texts and JSON of at least minSize bytes are compressed, since
+// images and archives are compressed already.
+func SetCompressionMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: minSize, status: http.StatusOK}
+			next.ServeHTTP(cw, r)
+			cw.close()
+		})
+	}
+}
+
+// negotiateEncoding returns br, gzip or nothing from an Accept-Encoding
+// header. The encoding with the higher quality wins and brotli wins
+// the ties since it makes smaller responses.
+func negotiateEncoding(header string) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, quality := part, 1.0
+		if i := strings.Index(part, ";"); i >= 0 {
+			name = part[:i]
+			param := strings.TrimSpace(part[i+1:])
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err != nil {
+					continue
+				}
+				quality = q
+			}
+		}
+
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "*" {
+			name = "br"
+		}
+		if name != "br" && name != "gzip" || quality <= 0 {
+			continue
+		}
+		if quality > bestQuality || quality == bestQuality && name == "br" {
+			best, bestQuality = name, quality
+		}
+	}
+
+	return best
+}
+
+// compressible reports if responses of the content type are worth
+// compressing.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		mediaType == "application/json",
+		mediaType == "application/xml",
+		mediaType == "application/javascript",
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+
+	return false
+}
+
+// compressWriter holds the start of the response back until it knows
+// if the response is large enough to be compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minSize  int
+
+	status  int
+	buf     []byte
+	started bool
+	encoder io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if !cw.started {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.started {
+		if cw.encoder != nil {
+			return cw.encoder.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start sends the headers and the body held back so far.
+func (cw *compressWriter) start() error {
+	cw.started = true
+
+	h := cw.Header()
+	bodyAllowed := cw.status != http.StatusNoContent && cw.status != http.StatusNotModified
+	if bodyAllowed && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Add("Vary", "Accept-Encoding")
+		if len(cw.buf) >= cw.minSize {
+			h.Set("Content-Encoding", cw.encoding)
+			h.Del("Content-Length")
+			cw.encoder = cw.newEncoder()
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+func (cw *compressWriter) newEncoder() io.WriteCloser {
+	if cw.encoding == "br" {
+		w := brotliWriters.Get().(*brotli.Writer)
+		w.Reset(cw.ResponseWriter)
+		return w
+	}
+
+	w := gzipWriters.Get().(*gzip.Writer)
+	w.Reset(cw.ResponseWriter)
+	return w
+}
+
+// close finishes the response once the handler returns.
+func (cw *compressWriter) close() {
+	if !cw.started {
+		_ = cw.start()
+	}
+	if cw.encoder == nil {
+		return
+	}
+
+	_ = cw.encoder.Close()
+	switch w := cw.encoder.(type) {
+	case *brotli.Writer:
+		brotliWriters.Put(w)
+	case *gzip.Writer:
+		gzipWriters.Put(w)
+	}
+}
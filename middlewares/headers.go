@@ -0,0 +1,171 @@
+package middlewares
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/utils/responses"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errOriginNotAllowed = errors.New("the origin is not allowed")
+	errMethodNotAllowed = errors.New("the method is not allowed")
+	errHeaderNotAllowed = errors.New("the header is not allowed")
+)
+
+// CORSConfig is the settings of cross-origin requests.
+type CORSConfig struct {
+	// AllowedOrigins are the origins which can call the API from
+	// a browser, like https://example.com. * allows every origin.
+	AllowedOrigins []string
+	// AllowedMethods and AllowedHeaders are what cross-origin
+	// requests can use.
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts can read.
+	ExposedHeaders []string
+	// AllowCredentials lets browsers send cookies and
+	// the Authorization header.
+	AllowCredentials bool
+	// MaxAge is how long browsers cache a preflight response.
+	MaxAge time.Duration
+}
+
+// SetCORSMiddleware answers preflight requests and adds the CORS headers
+// to the responses of allowed origins. It must wrap the router since
+// preflight requests do not match the methods of the routes.
+func SetCORSMiddleware(config CORSConfig) func(http.Handler) http.Handler {
+	anyOrigin := false
+	origins := make(map[string]bool)
+	for _, origin := range config.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[strings.ToLower(origin)] = true
+	}
+	methods := make(map[string]bool)
+	for _, method := range config.AllowedMethods {
+		methods[strings.ToUpper(method)] = true
+	}
+	headers := make(map[string]bool)
+	for _, header := range config.AllowedHeaders {
+		headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(origins) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if !anyOrigin && !origins[strings.ToLower(origin)] {
+				if preflight {
+					responses.ERROR(w, http.StatusForbidden, errOriginNotAllowed)
+					return
+				}
+				// The response is sent without the CORS
+				// headers, so the browser hides it.
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Credentials can not be used with the * origin.
+			if anyOrigin && !config.AllowCredentials {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			if config.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(config.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !methods[r.Header.Get("Access-Control-Request-Method")] {
+				responses.ERROR(w, http.StatusForbidden, errMethodNotAllowed)
+				return
+			}
+			for _, header := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+				header = strings.TrimSpace(header)
+				if header != "" && !headers[http.CanonicalHeaderKey(header)] {
+					responses.ERROR(w, http.StatusForbidden, errHeaderNotAllowed)
+					return
+				}
+			}
+
+			h.Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+			if len(config.AllowedHeaders) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			}
+			if config.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// SecurityConfig is the security headers of the responses.
+type SecurityConfig struct {
+	// HSTSMaxAge is how long browsers only use HTTPS for the site.
+	// The header is only sent over HTTPS and zero leaves it out.
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubdomains applies HSTS to the subdomains too.
+	HSTSIncludeSubdomains bool
+	// ContentSecurityPolicy and ReferrerPolicy are the values
+	// of their headers. Empty leaves them out.
+	ContentSecurityPolicy string
+	ReferrerPolicy        string
+}
+
+// SetSecurityHeadersMiddleware adds the security headers to every
+// response. Browsers are also told not to guess the type of responses.
+func SetSecurityHeadersMiddleware(config SecurityConfig) func(http.Handler) http.Handler {
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(int(config.HSTSMaxAge.Seconds()))
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Content-Type-Options", "nosniff")
+			if hsts != "" && (r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https") {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+			if config.ContentSecurityPolicy != "" {
+				h.Set("Content-Security-Policy", config.ContentSecurityPolicy)
+			}
+			if config.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", config.ReferrerPolicy)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSetCORSMiddleware(t *testing.T) {
+	config := CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		ExposedHeaders: []string{"ETag"},
+		MaxAge:         time.Hour,
+	}
+
+	tests := []struct {
+		name string
+		// config is used instead of the one above when it has methods.
+		config  CORSConfig
+		method  string
+		headers map[string]string
+		status  int
+		// want are the expected response headers,
+		// an empty value means the header is not sent.
+		want map[string]string
+	}{
+		{
+			name:   "same origin",
+			method: "GET",
+			status: http.StatusOK,
+			want:   map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""},
+		},
+		{
+			name:    "allowed origin",
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://example.com"},
+			status:  http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":   "https://example.com",
+				"Access-Control-Expose-Headers": "ETag",
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:    "denied origin",
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://evil.example"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "", "Vary": "Origin"},
+		},
+		{
+			name:   "preflight",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "authorization, content-type",
+			},
+			status: http.StatusNoContent,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://example.com",
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Authorization, Content-Type",
+				"Access-Control-Max-Age":       "3600",
+			},
+		},
+		{
+			name:   "preflight of a denied origin",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://evil.example",
+				"Access-Control-Request-Method": "POST",
+			},
+			status: http.StatusForbidden,
+			want:   map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:   "preflight of a disallowed method",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                        "https://example.com",
+				"Access-Control-Request-Method": "DELETE",
+			},
+			status: http.StatusForbidden,
+			want:   map[string]string{"Access-Control-Allow-Methods": ""},
+		},
+		{
+			name:   "preflight of a disallowed header",
+			method: "OPTIONS",
+			headers: map[string]string{
+				"Origin":                         "https://example.com",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "Content-Type, X-Secret",
+			},
+			status: http.StatusForbidden,
+			want:   map[string]string{"Access-Control-Allow-Headers": ""},
+		},
+		{
+			name:    "any origin",
+			config:  CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://other.example"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
+		{
+			name:    "any origin with credentials",
+			config:  CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET"}, AllowCredentials: true},
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://other.example"},
+			status:  http.StatusOK,
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://other.example",
+				"Access-Control-Allow-Credentials": "true",
+			},
+		},
+		{
+			name:    "no allowed origins",
+			config:  CORSConfig{AllowedMethods: []string{"GET"}},
+			method:  "GET",
+			headers: map[string]string{"Origin": "https://example.com"},
+			status:  http.StatusOK,
+			want:    map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""},
+		},
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config
+			if tt.config.AllowedMethods != nil {
+				c = tt.config
+			}
+
+			r := httptest.NewRequest(tt.method, "/posts", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			SetCORSMiddleware(c)(ok).ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			for name, want := range tt.want {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/nebisin/gopress/utils/responses"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrBodyTooLarge is the error of a request body
+// which is larger than the limit of its route.
+var ErrBodyTooLarge = errors.New("the request body is too large")
+
+// LimitBody limits the body to limit bytes like http.MaxBytesReader,
+// which also closes the connection after the response, but reading
+// past the limit fails with ErrBodyTooLarge.
+func LimitBody(w http.ResponseWriter, body io.ReadCloser, limit int64) io.ReadCloser {
+	return &limitedBody{ReadCloser: http.MaxBytesReader(w, body, limit), remaining: limit}
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	// The reader only fails after the whole limit is read
+	// when there is more to read.
+	if err != nil && err != io.EOF && b.remaining <= 0 {
+		err = ErrBodyTooLarge
+	}
+	return n, err
+}
+
+// SetBodyLimitMiddleware limits request bodies to limit bytes. Routes
+// can have their own limit in routes, keyed by the route template.
+// Reading past the limit fails with ErrBodyTooLarge and the connection
+// is closed after the response.
+func SetBodyLimitMiddleware(limit int64, routes map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			max := limit
+			if routeLimit, ok := routes[routeTemplate(r)]; ok {
+				max = routeLimit
+			}
+
+			if r.ContentLength > max {
+				w.Header().Set("Connection", "close")
+				responses.ERROR(w, http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
+				return
+			}
+			r.Body = LimitBody(w, r.Body, max)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SetTimeoutMiddleware cancels the context of the request after
+// timeout, which stops the queries run with it. Routes can have their
+// own timeout in routes, keyed by the route template, and zero turns
+// the timeout off for a route.
+func SetTimeoutMiddleware(timeout time.Duration, routes map[string]time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			d := timeout
+			if routeTimeout, ok := routes[routeTemplate(r)]; ok {
+				d = routeTimeout
+			}
+			if d <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middlewares
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAll answers with the body it reads, or 413 when it is too large.
+func readAll(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if errors.Is(err, ErrBodyTooLarge) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(body)
+}
+
+func TestSetBodyLimitMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(SetBodyLimitMiddleware(8, map[string]int64{"/media": 16}))
+	router.HandleFunc("/posts", readAll)
+	router.HandleFunc("/media", readAll)
+
+	tests := []struct {
+		name    string
+		target  string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"under the limit", "/posts", "1234567", false, http.StatusOK},
+		{"at the limit", "/posts", "12345678", false, http.StatusOK},
+		{"over the limit", "/posts", "123456789", false, http.StatusRequestEntityTooLarge},
+		{"chunked at the limit", "/posts", "12345678", true, http.StatusOK},
+		{"chunked over the limit", "/posts", "123456789", true, http.StatusRequestEntityTooLarge},
+		{"route limit", "/media", "1234567890123456", false, http.StatusOK},
+		{"over the route limit", "/media", "12345678901234567", true, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			if tt.chunked {
+				// The size of the body is not known before reading it.
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK && w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body, tt.body)
+			}
+			if tt.status == http.StatusRequestEntityTooLarge && !tt.chunked && w.Header().Get("Connection") != "close" {
+				t.Errorf("Connection = %q, want close", w.Header().Get("Connection"))
+			}
+		})
+	}
+}
+
+func TestSetTimeoutMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(SetTimeoutMiddleware(time.Minute, map[string]time.Duration{"/media": 0}))
+
+	deadlines := make(map[string]time.Time)
+	handle := func(w http.ResponseWriter, r *http.Request) {
+		deadline, _ := r.Context().Deadline()
+		deadlines[r.URL.Path] = deadline
+	}
+	router.HandleFunc("/posts", handle)
+	router.HandleFunc("/media", handle)
+
+	start := time.Now()
+	for _, target := range []string{"/posts", "/media"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	if d := deadlines["/posts"].Sub(start); d < time.Minute || d > time.Minute+time.Second {
+		t.Errorf("deadline of /posts is in %v, want a minute", d)
+	}
+	if !deadlines["/media"].IsZero() {
+		t.Errorf("deadline of /media = %v, want none", deadlines["/media"])
+	}
+}
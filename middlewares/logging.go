@@ -0,0 +1,141 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/nebisin/gopress/logging"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader carries the id of a request. An id sent by
+// the client or a proxy is kept, otherwise a new one is made.
+const RequestIDHeader = "X-Request-ID"
+
+// probePaths are called every few seconds by the orchestrator
+// and the metrics scraper so they are not logged.
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/version": true,
+	"/metrics": true,
+}
+
+// sensitiveHeaders are not written to the logs.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"X-Api-Key":           true,
+	"X-Auth-Token":        true,
+}
+
+// accessLog collects what the handlers learn about the request,
+// like the user, for the log entry written after them.
+type accessLog struct {
+	userID uint
+}
+
+type accessLogKey struct{}
+
+// SetLoggingMiddleware gives the request an id and a logger with it,
+// which handlers get with logging.FromContext, and logs the request
+// when it is handled. Request headers are only logged at the debug
+// level and sensitive ones are redacted.
+func SetLoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := logging.Default().With("request_id", id)
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+
+		entry := &accessLog{}
+		ctx := logging.NewContext(r.Context(), logger)
+		ctx = context.WithValue(ctx, accessLogKey{}, entry)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		if probePaths[r.URL.Path] {
+			return
+		}
+
+		duration := time.Since(start)
+		args := []interface{}{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", routeTemplate(r),
+			"status", recorder.status,
+			"bytes", recorder.bytes,
+			"duration_ms", float64(duration.Microseconds()) / 1000,
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		}
+		if entry.userID != 0 {
+			args = append(args, "user_id", entry.userID)
+		}
+		if logger.Enabled(logging.LevelDebug) {
+			args = append(args, "headers", redactHeaders(r.Header))
+		}
+
+		level := logging.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = logging.LevelError
+		}
+		logger.Log(level, "request", args...)
+	})
+}
+
+// withUser records the authenticated user of the request and adds
+// it to the logger of the request.
+func withUser(r *http.Request, uid uint) *http.Request {
+	if entry, ok := r.Context().Value(accessLogKey{}).(*accessLog); ok {
+		entry.userID = uid
+	}
+
+	logger := logging.FromContext(r.Context()).With("user_id", uid)
+	return r.WithContext(logging.NewContext(r.Context(), logger))
+}
+
+// validRequestID accepts ids which are safe to log and to send back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+func redactHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name, values := range header {
+		if sensitiveHeaders[name] {
+			headers[name] = "[REDACTED]"
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
@@ -2,34 +2,133 @@ package middlewares
 
 import (
 	"errors"
+	"github.com/gorilla/mux"
+	"github.com/nebisin/gopress/metrics"
+	"github.com/nebisin/gopress/tracing"
 	"github.com/nebisin/gopress/utils/auth"
 	"github.com/nebisin/gopress/utils/responses"
-	"log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func SetMiddlewareJSON(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		next.ServeHTTP(w, r)
-	})
+// ErrNotJSON is the error of a request body which is not JSON.
+var ErrNotJSON = errors.New("the request body must be JSON")
+
+// SetMiddlewareJSON refuses request bodies which are not JSON with 415,
+// so forms and other simple requests of browsers can not change data.
+// Types like application/merge-patch+json are JSON too. Routes taking
+// other bodies, like uploads, are listed in others by their template.
+func SetMiddlewareJSON(others map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength != 0 && !others[routeTemplate(r)] && !isJSON(r.Header.Get("Content-Type")) {
+				responses.ERROR(w, http.StatusUnsupportedMediaType, ErrNotJSON)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
-func SetMiddlewareAuthentication(next http.HandlerFunc) http.HandlerFunc {
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" ||
+		strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json")
+}
+
+// SetMiddlewareAuthentication answers 401 to requests without a valid
+// token, including the revoked tokens of locked users.
+func SetMiddlewareAuthentication(tokens auth.Tokens, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := auth.TokenValid(r)
+		uid, err := tokens.ExtractTokenID(r)
 		if err != nil {
 			responses.ERROR(w, http.StatusUnauthorized, errors.New("unauthorized"))
 			return
 		}
-		next(w, r)
+
+		next(w, withUser(r, uid))
 	}
 }
 
-func SetLoggingMiddleware(next http.Handler) http.Handler {
+// SetMetricsMiddleware counts the requests and times them. Requests are
+// labelled with the template of their route, like /posts/{id}, so every
+// post does not get its own series.
+func SetMetricsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Method: %s, Path: %s handled request", r.Method, r.URL.Path)
+		route := routeTemplate(r)
 
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		status := strconv.Itoa(recorder.status)
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
 	})
 }
+
+// SetTracingMiddleware starts the span of the request. The trace of
+// the caller is continued when the request has a traceparent header.
+// Handlers pass the context of the request to the repositories so
+// their calls and queries become children of this span.
+func SetTracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("gopress", route, r)...),
+			trace.WithAttributes(semconv.NetAttributesFromHTTPRequest("tcp", r)...),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(recorder.status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(recorder.status))
+	})
+}
+
+// routeTemplate returns the template of the route matching
+// the request, like /posts/{id}.
+func routeTemplate(r *http.Request) string {
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+
+	return "unknown"
+}
+
+// statusRecorder remembers the status and the size of the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetMiddlewareJSON(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(SetMiddlewareJSON(map[string]bool{"/media": true}))
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/posts", ok)
+	router.HandleFunc("/media", ok)
+
+	tests := []struct {
+		target      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"/posts", "application/json", `{}`, http.StatusOK},
+		{"/posts", "application/json; charset=utf-8", `{}`, http.StatusOK},
+		{"/posts", "application/merge-patch+json", `{}`, http.StatusOK},
+		{"/posts", "application/json-patch+json", `[]`, http.StatusOK},
+		{"/posts", "", "", http.StatusOK},
+		{"/posts", "text/plain", `{}`, http.StatusUnsupportedMediaType},
+		{"/posts", "application/x-www-form-urlencoded", "title=x", http.StatusUnsupportedMediaType},
+		{"/posts", "multipart/form-data; boundary=x", "--x--", http.StatusUnsupportedMediaType},
+		{"/posts", "", `{}`, http.StatusUnsupportedMediaType},
+		{"/posts", "application/jsonx", `{}`, http.StatusUnsupportedMediaType},
+		{"/media", "image/png", "png", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("POST %s with %q = %d, want %d", tt.target, tt.contentType, w.Code, tt.status)
+		}
+	}
+}
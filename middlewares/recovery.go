@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nebisin/gopress/logging"
+	"github.com/nebisin/gopress/utils/responses"
+	"net/http"
+	"runtime/debug"
+)
+
+// SetRecoveryMiddleware turns a panic in a handler into a 500 response
+// and logs it with its stack, instead of dropping the connection.
+func SetRecoveryMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &headerRecorder{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				// The handler asks the server to abort the response.
+				panic(v)
+			}
+
+			logging.FromContext(r.Context()).Error("panic while handling the request",
+				"panic", fmt.Sprint(v), "stack", string(debug.Stack()))
+
+			// A response which is already started can not be replaced.
+			if !recorder.wroteHeader {
+				responses.ERROR(w, http.StatusInternalServerError, errors.New("something went wrong"))
+			}
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// headerRecorder remembers if the response is started.
+type headerRecorder struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (r *headerRecorder) WriteHeader(status int) {
+	r.wroteHeader = true
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *headerRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
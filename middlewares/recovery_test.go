@@ -0,0 +1,88 @@
+package middlewares
+
+import (
+	"bytes"
+	"github.com/nebisin/gopress/logging"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetRecoveryMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle http.HandlerFunc
+		status int
+		body   string
+		logged bool
+	}{
+		{
+			name:   "no panic",
+			handle: func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) },
+			status: http.StatusOK,
+			body:   "ok",
+		},
+		{
+			name:   "panic",
+			handle: func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			status: http.StatusInternalServerError,
+			body:   `{"error":"something went wrong"}`,
+			logged: true,
+		},
+		{
+			name: "panic after the response is started",
+			handle: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte("partial"))
+				panic("boom")
+			},
+			status: http.StatusAccepted,
+			body:   "partial",
+			logged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			defer logging.SetDefault(logging.Default())
+			logging.SetDefault(logging.New(&logs, logging.LevelInfo))
+
+			w := httptest.NewRecorder()
+			SetRecoveryMiddleware(tt.handle).ServeHTTP(w, httptest.NewRequest("GET", "/posts", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != tt.body {
+				t.Errorf("body = %s, want %s", body, tt.body)
+			}
+
+			logged := logs.String()
+			if !tt.logged && logged != "" {
+				t.Errorf("log = %s, want none", logged)
+			}
+			if tt.logged {
+				for _, want := range []string{"panic while handling the request", "boom", "recovery_test.go"} {
+					if !strings.Contains(logged, want) {
+						t.Errorf("log %s does not have %q", logged, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSetRecoveryMiddlewareAbort(t *testing.T) {
+	handler := SetRecoveryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/posts", nil))
+}
@@ -0,0 +1,434 @@
+// Package migrations changes the database schema with numbered
+// SQL migrations embedded in the binary. Every database dialect has
+// its own set of files named like 0001_initial.up.sql and
+// 0001_initial.down.sql and the applied versions are recorded in the
+// schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql
+var files embed.FS
+
+// ErrLocked is returned when another instance is migrating
+// the database and it did not finish in time.
+var ErrLocked = errors.New("migrations are locked by another instance")
+
+// Migration is one change of the schema.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and whether it is applied.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies and rolls back the migrations of a database.
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+
+	// LockTimeout is how long to wait for another instance
+	// which is migrating the same database.
+	LockTimeout time.Duration
+}
+
+// New returns a migrator with the migrations
+// for the dialect of the database.
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Load(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations, LockTimeout: time.Minute}, nil
+}
+
+// Load reads the migrations of a dialect ordered by their versions.
+func Load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, path.Join("sql", dialect))
+	if err != nil {
+		return nil, fmt.Errorf("there are no migrations for %s", dialect)
+	}
+
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("unexpected migration file %s", name)
+		}
+
+		parts := strings.SplitN(strings.TrimSuffix(name, "."+direction+".sql"), "_", 2)
+		version, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil || version == 0 || len(parts) != 2 {
+			return nil, fmt.Errorf("migration file %s must be named like 0001_name.%s.sql", name, direction)
+		}
+
+		content, err := files.ReadFile(path.Join("sql", dialect, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: parts[1]}
+			byVersion[uint(version)] = m
+		}
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d has two names %s and %s", version, m.Name, parts[1])
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Latest is the version of the newest migration.
+func (m *Migrator) Latest() uint {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version is the newest applied migration. It only reads
+// the database so it can be called often.
+func (m *Migrator) Version() (uint, error) {
+	if !m.db.Migrator().HasTable("schema_migrations") {
+		return 0, nil
+	}
+
+	var version uint
+	err := m.db.Raw("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version).Error
+	return version, err
+}
+
+// Status lists all migrations with the time they are applied.
+func (m *Migrator) Status() ([]Status, error) {
+	if err := m.prepare(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i].Migration = migration
+		if at, ok := applied[migration.Version]; ok {
+			at := at
+			statuses[i].AppliedAt = &at
+		}
+	}
+
+	return statuses, nil
+}
+
+// Up applies all migrations which are not applied yet
+// and returns how many of them are applied.
+func (m *Migrator) Up() (int, error) {
+	return m.To(m.Latest())
+}
+
+// Down rolls back the last n applied migrations.
+func (m *Migrator) Down(n int) (int, error) {
+	count := 0
+	err := m.locked(func(db *gorm.DB, applied map[uint]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && count < n; i-- {
+			if _, ok := applied[m.migrations[i].Version]; !ok {
+				continue
+			}
+			if err := m.run(db, m.migrations[i], false); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// To applies or rolls back migrations until the given version
+// is the newest applied one. Zero rolls back every migration.
+func (m *Migrator) To(version uint) (int, error) {
+	if version != 0 && !m.exists(version) {
+		return 0, fmt.Errorf("there is no migration %d", version)
+	}
+
+	count := 0
+	err := m.locked(func(db *gorm.DB, applied map[uint]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+				continue
+			}
+			if err := m.run(db, migration, false); err != nil {
+				return err
+			}
+			count++
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok || migration.Version > version {
+				continue
+			}
+			if err := m.run(db, migration, true); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+func (m *Migrator) exists(version uint) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// run applies or rolls back a migration in a transaction together
+// with its row in schema_migrations. MySQL commits schema changes
+// right away, so a failing migration can be left half applied there.
+func (m *Migrator) run(db *gorm.DB, migration Migration, up bool) error {
+	script := migration.Down
+	if up {
+		script = migration.Up
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range statements(script) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		if up {
+			return tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+				migration.Version, migration.Name, time.Now().UTC()).Error
+		}
+		return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
+
+// locked runs fn while holding the lock of the database, waiting up
+// to LockTimeout for another instance holding it. The lock belongs to
+// a connection, so the database releases it when an instance stops
+// in the middle of migrating. fn must run its statements on db.
+func (m *Migrator) locked(fn func(db *gorm.DB, applied map[uint]time.Time) error) error {
+	if err := m.prepare(); err != nil {
+		return err
+	}
+
+	switch m.db.Dialector.Name() {
+	case "postgres":
+		return m.sessionLocked("SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)", postgresLockKey, fn)
+	case "mysql":
+		// Names of the locks are global to the server and can be
+		// 64 characters long, so they have a hash of the database name.
+		return m.sessionLocked("SELECT GET_LOCK(CONCAT(?, SHA1(DATABASE())), 0)",
+			"SELECT RELEASE_LOCK(CONCAT(?, SHA1(DATABASE())))", mysqlLockPrefix, fn)
+	}
+
+	return m.transactionLocked(fn)
+}
+
+// postgresLockKey is the key of the advisory lock, "gopress" in ASCII.
+const postgresLockKey int64 = 0x676f7072657373
+
+// mysqlLockPrefix is the name of the lock before the hash of the database name.
+const mysqlLockPrefix = "gopress:"
+
+// sessionLocked holds a lock of the database session while fn runs.
+// The lock query must return whether the lock is taken without waiting
+// for it. fn runs on the same connection, so it does not wait for
+// another one when the pool has a single connection.
+func (m *Migrator) sessionLocked(lock, unlock string, key interface{}, fn func(db *gorm.DB, applied map[uint]time.Time) error) error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		var ok sql.NullBool
+		if err := conn.QueryRowContext(ctx, lock, key).Scan(&ok); err != nil {
+			return err
+		}
+		if ok.Bool {
+			break
+		}
+		if time.Now().After(deadline) {
+			return ErrLocked
+		}
+		time.Sleep(time.Second)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, unlock, key); err != nil {
+			// The connection would go back to the pool holding the
+			// lock, so it is closed instead which releases it.
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+
+	db := m.db.WithContext(ctx)
+	db.Statement.ConnPool = conn
+
+	// Versions are read after getting the lock since
+	// the other instance may have just applied them.
+	applied, err := m.applied(db)
+	if err != nil {
+		return err
+	}
+
+	return fn(db, applied)
+}
+
+// transactionLocked runs fn in a transaction which starts with a write.
+// SQLite lets only one connection write at a time, so the transaction
+// holds the lock until it ends and every migration of fn is applied or
+// rolled back together.
+func (m *Migrator) transactionLocked(fn func(db *gorm.DB, applied map[uint]time.Time) error) error {
+	// Failing writes are expected while waiting for the lock.
+	quiet := logger.Default.LogMode(logger.Silent)
+
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		locked := false
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Session(&gorm.Session{Logger: quiet}).
+				Exec("UPDATE schema_migrations SET version = version WHERE 1 = 0").Error
+			if err != nil {
+				return err
+			}
+			locked = true
+
+			applied, err := m.applied(tx)
+			if err != nil {
+				return err
+			}
+			return fn(tx, applied)
+		})
+		if err == nil || locked {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: %v", ErrLocked, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (m *Migrator) applied(db *gorm.DB) (map[uint]time.Time, error) {
+	var rows []struct {
+		Version   uint
+		AppliedAt time.Time
+	}
+	if err := db.Raw("SELECT version, applied_at FROM schema_migrations").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[uint]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+
+	return applied, nil
+}
+
+// prepare creates the table keeping the applied versions.
+func (m *Migrator) prepare() error {
+	return m.db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (" +
+		"version bigint NOT NULL PRIMARY KEY, name varchar(255) NOT NULL, applied_at timestamp NOT NULL)").Error
+}
+
+// statements splits a script into its statements. A statement ends
+// with a semicolon at the end of a line and lines starting with --
+// are comments.
+func statements(script string) []string {
+	var statements []string
+	var current strings.Builder
+
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+
+	return statements
+}
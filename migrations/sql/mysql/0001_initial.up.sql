@@ -0,0 +1,6 @@
+-- The schema of the versions before migrations existed. Their
+-- databases already have these tables and the later migrations
+-- bring them up to date.
+CREATE TABLE IF NOT EXISTS `users` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`email` varchar(191) NOT NULL UNIQUE,`username` varchar(191) NOT NULL UNIQUE,`password` longtext NOT NULL,`display_name` longtext,`is_active` boolean DEFAULT true,`is_locked` boolean DEFAULT false,PRIMARY KEY (`id`),INDEX `idx_users_deleted_at` (`deleted_at`));
+
+CREATE TABLE IF NOT EXISTS `posts` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`title` longtext NOT NULL,`body` longtext,`author_id` bigint unsigned NOT NULL,`is_published` boolean DEFAULT false,PRIMARY KEY (`id`),INDEX `idx_posts_deleted_at` (`deleted_at`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`));
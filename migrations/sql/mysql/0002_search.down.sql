@@ -0,0 +1,4 @@
+DROP INDEX `posts_search_title` ON `posts`;
+DROP INDEX `posts_search` ON `posts`;
+DROP TABLE `post_tags`;
+DROP TABLE `tags`;
@@ -0,0 +1,8 @@
+CREATE TABLE `tags` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`name` varchar(191) NOT NULL UNIQUE,PRIMARY KEY (`id`),INDEX `idx_tags_deleted_at` (`deleted_at`));
+
+CREATE TABLE `post_tags` (`post_id` bigint unsigned,`tag_id` bigint unsigned,PRIMARY KEY (`post_id`,`tag_id`),CONSTRAINT `fk_post_tags_post` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`),CONSTRAINT `fk_post_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`));
+
+-- One index covers the title and the body for matching
+-- and the other one the title for ranking title matches higher.
+CREATE FULLTEXT INDEX `posts_search` ON `posts` (`title`, `body`);
+CREATE FULLTEXT INDEX `posts_search_title` ON `posts` (`title`);
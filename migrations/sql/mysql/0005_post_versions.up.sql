@@ -0,0 +1 @@
+ALTER TABLE `posts` ADD COLUMN `version` bigint unsigned NOT NULL DEFAULT 1;
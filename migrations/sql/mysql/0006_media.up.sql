@@ -0,0 +1,3 @@
+CREATE TABLE `media` (`id` bigint unsigned AUTO_INCREMENT,`created_at` datetime(3) NULL,`updated_at` datetime(3) NULL,`deleted_at` datetime(3) NULL,`owner_id` bigint unsigned NOT NULL,`file_name` longtext,`content_type` longtext NOT NULL,`size` bigint NOT NULL,`storage_key` varchar(191) NOT NULL UNIQUE,`status` varchar(191) NOT NULL DEFAULT 'ready',`width` bigint,`height` bigint,`blurhash` longtext,PRIMARY KEY (`id`),INDEX `idx_media_status` (`status`),INDEX `idx_media_owner_id` (`owner_id`),INDEX `idx_media_deleted_at` (`deleted_at`),CONSTRAINT `fk_media_owner` FOREIGN KEY (`owner_id`) REFERENCES `users`(`id`));
+
+CREATE TABLE `media_variants` (`id` bigint unsigned AUTO_INCREMENT,`media_id` bigint unsigned NOT NULL,`name` varchar(64) NOT NULL,`width` bigint,`height` bigint,`content_type` longtext NOT NULL,`size` bigint NOT NULL,`storage_key` varchar(191) NOT NULL UNIQUE,PRIMARY KEY (`id`),UNIQUE INDEX `idx_media_variant` (`media_id`,`name`),CONSTRAINT `fk_media_variants` FOREIGN KEY (`media_id`) REFERENCES `media`(`id`));
@@ -0,0 +1,2 @@
+ALTER TABLE `posts` DROP FOREIGN KEY `fk_posts_featured_media`;
+ALTER TABLE `posts` DROP COLUMN `featured_media_id`,DROP COLUMN `excerpt`,DROP COLUMN `custom_excerpt`,DROP COLUMN `word_count`,DROP COLUMN `reading_time`;
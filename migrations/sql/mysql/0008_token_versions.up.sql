@@ -0,0 +1 @@
+ALTER TABLE `users` ADD COLUMN `token_version` bigint unsigned NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- The schema of the versions before migrations existed. Their
+-- databases already have these tables and the later migrations
+-- bring them up to date.
+CREATE TABLE IF NOT EXISTS "users" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"email" text NOT NULL UNIQUE,"username" text NOT NULL UNIQUE,"password" text NOT NULL,"display_name" text,"is_active" boolean DEFAULT true,"is_locked" boolean DEFAULT false,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE IF NOT EXISTS "posts" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"title" text NOT NULL,"body" text,"author_id" bigint NOT NULL,"is_published" boolean DEFAULT false,PRIMARY KEY ("id"),CONSTRAINT "fk_posts_author" FOREIGN KEY ("author_id") REFERENCES "users"("id"));
+CREATE INDEX IF NOT EXISTS "idx_posts_deleted_at" ON "posts" ("deleted_at");
@@ -0,0 +1,3 @@
+DROP INDEX "posts_search";
+DROP TABLE "post_tags";
+DROP TABLE "tags";
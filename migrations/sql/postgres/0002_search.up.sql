@@ -0,0 +1,8 @@
+CREATE TABLE "tags" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"name" text NOT NULL UNIQUE,PRIMARY KEY ("id"));
+CREATE INDEX "idx_tags_deleted_at" ON "tags" ("deleted_at");
+
+CREATE TABLE "post_tags" ("post_id" bigint,"tag_id" bigint,PRIMARY KEY ("post_id","tag_id"),CONSTRAINT "fk_post_tags_post" FOREIGN KEY ("post_id") REFERENCES "posts"("id"),CONSTRAINT "fk_post_tags_tag" FOREIGN KEY ("tag_id") REFERENCES "tags"("id"));
+
+-- The expression must be the same as postgresVector in the search
+-- package for the index to be used.
+CREATE INDEX "posts_search" ON "posts" USING GIN ((setweight(to_tsvector('english', coalesce(title, '')), 'A') || setweight(to_tsvector('english', coalesce(body, '')), 'B')));
@@ -0,0 +1,7 @@
+CREATE TABLE "media" ("id" bigserial,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,"owner_id" bigint NOT NULL,"file_name" text,"content_type" text NOT NULL,"size" bigint NOT NULL,"storage_key" text NOT NULL UNIQUE,"status" text NOT NULL DEFAULT 'ready',"width" bigint,"height" bigint,"blurhash" text,PRIMARY KEY ("id"),CONSTRAINT "fk_media_owner" FOREIGN KEY ("owner_id") REFERENCES "users"("id"));
+CREATE INDEX "idx_media_status" ON "media" ("status");
+CREATE INDEX "idx_media_owner_id" ON "media" ("owner_id");
+CREATE INDEX "idx_media_deleted_at" ON "media" ("deleted_at");
+
+CREATE TABLE "media_variants" ("id" bigserial,"media_id" bigint NOT NULL,"name" varchar(64) NOT NULL,"width" bigint,"height" bigint,"content_type" text NOT NULL,"size" bigint NOT NULL,"storage_key" text NOT NULL UNIQUE,PRIMARY KEY ("id"),CONSTRAINT "fk_media_variants" FOREIGN KEY ("media_id") REFERENCES "media"("id"));
+CREATE UNIQUE INDEX "idx_media_variant" ON "media_variants" ("media_id","name");
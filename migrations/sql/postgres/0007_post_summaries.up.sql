@@ -0,0 +1 @@
+ALTER TABLE "posts" ADD COLUMN "featured_media_id" bigint,ADD COLUMN "excerpt" text,ADD COLUMN "custom_excerpt" boolean NOT NULL DEFAULT false,ADD COLUMN "word_count" bigint NOT NULL DEFAULT 0,ADD COLUMN "reading_time" bigint NOT NULL DEFAULT 0,ADD CONSTRAINT "fk_posts_featured_media" FOREIGN KEY ("featured_media_id") REFERENCES "media"("id");
@@ -0,0 +1,8 @@
+-- The schema of the versions before migrations existed. Their
+-- databases already have these tables and the later migrations
+-- bring them up to date.
+CREATE TABLE IF NOT EXISTS `users` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`email` text NOT NULL UNIQUE,`username` text NOT NULL UNIQUE,`password` text NOT NULL,`display_name` text,`is_active` numeric DEFAULT true,`is_locked` numeric DEFAULT false,PRIMARY KEY (`id`));
+CREATE INDEX IF NOT EXISTS `idx_users_deleted_at` ON `users`(`deleted_at`);
+
+CREATE TABLE IF NOT EXISTS `posts` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`title` text NOT NULL,`body` text,`author_id` integer NOT NULL,`is_published` numeric DEFAULT false,PRIMARY KEY (`id`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`));
+CREATE INDEX IF NOT EXISTS `idx_posts_deleted_at` ON `posts`(`deleted_at`);
@@ -0,0 +1,7 @@
+-- The FTS5 table of the search is created by the server instead,
+-- since go-sqlite3 only has FTS5 when it is built with the
+-- sqlite_fts5 tag and the server falls back to LIKE queries without it.
+CREATE TABLE `tags` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`name` text NOT NULL UNIQUE,PRIMARY KEY (`id`));
+CREATE INDEX `idx_tags_deleted_at` ON `tags`(`deleted_at`);
+
+CREATE TABLE `post_tags` (`post_id` integer,`tag_id` integer,PRIMARY KEY (`post_id`,`tag_id`),CONSTRAINT `fk_post_tags_post` FOREIGN KEY (`post_id`) REFERENCES `posts`(`id`),CONSTRAINT `fk_post_tags_tag` FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`));
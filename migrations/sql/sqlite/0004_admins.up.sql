@@ -0,0 +1 @@
+ALTER TABLE `users` ADD COLUMN `is_admin` numeric DEFAULT false;
@@ -0,0 +1,7 @@
+-- SQLite can not drop a column with a foreign key,
+-- so the table is copied without the new columns.
+CREATE TABLE `posts_old` (`id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`title` text NOT NULL,`body` text,`author_id` integer NOT NULL,`is_published` numeric DEFAULT false,`published_at` datetime,`version` integer NOT NULL DEFAULT 1,PRIMARY KEY (`id`),CONSTRAINT `fk_posts_author` FOREIGN KEY (`author_id`) REFERENCES `users`(`id`));
+INSERT INTO `posts_old` SELECT `id`,`created_at`,`updated_at`,`deleted_at`,`title`,`body`,`author_id`,`is_published`,`published_at`,`version` FROM `posts`;
+DROP TABLE `posts`;
+ALTER TABLE `posts_old` RENAME TO `posts`;
+CREATE INDEX `idx_posts_deleted_at` ON `posts`(`deleted_at`);
@@ -0,0 +1,5 @@
+ALTER TABLE `posts` ADD COLUMN `featured_media_id` integer CONSTRAINT `fk_posts_featured_media` REFERENCES `media`(`id`);
+ALTER TABLE `posts` ADD COLUMN `excerpt` text;
+ALTER TABLE `posts` ADD COLUMN `custom_excerpt` numeric NOT NULL DEFAULT false;
+ALTER TABLE `posts` ADD COLUMN `word_count` integer NOT NULL DEFAULT 0;
+ALTER TABLE `posts` ADD COLUMN `reading_time` integer NOT NULL DEFAULT 0;
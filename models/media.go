@@ -0,0 +1,49 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// Processing states of media. Images are processed in the
+// background after they are uploaded, other files are ready
+// right away.
+const (
+	MediaProcessing = "processing"
+	MediaReady      = "ready"
+	MediaFailed     = "failed"
+)
+
+// Media is a file uploaded by a user, like an image used in a post.
+// The content itself is kept in the storage under StorageKey.
+type Media struct {
+	gorm.Model
+	OwnerID     uint   `json:"ownerId" gorm:"not null;index"`
+	Owner       *User  `json:"-"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType" gorm:"not null"`
+	Size        int64  `json:"size" gorm:"not null"`
+	StorageKey  string `json:"-" gorm:"not null;unique"`
+	Status      string `json:"status" gorm:"not null;default:ready;index"`
+	// Width, Height and Blurhash are only known
+	// for images after they are processed.
+	Width    int            `json:"width,omitempty"`
+	Height   int            `json:"height,omitempty"`
+	Blurhash string         `json:"blurhash,omitempty"`
+	Variants []MediaVariant `json:"variants"`
+	// URL is where the content can be downloaded from.
+	// It is not stored but set before the media is sent.
+	URL string `json:"url" gorm:"-"`
+}
+
+// MediaVariant is a resized copy of an image.
+type MediaVariant struct {
+	ID          uint   `json:"-"`
+	MediaID     uint   `json:"-" gorm:"not null;uniqueIndex:idx_media_variant"`
+	Name        string `json:"name" gorm:"size:64;not null;uniqueIndex:idx_media_variant"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"contentType" gorm:"not null"`
+	Size        int64  `json:"size" gorm:"not null"`
+	StorageKey  string `json:"-" gorm:"not null;unique"`
+	URL         string `json:"url" gorm:"-"`
+}
@@ -2,8 +2,11 @@ package models
 
 import (
 	"errors"
+	"fmt"
 	"gorm.io/gorm"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 type Post struct {
@@ -13,25 +16,156 @@ type Post struct {
 	AuthorID *uint `json:"authorId" gorm:"not null"`
 	Author *User `json:"author"`
 	IsPublished bool `json:"isPublished" gorm:"default:false"`
+	PublishedAt *time.Time `json:"publishedAt"`
+	Tags []Tag `json:"tags" gorm:"many2many:post_tags;"`
+	Version uint `json:"version" gorm:"not null;default:1"`
+	FeaturedMediaID *uint `json:"featuredMediaId"`
+	FeaturedMedia *Media `json:"featuredMedia,omitempty"`
+	// Excerpt is written by the author or made from the body
+	// if CustomExcerpt is false. It is kept up to date by Summarize
+	// along with the word count and the reading time in minutes.
+	Excerpt string `json:"excerpt"`
+	CustomExcerpt bool `json:"-" gorm:"not null;default:false"`
+	WordCount int `json:"wordCount" gorm:"not null;default:0"`
+	ReadingTime int `json:"readingTime" gorm:"not null;default:0"`
+}
+
+// PostSummary is the short form of a post sent in lists without the body.
+type PostSummary struct {
+	gorm.Model
+	Title string `json:"title"`
+	Excerpt string `json:"excerpt"`
+	AuthorID *uint `json:"authorId"`
+	Author *User `json:"author"`
+	IsPublished bool `json:"isPublished"`
+	PublishedAt *time.Time `json:"publishedAt"`
+	Tags []Tag `json:"tags"`
+	Version uint `json:"version"`
+	FeaturedMediaID *uint `json:"featuredMediaId"`
+	FeaturedMedia *Media `json:"featuredMedia,omitempty"`
+	WordCount int `json:"wordCount"`
+	ReadingTime int `json:"readingTime"`
+}
+
+func PostToSummary(p Post) PostSummary {
+	return PostSummary{
+		Model: p.Model,
+		Title: p.Title,
+		Excerpt: p.Excerpt,
+		AuthorID: p.AuthorID,
+		Author: p.Author,
+		IsPublished: p.IsPublished,
+		PublishedAt: p.PublishedAt,
+		Tags: p.Tags,
+		Version: p.Version,
+		FeaturedMediaID: p.FeaturedMediaID,
+		FeaturedMedia: p.FeaturedMedia,
+		WordCount: p.WordCount,
+		ReadingTime: p.ReadingTime,
+	}
+}
+
+// ExcerptLength is the length of the excerpts made from
+// the body in characters.
+const ExcerptLength = 280
+
+// WordsPerMinute is the reading speed used for the reading time.
+const WordsPerMinute = 200
+
+// Summarize sets the fields which are computed from the body.
+func (p *Post) Summarize() {
+	p.WordCount = len(strings.Fields(p.Body))
+	p.ReadingTime = (p.WordCount + WordsPerMinute - 1) / WordsPerMinute
+	if p.ReadingTime < 1 {
+		p.ReadingTime = 1
+	}
+
+	if !p.CustomExcerpt {
+		p.Excerpt = excerpt(p.Body, ExcerptLength)
+	}
+}
+
+// excerpt cuts the text at a word boundary before
+// given number of characters.
+func excerpt(text string, length int) string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) <= length {
+		return string(runes)
+	}
+
+	cut := string(runes[:length])
+	if i := strings.LastIndexAny(cut, " \n\t"); i > 0 {
+		cut = cut[:i]
+	}
+
+	return strings.TrimRight(cut, " \n\t.,;:") + "…"
+}
+
+// ETag returns the entity tag of the current version of the post.
+func (p Post) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, p.ID, p.Version)
 }
 
 type PostDTO struct {
 	Title string `json:"title"`
 	Body string `json:"body"`
 	IsPublished bool `json:"isPublished"`
+	Tags []string `json:"tags"`
+	Excerpt string `json:"excerpt"`
+	FeaturedMediaID *uint `json:"featuredMediaId"`
 }
 
 func DTOToPost(dto PostDTO) Post {
+	excerpt := strings.TrimSpace(dto.Excerpt)
+
 	return Post{
 		Title: dto.Title,
 		Body: dto.Body,
 		IsPublished: dto.IsPublished,
+		Tags: NamesToTags(dto.Tags),
+		Excerpt: excerpt,
+		CustomExcerpt: excerpt != "",
+		FeaturedMediaID: dto.FeaturedMediaID,
+	}
+}
+
+// PostToDTO returns the fields of the post which can be changed by clients.
+func PostToDTO(p Post) PostDTO {
+	tags := make([]string, len(p.Tags))
+	for i, tag := range p.Tags {
+		tags[i] = tag.Name
+	}
+
+	// Excerpts made from the body are not sent back
+	// so they keep following the changes of the body.
+	excerpt := ""
+	if p.CustomExcerpt {
+		excerpt = p.Excerpt
+	}
+
+	return PostDTO{
+		Title: p.Title,
+		Body: p.Body,
+		IsPublished: p.IsPublished,
+		Tags: tags,
+		Excerpt: excerpt,
+		FeaturedMediaID: p.FeaturedMediaID,
 	}
 }
 
 func (p Post) Validate(action string) error {
+	for _, tag := range p.Tags {
+		if err := tag.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if utf8.RuneCountInString(p.Excerpt) > 500 && p.CustomExcerpt {
+		return errors.New("excerpt must be at most 500 characters long")
+	}
+
 	switch strings.ToLower(action) {
-	case "create":
+	case "create", "replace":
 		if len(p.Title) < 3 {
 			return errors.New("title must be at least 3 characters long")
 		}
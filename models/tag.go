@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"strings"
+)
+
+type Tag struct {
+	gorm.Model
+	Name string `json:"name" gorm:"not null;unique"`
+}
+
+// NamesToTags turns the tag names sent by clients into tag models.
+// Names are trimmed, lower cased and deduplicated.
+// It returns nil when no names are given at all.
+func NamesToTags(names []string) []Tag {
+	if names == nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, Tag{Name: name})
+	}
+
+	return tags
+}
+
+func (t Tag) Validate() error {
+	if len(t.Name) > 32 {
+		return errors.New("tag must be at most 32 characters long")
+	}
+
+	return nil
+}
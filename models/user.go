@@ -16,6 +16,10 @@ type User struct {
 	DisplayName string `json:"displayName"`
 	IsActive    bool   `json:"isActive" gorm:"default:true"`
 	IsLocked    bool   `json:"isLocked" gorm:"default:false"`
+	IsAdmin     bool   `json:"isAdmin" gorm:"default:false"`
+	// TokenVersion is the version of the tokens of the user. It is
+	// increased to revoke the tokens given before.
+	TokenVersion uint `json:"-" gorm:"not null;default:0"`
 }
 
 type UserPayload struct {
@@ -46,14 +50,24 @@ func DTOToUser(dto UserDTO) User {
 	}
 }
 
-func (u *User) BeforeSave(tx *gorm.DB) error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+// UserToDTO returns the fields of the user which can be changed by clients.
+// Password is never sent back so it is left empty.
+func UserToDTO(u User) UserDTO {
+	return UserDTO{
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+	}
+}
+
+// HashPassword hashes the password with bcrypt. The repository hashes
+// the passwords before saving them.
+func HashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return err
+		return "", err
 	}
-	tx.Statement.SetColumn("password", hashedPassword)
 
-	return nil
+	return string(hashedPassword), nil
 }
 
 func (u User) Validate(action string) error {
@@ -73,6 +87,10 @@ func (u User) Validate(action string) error {
 			return errors.New("password must be at least 8 characters")
 		}
 	case "update":
+		if err := validate.Var(u.Username, "required"); err != nil {
+			return errors.New("you have to provide a username")
+		}
+
 		if err := validate.Var(u.Email, "required,email"); err != nil && u.Email != "" {
 			return errors.New("you have to provide a valid email")
 		}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"reflect"
+	"time"
+)
+
+// backupFormat is written at the start of every backup
+// so other files are not restored by mistake.
+const backupFormat = "gopress-backup-1"
+
+// ErrNotEmpty is returned when a backup is restored
+// into a database which already has content.
+var ErrNotEmpty = errors.New("the database is not empty")
+
+// BackupHeader describes a backup.
+type BackupHeader struct {
+	Format string
+	// Schema is the migration version of the database.
+	Schema    uint
+	CreatedAt time.Time
+	Driver    string
+}
+
+// postTag is a row of the join table of posts and tags.
+type postTag struct {
+	PostID uint
+	TagID  uint
+}
+
+// backupTable is a table and a slice of its model
+// in the order the tables are restored.
+type backupTable struct {
+	name  string
+	model func() interface{}
+}
+
+var backupTables = []backupTable{
+	{"users", func() interface{} { return &[]models.User{} }},
+	{"tags", func() interface{} { return &[]models.Tag{} }},
+	{"media", func() interface{} { return &[]models.Media{} }},
+	{"media_variants", func() interface{} { return &[]models.MediaVariant{} }},
+	{"posts", func() interface{} { return &[]models.Post{} }},
+	{"post_tags", func() interface{} { return &[]postTag{} }},
+}
+
+// Backup writes every row of the database including the trash
+// as a gzipped gob stream. Backups do not depend on the database
+// driver, so they can also move a site to another database.
+// The files of the media are not part of the backup.
+func Backup(db *gorm.DB, w io.Writer, schema uint) error {
+	zw := gzip.NewWriter(w)
+	encoder := gob.NewEncoder(zw)
+
+	header := BackupHeader{
+		Format:    backupFormat,
+		Schema:    schema,
+		CreatedAt: time.Now().UTC(),
+		Driver:    db.Dialector.Name(),
+	}
+	if err := encoder.Encode(header); err != nil {
+		return err
+	}
+
+	// Tables are read in one transaction to get a consistent copy.
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range backupTables {
+			rows := table.model()
+			if err := tx.Table(table.name).Unscoped().Find(rows).Error; err != nil {
+				return fmt.Errorf("reading %s: %w", table.name, err)
+			}
+			if err := encoder.Encode(rows); err != nil {
+				return fmt.Errorf("writing %s: %w", table.name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// ReadBackupHeader reads the header at the start of a backup.
+func ReadBackupHeader(r io.Reader) (BackupHeader, *gob.Decoder, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return BackupHeader{}, nil, fmt.Errorf("not a backup: %w", err)
+	}
+	decoder := gob.NewDecoder(zr)
+
+	var header BackupHeader
+	if err := decoder.Decode(&header); err != nil || header.Format != backupFormat {
+		return BackupHeader{}, nil, errors.New("not a backup of gopress")
+	}
+
+	return header, decoder, nil
+}
+
+// Restore reads a backup into an empty database whose schema is at
+// the same migration version as the backup. Rows keep their ids.
+func Restore(db *gorm.DB, r io.Reader, schema uint) error {
+	header, decoder, err := ReadBackupHeader(r)
+	if err != nil {
+		return err
+	}
+	if header.Schema != schema {
+		return fmt.Errorf("the backup has the schema version %d but the database has %d", header.Schema, schema)
+	}
+
+	for _, table := range backupTables {
+		var count int64
+		if err := db.Table(table.name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("%w, %s has %d rows", ErrNotEmpty, table.name, count)
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Hooks would hash the passwords again
+		// and relations are restored from their own tables.
+		tx = tx.Session(&gorm.Session{SkipHooks: true})
+
+		for _, table := range backupTables {
+			rows := table.model()
+			if err := decoder.Decode(rows); err != nil {
+				return fmt.Errorf("reading %s: %w", table.name, err)
+			}
+
+			if reflect.ValueOf(rows).Elem().Len() == 0 {
+				continue
+			}
+			if err := tx.Table(table.name).Omit(clause.Associations).CreateInBatches(rows, 100).Error; err != nil {
+				return fmt.Errorf("restoring %s: %w", table.name, err)
+			}
+
+			if users, ok := rows.(*[]models.User); ok {
+				if err := restoreInactive(tx, *users); err != nil {
+					return err
+				}
+			}
+		}
+
+		return resetSequences(tx)
+	})
+}
+
+// restoreInactive deactivates the users which are inactive in the
+// backup. Zero values of fields with a default are not inserted,
+// so they are restored as active.
+func restoreInactive(tx *gorm.DB, users []models.User) error {
+	var ids []uint
+	for _, user := range users {
+		if !user.IsActive {
+			ids = append(ids, user.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return tx.Table("users").Where("id IN (?)", ids).Update("is_active", false).Error
+}
+
+// resetSequences moves the id sequences of PostgreSQL after
+// the restored ids. Other databases do this by themselves.
+func resetSequences(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	for _, table := range backupTables {
+		if table.name == "post_tags" {
+			continue
+		}
+		if err := tx.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM "+
+			tx.Statement.Quote(table.name), table.name).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,360 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"github.com/nebisin/gopress/cache"
+	"github.com/nebisin/gopress/logging"
+	"github.com/nebisin/gopress/metrics"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/search"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"github.com/nebisin/gopress/utils/pagination"
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+// PostRepository is the repository of the posts,
+// which can read them through a cache.
+type PostRepository interface {
+	Save(p *models.Post) error
+	FindById(id uint) (models.Post, error)
+	FindByIdWithFields(id uint, fields fieldset.Fieldset) (models.Post, error)
+	UpdateById(post *models.Post, newPost models.Post) error
+	DeleteById(id uint) error
+	DeleteByIdAndVersion(id uint, version uint) error
+	Search(query search.Query, params pagination.Params) ([]search.Result, pagination.Meta, error)
+	Each(fn func(post models.Post) error) error
+	Reindex() error
+	FindMany(query PostQuery, params pagination.Params) ([]models.Post, pagination.Meta, error)
+	FindPostsByUserId(uid uint, query PostQuery, params pagination.Params) ([]models.Post, pagination.Meta, error)
+	FindMyPosts(uid uint, query PostQuery, params pagination.Params) ([]models.Post, pagination.Meta, error)
+	FindRecent(filter PostFilter, limit int) ([]models.Post, error)
+	SummarizeAll() error
+	FindTrashed(uid uint, params pagination.Params) ([]models.Post, pagination.Meta, error)
+	FindTrashedById(id uint) (models.Post, error)
+	Restore(post *models.Post) error
+	Purge(id uint) error
+	PurgeTrashedBefore(t time.Time) (int64, error)
+}
+
+// UserRepository is the repository of the users,
+// which can read them through a cache.
+type UserRepository interface {
+	Save(p *models.User) error
+	FindById(id uint) (models.User, error)
+	FindByIdWithFields(id uint, fields fieldset.Fieldset) (models.User, error)
+	UpdateById(value *models.User, newValue *models.User) error
+	SetAdmin(id uint, admin bool) error
+	SetLocked(id uint, locked bool) error
+	SetPassword(id uint, password string) error
+	DeleteById(id uint) error
+	FindMany(limit int) ([]models.User, error)
+	FindByEmailOrUsername(email string, username string) (models.User, error)
+}
+
+// Kinds of the cached values. Every value is cached under a key with
+// the generation of its kind, which is kept in the cache as well.
+// Changing the generation drops every value of the kind.
+const (
+	postsKind = "posts"
+	usersKind = "users"
+)
+
+// loadTimeout is how long a load shared by concurrent reads can take.
+const loadTimeout = 30 * time.Second
+
+// ReadCache keeps the posts and the users read by their id. Concurrent
+// reads of a missing value make a single query, whose result is shared.
+// The cache is shared by every repository made with it.
+type ReadCache struct {
+	store cache.Cache
+	ttl   time.Duration
+	group singleflight.Group
+}
+
+// NewReadCache returns a read cache keeping the values in store for ttl.
+// It returns nil, turning the cache off, if store is nil.
+func NewReadCache(store cache.Cache, ttl time.Duration) *ReadCache {
+	if store == nil {
+		return nil
+	}
+	return &ReadCache{store: store, ttl: ttl}
+}
+
+// InvalidatePosts drops every cached post. It is needed when something
+// loaded with the posts, like their featured media, is changed.
+func (c *ReadCache) InvalidatePosts(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	c.invalidate(ctx, postsKind)
+}
+
+// read decodes the value of key into v. The value is loaded and stored
+// if it is not in the cache. Errors of the cache are logged and the
+// value is loaded from the database instead. The load is shared by the
+// concurrent reads of the key, so it runs with the values of ctx but
+// is not stopped when ctx is done, only the read of ctx returns.
+func (c *ReadCache) read(ctx context.Context, kind string, key string, v interface{}, load func(ctx context.Context) (interface{}, error)) error {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).Warn("reading the cache failed", "key", key, "error", err)
+	}
+	if ok {
+		if err := decode(data, v); err == nil {
+			metrics.CacheLookups.WithLabelValues(kind, "hit").Inc()
+			return nil
+		}
+		logging.FromContext(ctx).Warn("cached value could not be decoded", "key", key, "error", err)
+	}
+	metrics.CacheLookups.WithLabelValues(kind, "miss").Inc()
+
+	loadCtx := detachedContext{parent: ctx}
+	results := c.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(loadCtx, loadTimeout)
+		defer cancel()
+
+		value, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := encode(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.store.Set(ctx, key, data, c.ttl); err != nil {
+			logging.FromContext(ctx).Warn("writing the cache failed", "key", key, "error", err)
+		}
+		return data, nil
+	})
+
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return result.Err
+		}
+		// Every caller decodes its own copy, so the value
+		// can be changed without affecting the others.
+		return decode(result.Val.([]byte), v)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// detachedContext keeps the values of its parent, like the span and the
+// logger of the request, but not its deadline and cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool)       { return time.Time{}, false }
+func (c detachedContext) Done() <-chan struct{}             { return nil }
+func (c detachedContext) Err() error                        { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// invalidate drops every cached value of the kind by making a new
+// generation. Changes call it after they are written, so a read which
+// missed the cache meanwhile may store the old value, but under the
+// old generation which is not read anymore.
+func (c *ReadCache) invalidate(ctx context.Context, kind string) {
+	if _, err := c.newGeneration(ctx, kind); err != nil {
+		logging.FromContext(ctx).Error("cached values could not be invalidated", "kind", kind, "error", err)
+	}
+}
+
+// key is the key of the value with given id in the current generation
+// of the kind. It must be made before the value is loaded.
+func (c *ReadCache) key(ctx context.Context, kind string, id uint) (string, error) {
+	generation, ok, err := c.store.Get(ctx, kind+":generation")
+	if err != nil {
+		return "", err
+	}
+	// A generation dropped from the cache is replaced with a new one
+	// so values cached before it can not be read again.
+	if !ok {
+		if generation, err = c.newGeneration(ctx, kind); err != nil {
+			return "", err
+		}
+	}
+
+	return kind + ":" + string(generation) + ":" + strconv.FormatUint(uint64(id), 10), nil
+}
+
+func (c *ReadCache) newGeneration(ctx context.Context, kind string) ([]byte, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	generation := []byte(hex.EncodeToString(b))
+
+	return generation, c.store.Set(ctx, kind+":generation", generation, 0)
+}
+
+// Values are encoded with gob since the JSON of the models
+// leaves out some of their fields, like the emails of users.
+
+func encode(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func decode(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// cachedPostRepository reads the posts by id through the cache
+// and drops them from the cache when one of them is changed.
+type cachedPostRepository struct {
+	*postRepository
+	cache *ReadCache
+}
+
+// NewCachedPostRepository returns a post repository reading through
+// the cache, or a plain one if the cache is nil.
+func NewCachedPostRepository(db *gorm.DB, c *ReadCache) PostRepository {
+	if c == nil {
+		return NewPostRepository(db)
+	}
+	return &cachedPostRepository{postRepository: NewPostRepository(db), cache: c}
+}
+
+func (r *cachedPostRepository) context() context.Context {
+	return r.db.Statement.Context
+}
+
+func (r *cachedPostRepository) FindById(id uint) (models.Post, error) {
+	ctx := r.context()
+	key, err := r.cache.key(ctx, postsKind, id)
+	if err != nil {
+		logging.FromContext(ctx).Warn("reading the cache failed", "error", err)
+		return r.postRepository.FindById(id)
+	}
+
+	var post models.Post
+	err = r.cache.read(ctx, "post", key, &post, func(ctx context.Context) (interface{}, error) {
+		return (&postRepository{db: r.db.WithContext(ctx), search: r.search}).FindById(id)
+	})
+	return post, err
+}
+
+// FindByIdWithFields method reads the post through the cache
+// when every field is asked, otherwise from the database.
+func (r *cachedPostRepository) FindByIdWithFields(id uint, fields fieldset.Fieldset) (models.Post, error) {
+	if fields.IsZero() {
+		return r.FindById(id)
+	}
+	return r.postRepository.FindByIdWithFields(id, fields)
+}
+
+func (r *cachedPostRepository) UpdateById(post *models.Post, newPost models.Post) error {
+	defer r.forget()
+	return r.postRepository.UpdateById(post, newPost)
+}
+
+func (r *cachedPostRepository) DeleteById(id uint) error {
+	defer r.forget()
+	return r.postRepository.DeleteById(id)
+}
+
+func (r *cachedPostRepository) DeleteByIdAndVersion(id uint, version uint) error {
+	defer r.forget()
+	return r.postRepository.DeleteByIdAndVersion(id, version)
+}
+
+func (r *cachedPostRepository) Restore(post *models.Post) error {
+	defer r.forget()
+	return r.postRepository.Restore(post)
+}
+
+func (r *cachedPostRepository) Purge(id uint) error {
+	defer r.forget()
+	return r.postRepository.Purge(id)
+}
+
+// forget drops the cached posts after a change of a post is written.
+func (r *cachedPostRepository) forget() {
+	r.cache.invalidate(r.context(), postsKind)
+}
+
+// cachedUserRepository reads the users by id through the cache
+// and drops them from the cache when one of them is changed. Since
+// posts are cached with their authors, they are dropped too.
+type cachedUserRepository struct {
+	*userRepository
+	cache *ReadCache
+}
+
+// NewCachedUserRepository returns a user repository reading through
+// the cache, or a plain one if the cache is nil.
+func NewCachedUserRepository(db *gorm.DB, c *ReadCache) UserRepository {
+	if c == nil {
+		return NewUserRepository(db)
+	}
+	return &cachedUserRepository{userRepository: NewUserRepository(db), cache: c}
+}
+
+func (r *cachedUserRepository) FindById(id uint) (models.User, error) {
+	ctx := r.db.Statement.Context
+	key, err := r.cache.key(ctx, usersKind, id)
+	if err != nil {
+		logging.FromContext(ctx).Warn("reading the cache failed", "error", err)
+		return r.userRepository.FindById(id)
+	}
+
+	var user models.User
+	err = r.cache.read(ctx, "user", key, &user, func(ctx context.Context) (interface{}, error) {
+		return userRepository{db: r.db.WithContext(ctx)}.FindById(id)
+	})
+	return user, err
+}
+
+// FindByIdWithFields method reads the user through the cache
+// when every field is asked, otherwise from the database.
+func (r *cachedUserRepository) FindByIdWithFields(id uint, fields fieldset.Fieldset) (models.User, error) {
+	if fields.IsZero() {
+		return r.FindById(id)
+	}
+	return r.userRepository.FindByIdWithFields(id, fields)
+}
+
+func (r *cachedUserRepository) UpdateById(value *models.User, newValue *models.User) error {
+	defer r.forget()
+	return r.userRepository.UpdateById(value, newValue)
+}
+
+func (r *cachedUserRepository) SetAdmin(id uint, admin bool) error {
+	defer r.forget()
+	return r.userRepository.SetAdmin(id, admin)
+}
+
+func (r *cachedUserRepository) SetLocked(id uint, locked bool) error {
+	defer r.forget()
+	return r.userRepository.SetLocked(id, locked)
+}
+
+func (r *cachedUserRepository) SetPassword(id uint, password string) error {
+	defer r.forget()
+	return r.userRepository.SetPassword(id, password)
+}
+
+func (r *cachedUserRepository) DeleteById(id uint) error {
+	defer r.forget()
+	return r.userRepository.DeleteById(id)
+}
+
+// forget drops the cached users and posts
+// after a change of a user is written.
+func (r *cachedUserRepository) forget() {
+	ctx := r.db.Statement.Context
+	r.cache.invalidate(ctx, usersKind)
+	r.cache.invalidate(ctx, postsKind)
+}
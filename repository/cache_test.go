@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"github.com/nebisin/gopress/cache"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type contextKey struct{}
+
+func TestReadCacheCancelledCaller(t *testing.T) {
+	c := NewReadCache(cache.NewMemory(10), time.Minute)
+
+	var loads int32
+	var once sync.Once
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loadErrs := make(chan error, 1)
+	load := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		once.Do(func() { close(started) })
+		<-release
+		loadErrs <- ctx.Err()
+		if ctx.Value(contextKey{}) != "first" {
+			t.Errorf("the load does not have the values of the first caller")
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("the load has no timeout")
+		}
+		return "value", nil
+	}
+
+	first, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey{}, "first"))
+	firstErr := make(chan error, 1)
+	go func() {
+		var v string
+		firstErr <- c.read(first, "post", "post:1", &v, load)
+	}()
+	<-started
+
+	second := make(chan error, 1)
+	var secondValue string
+	go func() {
+		second <- c.read(context.Background(), "post", "post:1", &secondValue, load)
+	}()
+
+	cancel()
+	select {
+	case err := <-firstErr:
+		if err != context.Canceled {
+			t.Errorf("read of the cancelled caller = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the read of the cancelled caller did not return")
+	}
+
+	// The second caller waits for the load started by the first one.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-second; err != nil || secondValue != "value" {
+		t.Errorf("read of the second caller = %q, %v, want value", secondValue, err)
+	}
+	if err := <-loadErrs; err != nil {
+		t.Errorf("the load is cancelled with the first caller: %v", err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("value is loaded %d times, want 1", n)
+	}
+
+	var cached string
+	if err := c.read(context.Background(), "post", "post:1", &cached, load); err != nil || cached != "value" {
+		t.Errorf("cached value = %q, %v", cached, err)
+	}
+}
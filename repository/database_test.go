@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/database"
+	"github.com/nebisin/gopress/migrations"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/search"
+	"github.com/nebisin/gopress/utils/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The tests of this file run the queries on real databases. SQLite
+// runs in a temporary file, PostgreSQL and MySQL when their DSN is set
+// in GOPRESS_TEST_POSTGRES_DSN and GOPRESS_TEST_MYSQL_DSN, like
+//
+//	GOPRESS_TEST_POSTGRES_DSN="host=localhost user=gopress dbname=gopress_test" go test ./repository
+//
+// Every table of those databases is dropped by the tests.
+func forEachDatabase(t *testing.T, test func(t *testing.T, db *gorm.DB)) {
+	configs := []database.Config{
+		{Driver: database.SQLite, DSN: filepath.Join(t.TempDir(), "test.db")},
+	}
+	if dsn := os.Getenv("GOPRESS_TEST_POSTGRES_DSN"); dsn != "" {
+		configs = append(configs, database.Config{Driver: database.Postgres, DSN: dsn})
+	}
+	if dsn := os.Getenv("GOPRESS_TEST_MYSQL_DSN"); dsn != "" {
+		configs = append(configs, database.Config{Driver: database.MySQL, DSN: dsn})
+	}
+
+	for _, config := range configs {
+		config := config
+		t.Run(config.Driver, func(t *testing.T) {
+			db, err := database.Open(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Some of the queries fail on purpose.
+			db.Logger = logger.Default.LogMode(logger.Silent)
+			sqlDB, err := db.DB()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sqlDB.Close()
+
+			// Rolling back every migration first
+			// leaves no rows of an earlier run.
+			migrator, err := migrations.New(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := migrator.To(0); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := migrator.Up(); err != nil {
+				t.Fatal(err)
+			}
+			if err := search.Register(db); err != nil {
+				t.Fatal(err)
+			}
+
+			test(t, db)
+		})
+	}
+}
+
+func createUser(t *testing.T, db *gorm.DB, username string) models.User {
+	t.Helper()
+
+	user := models.User{Email: username + "@example.com", Username: username, Password: "password"}
+	if err := NewUserRepository(db).Save(&user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createPost(t *testing.T, db *gorm.DB, post models.Post) models.Post {
+	t.Helper()
+
+	if err := NewPostRepository(db).Save(&post); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+func TestMigrations(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		migrator, err := migrations.New(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if version, err := migrator.Version(); err != nil || version != migrator.Latest() {
+			t.Fatalf("version = %d, %v, want %d", version, err, migrator.Latest())
+		}
+
+		// The first migration is the schema before migrations
+		// existed, the later ones update its rows.
+		if _, err := migrator.To(1); err != nil {
+			t.Fatal(err)
+		}
+		if db.Migrator().HasTable("tags") || db.Exec("SELECT is_admin FROM users").Error == nil {
+			t.Error("the schema is not rolled back to the first migration")
+		}
+		err = db.Exec("INSERT INTO users (email, username, password, is_active, is_locked) VALUES (?, ?, ?, ?, ?)",
+			"old@example.com", "old", "hash", true, false).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err := migrator.Up(); err != nil || n != int(migrator.Latest())-1 {
+			t.Fatalf("Up = %d, %v", n, err)
+		}
+		user, err := NewUserRepository(db).FindByEmailOrUsername("old@example.com", "")
+		if err != nil || user.Username != "old" || user.IsAdmin || user.TokenVersion != 0 {
+			t.Errorf("user = %+v, %v", user, err)
+		}
+	})
+}
+
+func TestDuplicateColumn(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		users := NewUserRepository(db)
+		createUser(t, db, "ann")
+
+		err := users.Save(&models.User{Email: "ann@example.com", Username: "other", Password: "password"})
+		if err != ErrDuplicateEmail {
+			t.Errorf("error of a taken email = %v", err)
+		}
+		err = users.Save(&models.User{Email: "other@example.com", Username: "ann", Password: "password"})
+		if err != ErrDuplicateUsername {
+			t.Errorf("error of a taken username = %v", err)
+		}
+
+		if err := db.Create(&models.Tag{Name: "go"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		err = db.Create(&models.Tag{Name: "go"}).Error
+		if column := duplicateColumn(err); column != "name" {
+			t.Errorf("column of %v = %q, want name", err, column)
+		}
+
+		// Other errors have no column.
+		err = db.Exec("INSERT INTO posts (title, author_id) VALUES (NULL, 1)").Error
+		if err == nil {
+			t.Fatal("a post without a title is inserted")
+		}
+		if column := duplicateColumn(err); column != "" {
+			t.Errorf("column of %v = %q, want none", err, column)
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		ann := createUser(t, db, "ann")
+		bob := createUser(t, db, "bob")
+
+		titled := createPost(t, db, models.Post{
+			Title: "Gardening notes", Body: "Tomatoes need a lot of sunlight.",
+			AuthorID: &ann.ID, IsPublished: true, Tags: models.NamesToTags([]string{"garden"}),
+		})
+		mentioned := createPost(t, db, models.Post{
+			Title: "Cooking", Body: "Gardening gives the best tomatoes for the kitchen.",
+			AuthorID: &bob.ID, IsPublished: true,
+		})
+		createPost(t, db, models.Post{Title: "Gardening draft", Body: "Not published yet.", AuthorID: &ann.ID})
+		createPost(t, db, models.Post{Title: "Travel", Body: "Trains and boats.", AuthorID: &ann.ID, IsPublished: true})
+
+		posts := NewPostRepository(db)
+		params := pagination.Params{Page: 1, PerPage: 10}
+		ids := func(query search.Query) []uint {
+			t.Helper()
+			results, _, err := posts.Search(query, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make([]uint, len(results))
+			for i, result := range results {
+				ids[i] = result.Post.ID
+				if !strings.Contains(result.Snippet, "<mark>") {
+					t.Errorf("snippet %q has no highlight", result.Snippet)
+				}
+			}
+			return ids
+		}
+
+		tests := []struct {
+			query search.Query
+			want  []uint
+		}{
+			// Title matches rank higher.
+			{search.Query{Terms: "gardening"}, []uint{titled.ID, mentioned.ID}},
+			{search.Query{Terms: "garden*"}, []uint{titled.ID, mentioned.ID}},
+			{search.Query{Terms: "gardening tomatoes kitchen"}, []uint{mentioned.ID}},
+			{search.Query{Terms: "gardening", AuthorID: bob.ID}, []uint{mentioned.ID}},
+			{search.Query{Terms: "gardening", Tag: "garden"}, []uint{titled.ID}},
+			{search.Query{Terms: "submarine"}, []uint{}},
+		}
+		for _, test := range tests {
+			if got := ids(test.query); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("search %+v = %v, want %v", test.query, got, test.want)
+			}
+		}
+
+		// Changed and deleted posts are found by their new content.
+		if err := posts.UpdateById(&mentioned, models.Post{Title: "Cooking", Body: "Soups and stews.", IsPublished: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := posts.DeleteById(titled.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(search.Query{Terms: "gardening"}); len(got) != 0 {
+			t.Errorf("search after the changes = %v, want none", got)
+		}
+		if got := ids(search.Query{Terms: "stews"}); !reflect.DeepEqual(got, []uint{mentioned.ID}) {
+			t.Errorf("search of the new body = %v, want %v", got, []uint{mentioned.ID})
+		}
+	})
+}
+
+// Searches are filtered by the publication time like the post lists,
+// so a post drafted before the range and published in it is found.
+func TestSearchDates(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		ann := createUser(t, db, "ann")
+
+		date := func(s string) time.Time {
+			at, err := time.Parse("2006-01-02", s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return at
+		}
+		published := date("2021-05-10")
+		drafted := createPost(t, db, models.Post{
+			Title: "Gardening in May", Body: "Drafted in March.", AuthorID: &ann.ID, IsPublished: true, PublishedAt: &published,
+		})
+		old := createPost(t, db, models.Post{Title: "Gardening before", Body: "Published long ago.", AuthorID: &ann.ID, IsPublished: true})
+		for id, values := range map[uint]map[string]interface{}{
+			drafted.ID: {"created_at": date("2021-03-01")},
+			old.ID:     {"created_at": date("2020-01-01"), "published_at": nil},
+		} {
+			if err := db.Model(&models.Post{}).Where("id = ?", id).UpdateColumns(values).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			from, to string
+			want     []uint
+		}{
+			{"2021-05-01", "2021-06-01", []uint{drafted.ID}},
+			{"2021-03-01", "2021-04-01", []uint{}},
+			{"2019-12-01", "2020-02-01", []uint{old.ID}},
+		}
+
+		posts := NewPostRepository(db)
+		for _, test := range tests {
+			query := search.Query{Terms: "gardening", From: date(test.from), To: date(test.to)}
+			results, _, err := posts.Search(query, pagination.Params{Page: 1, PerPage: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := []uint{}
+			for _, result := range results {
+				ids = append(ids, result.Post.ID)
+			}
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("search from %s to %s = %v, want %v", test.from, test.to, ids, test.want)
+			}
+
+			list, _, err := posts.FindMany(PostQuery{Filter: PostFilter{From: query.From, To: query.To}}, pagination.Params{Page: 1, PerPage: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(list) != len(test.want) {
+				t.Errorf("posts from %s to %s = %d, want %d", test.from, test.to, len(list), len(test.want))
+			}
+		}
+	})
+}
+
+func TestPostFilters(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		ann := createUser(t, db, "ann")
+
+		published := func(s string) *time.Time {
+			at, err := time.Parse("2006-01-02", s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return &at
+		}
+		createPost(t, db, models.Post{Title: "100%_done plan", Body: "body", AuthorID: &ann.ID, IsPublished: true, PublishedAt: published("2020-03-01")})
+		createPost(t, db, models.Post{Title: "1000 done", Body: "body", AuthorID: &ann.ID, IsPublished: true, PublishedAt: published("2020-06-01")})
+		createPost(t, db, models.Post{Title: "Plan B!", Body: "body", AuthorID: &ann.ID, IsPublished: true, PublishedAt: published("2021-01-01")})
+		// A post without a publication time is filtered by its creation time.
+		old := createPost(t, db, models.Post{Title: "Old draft", Body: "body", AuthorID: &ann.ID})
+		err := db.Model(&models.Post{}).Where("id = ?", old.ID).
+			UpdateColumn("created_at", *published("2019-05-01")).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		posts := NewPostRepository(db)
+		tests := []struct {
+			filter PostFilter
+			want   []string
+		}{
+			// Wildcards of LIKE are matched literally.
+			{PostFilter{TitleContains: "0%_d"}, []string{"100%_done plan"}},
+			{PostFilter{TitleContains: "%"}, []string{"100%_done plan"}},
+			{PostFilter{TitleContains: "b!"}, []string{"Plan B!"}},
+			{PostFilter{TitleContains: "PLAN"}, []string{"100%_done plan", "Plan B!"}},
+			{PostFilter{From: *published("2020-04-01"), To: *published("2021-01-02")}, []string{"1000 done", "Plan B!"}},
+			{PostFilter{To: *published("2020-01-01"), Status: StatusAll}, []string{"Old draft"}},
+		}
+		for _, test := range tests {
+			found, _, err := posts.FindMany(PostQuery{Filter: test.filter}, pagination.Params{Page: 1, PerPage: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			titles := []string{}
+			for _, post := range found {
+				titles = append(titles, post.Title)
+			}
+			sort.Strings(titles)
+			if !reflect.DeepEqual(titles, test.want) {
+				t.Errorf("posts of %+v = %q, want %q", test.filter, titles, test.want)
+			}
+		}
+	})
+}
+
+func TestMediaQuota(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		ann := createUser(t, db, "ann")
+		media := NewMediaRepository(db)
+
+		if usage, err := media.UsageByOwner(ann.ID); err != nil || usage != 0 {
+			t.Fatalf("usage without media = %d, %v", usage, err)
+		}
+
+		for i, want := range []error{nil, nil, ErrQuotaExceeded} {
+			err := media.SaveWithinQuota(&models.Media{
+				OwnerID: ann.ID, ContentType: "text/plain", Size: 400, StorageKey: "key" + string(rune('a'+i)),
+			}, 1000)
+			if !errors.Is(err, want) {
+				t.Errorf("upload %d: error %v, want %v", i, err, want)
+			}
+		}
+
+		if usage, err := media.UsageByOwner(ann.ID); err != nil || usage != 800 {
+			t.Errorf("usage = %d, %v, want 800", usage, err)
+		}
+	})
+}
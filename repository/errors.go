@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+var (
+	ErrDuplicateEmail    = errors.New("email is already taken")
+	ErrDuplicateUsername = errors.New("username is already taken")
+)
+
+// duplicateColumn returns the column of the unique constraint
+// violated by a failed insert or update. It returns an empty
+// string if the query failed for another reason.
+func duplicateColumn(err error) string {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		// UNIQUE constraint failed: users.email
+		message := sqliteErr.Error()
+		if i := strings.Index(message, ": "); i >= 0 {
+			return column(strings.Split(message[i+2:], ", ")[0])
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		// Key (email)=(someone@example.com) already exists.
+		detail := strings.TrimPrefix(pgErr.Detail, "Key (")
+		if i := strings.Index(detail, ")="); i >= 0 {
+			return detail[:i]
+		}
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+		// Duplicate entry 'someone@example.com' for key 'users.email'
+		message := strings.TrimSuffix(mysqlErr.Message, "'")
+		if i := strings.LastIndex(message, "'"); i >= 0 {
+			return column(message[i+1:])
+		}
+	}
+
+	return ""
+}
+
+// column removes the table name from a column name.
+func column(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// userError maps the errors of the queries writing users.
+func userError(err error) error {
+	switch duplicateColumn(err) {
+	case "email":
+		return ErrDuplicateEmail
+	case "username":
+		return ErrDuplicateUsername
+	}
+
+	return err
+}
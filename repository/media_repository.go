@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/utils/pagination"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+var ErrQuotaExceeded = errors.New("the file does not fit into your storage quota")
+
+type mediaRepository struct {
+	db *gorm.DB
+}
+
+func NewMediaRepository(db *gorm.DB) *mediaRepository {
+	return &mediaRepository{db: db}
+}
+
+// Save method creates a new media record.
+func (r *mediaRepository) Save(media *models.Media) error {
+	r, span := r.trace("Save")
+	defer span.End()
+
+	return r.db.Create(media).Error
+}
+
+// SaveWithinQuota method creates a new media record if the media of
+// the owner do not take more than quota bytes with it. The usage is
+// checked in the same transaction, so concurrent uploads of the owner
+// can not go over the quota together.
+func (r *mediaRepository) SaveWithinQuota(media *models.Media, quota int64) error {
+	r, span := r.trace("SaveWithinQuota")
+	defer span.End()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Writing the row of the owner locks it until the end of
+		// the transaction, so uploads of the owner wait each other.
+		// It works on SQLite too, which can not lock with SELECT.
+		err := tx.Model(&models.User{}).
+			Where("id = ?", media.OwnerID).
+			UpdateColumn("updated_at", gorm.Expr("updated_at")).Error
+		if err != nil {
+			return err
+		}
+
+		usage, err := (&mediaRepository{db: tx}).UsageByOwner(media.OwnerID)
+		if err != nil {
+			return err
+		}
+		if usage+media.Size > quota {
+			return ErrQuotaExceeded
+		}
+
+		return tx.Create(media).Error
+	})
+}
+
+// FindById method finds a media by it's id.
+func (r *mediaRepository) FindById(id uint) (models.Media, error) {
+	r, span := r.trace("FindById")
+	defer span.End()
+
+	var media models.Media
+	if err := r.db.Preload("Variants", orderById).First(&media, id).Error; err != nil {
+		return models.Media{}, err
+	}
+
+	return media, nil
+}
+
+// FindByOwner method gets one page of users media starting with the
+// latest uploads. Cursors point to a position in the list.
+func (r *mediaRepository) FindByOwner(uid uint, params pagination.Params) ([]models.Media, pagination.Meta, error) {
+	r, span := r.trace("FindByOwner")
+	defer span.End()
+
+	offset := params.Offset()
+	if params.Cursor != nil {
+		var err error
+		if offset, err = strconv.Atoi(params.Cursor.Values[0]); err != nil || offset < 0 {
+			return nil, pagination.Meta{}, pagination.ErrInvalidCursor
+		}
+	}
+
+	tx := r.db.Model(&models.Media{}).Where("owner_id = ?", uid)
+
+	meta := pagination.Meta{Page: params.Page, PerPage: params.PerPage}
+	if params.Cursor == nil {
+		var total int64
+		if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return nil, pagination.Meta{}, err
+		}
+		meta.SetTotal(total)
+	}
+
+	var media []models.Media
+	err := tx.Preload("Variants", orderById).Order("id desc").Offset(offset).Limit(params.PerPage + 1).Find(&media).Error
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+
+	if len(media) > params.PerPage {
+		media = media[:params.PerPage]
+		meta.NextCursor = offsetCursor(offset+params.PerPage, false)
+	}
+	if offset > 0 {
+		prev := offset - params.PerPage
+		if prev < 0 {
+			prev = 0
+		}
+		meta.PrevCursor = offsetCursor(prev, true)
+	}
+
+	return media, meta, nil
+}
+
+// UsageByOwner method returns the total size of users media in bytes.
+func (r *mediaRepository) UsageByOwner(uid uint) (int64, error) {
+	r, span := r.trace("UsageByOwner")
+	defer span.End()
+
+	var usage int64
+	err := r.db.Model(&models.Media{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("owner_id = ?", uid).
+		Row().Scan(&usage)
+
+	return usage, err
+}
+
+// FindPending method gets the oldest media waiting to be processed.
+func (r *mediaRepository) FindPending(limit int) ([]models.Media, error) {
+	r, span := r.trace("FindPending")
+	defer span.End()
+
+	var media []models.Media
+	err := r.db.Where("status = ?", models.MediaProcessing).Order("id").Limit(limit).Find(&media).Error
+
+	return media, err
+}
+
+// SaveProcessed method stores the results of processing an image
+// replacing the variants it had before and marks it ready.
+func (r *mediaRepository) SaveProcessed(media *models.Media) error {
+	r, span := r.trace("SaveProcessed")
+	defer span.End()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", media.ID).Delete(&models.MediaVariant{}).Error; err != nil {
+			return err
+		}
+
+		for i := range media.Variants {
+			media.Variants[i].MediaID = media.ID
+		}
+		if len(media.Variants) > 0 {
+			if err := tx.Create(&media.Variants).Error; err != nil {
+				return err
+			}
+		}
+
+		media.Status = models.MediaReady
+		return tx.Model(media).
+			Select("Width", "Height", "Blurhash", "Status", "UpdatedAt").
+			Updates(media).Error
+	})
+}
+
+// MarkFailed method marks a media which could not be processed.
+func (r *mediaRepository) MarkFailed(id uint) error {
+	r, span := r.trace("MarkFailed")
+	defer span.End()
+
+	return r.db.Model(&models.Media{}).Where("id = ?", id).Update("status", models.MediaFailed).Error
+}
+
+// DeleteById method removes the media record and it's variants for
+// good since the contents are removed from the storage along with them.
+// Posts featuring the media are left without a featured media.
+func (r *mediaRepository) DeleteById(id uint) error {
+	r, span := r.trace("DeleteById")
+	defer span.End()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("media_id = ?", id).Delete(&models.MediaVariant{}).Error; err != nil {
+			return err
+		}
+
+		// Posts featuring the media lose it, which is a new version of them.
+		err := tx.Unscoped().Model(&models.Post{}).
+			Where("featured_media_id = ?", id).
+			UpdateColumns(map[string]interface{}{
+				"featured_media_id": nil,
+				"version":           gorm.Expr("version + 1"),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(&models.Media{}, id).Error
+	})
+}
+
+// orderById keeps the variants of media in the order they are configured.
+func orderById(tx *gorm.DB) *gorm.DB {
+	return tx.Order("id")
+}
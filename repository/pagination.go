@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/utils/pagination"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortKey is one column of the order used for paginating posts.
+// It knows how to put the value of a post into a cursor
+// and how to read it back for the keyset query.
+type sortKey struct {
+	column string
+	desc   bool
+	value  func(post models.Post) string
+	parse  func(value string) (interface{}, error)
+}
+
+// keyset is an order of posts which can be used for cursor pagination.
+// Its last key must be unique so every post has a distinct position.
+type keyset []sortKey
+
+var (
+	idKey = sortKey{
+		column: "posts.id",
+		desc:   true,
+		value: func(post models.Post) string {
+			return strconv.FormatUint(uint64(post.ID), 10)
+		},
+		parse: func(value string) (interface{}, error) {
+			return strconv.ParseUint(value, 10, 64)
+		},
+	}
+
+	createdAtKey = sortKey{
+		column: "posts.created_at",
+		desc:   true,
+		value: func(post models.Post) string {
+			return post.CreatedAt.Format(time.RFC3339Nano)
+		},
+		parse: parseTime,
+	}
+
+	deletedAtKey = sortKey{
+		column: "posts.deleted_at",
+		desc:   true,
+		value: func(post models.Post) string {
+			return post.DeletedAt.Time.Format(time.RFC3339Nano)
+		},
+		parse: parseTime,
+	}
+
+	// newestFirst is the default order of the post lists.
+	newestFirst = keyset{createdAtKey, idKey}
+
+	// lastDeletedFirst is the order of the trash.
+	lastDeletedFirst = keyset{deletedAtKey, idKey}
+)
+
+func parseTime(value string) (interface{}, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// offsetCursor makes a cursor for the lists which can only
+// be paginated by offset, like the search results.
+func offsetCursor(offset int, before bool) string {
+	return pagination.Cursor{Values: []string{strconv.Itoa(offset)}, Before: before}.Encode()
+}
+
+// order returns the ORDER BY clause of the keyset.
+// It is reversed while going back to the previous page.
+func (keys keyset) order(reverse bool) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		desc := key.desc != reverse
+		if desc {
+			parts[i] = key.column + " DESC"
+		} else {
+			parts[i] = key.column + " ASC"
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// cursor makes the cursor pointing to given post.
+func (keys keyset) cursor(post models.Post, before bool) string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = key.value(post)
+	}
+
+	return pagination.Cursor{Values: values, Before: before}.Encode()
+}
+
+// after restricts the query to the posts coming after the cursor
+// in the keyset order, or before it when the cursor goes back.
+// For keys a, b and c it builds:
+//
+//	a > ? OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c > ?)
+func (keys keyset) after(tx *gorm.DB, cursor *pagination.Cursor) (*gorm.DB, error) {
+	if len(cursor.Values) != len(keys) {
+		return nil, pagination.ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		value, err := key.parse(cursor.Values[i])
+		if err != nil {
+			return nil, pagination.ErrInvalidCursor
+		}
+		values[i] = value
+	}
+
+	var conditions []string
+	var args []interface{}
+	for i, key := range keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, keys[j].column+" = ?")
+			args = append(args, values[j])
+		}
+
+		op := ">"
+		if key.desc != cursor.Before {
+			op = "<"
+		}
+		parts = append(parts, key.column+" "+op+" ?")
+		args = append(args, values[i])
+
+		conditions = append(conditions, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return tx.Where("("+strings.Join(conditions, " OR ")+")", args...), nil
+}
+
+// columns returns the columns of the keys which are not expressions.
+// They have to be loaded to make the cursors.
+func (keys keyset) columns() []string {
+	var columns []string
+	for _, key := range keys {
+		if !strings.Contains(key.column, "(") {
+			columns = append(columns, strings.TrimPrefix(key.column, "posts."))
+		}
+	}
+
+	return columns
+}
+
+// findPage method loads one page of the posts matched by tx
+// ordered by the keyset and returns the page with its metadata.
+// The load scope chooses the columns and the relations loaded.
+// Offset pagination also counts all the matching posts.
+func findPage(tx *gorm.DB, load func(*gorm.DB) *gorm.DB, keys keyset, params pagination.Params) ([]models.Post, pagination.Meta, error) {
+	base := tx.Session(&gorm.Session{})
+	meta := pagination.Meta{Page: params.Page, PerPage: params.PerPage}
+
+	if params.Cursor == nil {
+		var total int64
+		if err := base.Model(&models.Post{}).Count(&total).Error; err != nil {
+			return nil, pagination.Meta{}, err
+		}
+		meta.SetTotal(total)
+	}
+
+	before := params.Cursor != nil && params.Cursor.Before
+	query := base.Scopes(load).Order(keys.order(before)).Limit(params.PerPage + 1)
+	if params.Cursor != nil {
+		var err error
+		if query, err = keys.after(query, params.Cursor); err != nil {
+			return nil, pagination.Meta{}, err
+		}
+	} else {
+		query = query.Offset(params.Offset())
+	}
+
+	var posts []models.Post
+	if err := query.Find(&posts).Error; err != nil {
+		return nil, pagination.Meta{}, err
+	}
+
+	more := len(posts) > params.PerPage
+	if more {
+		posts = posts[:params.PerPage]
+	}
+
+	if before {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
+
+	hasNext := more || before
+	hasPrev := params.Page > 1 || (params.Cursor != nil && (!before || more))
+
+	if len(posts) > 0 {
+		if hasNext {
+			meta.NextCursor = keys.cursor(posts[len(posts)-1], false)
+		}
+		if hasPrev {
+			meta.PrevCursor = keys.cursor(posts[0], true)
+		}
+	}
+
+	return posts, meta, nil
+}
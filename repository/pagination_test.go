@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/utils/pagination"
+	"gorm.io/gorm"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// walk pages through the whole list with the next cursors and back
+// with the prev cursors. It returns the ids of the pages in both
+// directions, the pages going back are in the order they are read.
+func walk(t *testing.T, find func(pagination.Params) ([]models.Post, pagination.Meta, error), perPage int) (forward, back [][]uint) {
+	t.Helper()
+
+	pageIDs := func(posts []models.Post) []uint {
+		ids := make([]uint, len(posts))
+		for i, post := range posts {
+			ids[i] = post.ID
+		}
+		return ids
+	}
+
+	posts, meta, err := find(pagination.Params{Page: 1, PerPage: perPage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.PrevCursor != "" {
+		t.Error("the first page has a prev cursor")
+	}
+	forward = append(forward, pageIDs(posts))
+
+	for meta.NextCursor != "" {
+		cursor, err := pagination.DecodeCursor(meta.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if posts, meta, err = find(pagination.Params{PerPage: perPage, Cursor: cursor}); err != nil {
+			t.Fatal(err)
+		}
+		if meta.PrevCursor == "" {
+			t.Errorf("page %d has no prev cursor", len(forward)+1)
+		}
+		forward = append(forward, pageIDs(posts))
+		if len(forward) > 10 {
+			t.Fatal("the next cursors do not end")
+		}
+	}
+
+	for meta.PrevCursor != "" {
+		cursor, err := pagination.DecodeCursor(meta.PrevCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if posts, meta, err = find(pagination.Params{PerPage: perPage, Cursor: cursor}); err != nil {
+			t.Fatal(err)
+		}
+		if meta.NextCursor == "" {
+			t.Errorf("page %d going back has no next cursor", len(back)+1)
+		}
+		back = append(back, pageIDs(posts))
+		if len(back) > 10 {
+			t.Fatal("the prev cursors do not end")
+		}
+	}
+
+	return forward, back
+}
+
+func TestCursorPagination(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		ann := createUser(t, db, "ann")
+
+		// The posts 2 to 4 are created at the same time
+		// and have the same title, so their ids set the order.
+		created := time.Date(2021, 5, 1, 10, 0, 0, 0, time.UTC)
+		var ids []uint
+		for i, title := range []string{"ccc", "aaa", "aaa", "aaa", "bbb"} {
+			post := createPost(t, db, models.Post{Title: title, Body: "body", AuthorID: &ann.ID, IsPublished: true})
+			at := created.Add(time.Duration(i) * time.Hour)
+			if i >= 1 && i <= 3 {
+				at = created.Add(time.Hour)
+			}
+			err := db.Model(&models.Post{}).Where("id = ?", post.ID).UpdateColumn("created_at", at).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, post.ID)
+		}
+
+		tests := []struct {
+			sort    []PostSort
+			forward [][]uint
+		}{
+			{
+				nil,
+				[][]uint{{ids[4], ids[3]}, {ids[2], ids[1]}, {ids[0]}},
+			},
+			{
+				[]PostSort{{Field: "title"}},
+				[][]uint{{ids[1], ids[2]}, {ids[3], ids[4]}, {ids[0]}},
+			},
+			{
+				[]PostSort{{Field: "title", Desc: true}, {Field: "created_at"}},
+				[][]uint{{ids[0], ids[4]}, {ids[3], ids[2]}, {ids[1]}},
+			},
+		}
+
+		posts := NewPostRepository(db)
+		for _, test := range tests {
+			find := func(params pagination.Params) ([]models.Post, pagination.Meta, error) {
+				return posts.FindMany(PostQuery{Sort: test.sort}, params)
+			}
+			forward, back := walk(t, find, 2)
+			if !reflect.DeepEqual(forward, test.forward) {
+				t.Errorf("pages sorted by %+v = %v, want %v", test.sort, forward, test.forward)
+			}
+			// Going back from the last page gives the
+			// earlier pages again, in the same order.
+			want := [][]uint{test.forward[1], test.forward[0]}
+			if !reflect.DeepEqual(back, want) {
+				t.Errorf("pages back sorted by %+v = %v, want %v", test.sort, back, want)
+			}
+		}
+	})
+}
+
+func TestCursorPaginationErrors(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		posts := NewPostRepository(db)
+
+		tests := []struct {
+			sort   []PostSort
+			values []string
+		}{
+			{nil, []string{"1"}},
+			{nil, []string{"yesterday", "1"}},
+			{nil, []string{time.Now().Format(time.RFC3339Nano), "one"}},
+			{[]PostSort{{Field: "title"}}, []string{"a", "b", "1"}},
+		}
+
+		for _, test := range tests {
+			params := pagination.Params{PerPage: 10, Cursor: &pagination.Cursor{Values: test.values}}
+			_, _, err := posts.FindMany(PostQuery{Sort: test.sort}, params)
+			if !errors.Is(err, pagination.ErrInvalidCursor) {
+				t.Errorf("cursor %q sorted by %+v: error %v, want %v", test.values, test.sort, err, pagination.ErrInvalidCursor)
+			}
+		}
+	})
+}
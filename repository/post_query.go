@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/search"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"github.com/nebisin/gopress/utils/pagination"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Post statuses which can be used for filtering own posts.
+const (
+	StatusPublished = "published"
+	StatusDraft     = "draft"
+	StatusAll       = "all"
+)
+
+// PostQuery is the filters, the order and the fields of a post list.
+type PostQuery struct {
+	Filter PostFilter
+	Sort   []PostSort
+	Fields fieldset.Fieldset
+	// Summary leaves out the body of the posts
+	// unless it is asked in the fields.
+	Summary bool
+}
+
+// PostFilter narrows down a post list.
+// Zero values of the fields are ignored.
+type PostFilter struct {
+	AuthorID      uint
+	Tag           string
+	From          time.Time
+	To            time.Time
+	TitleContains string
+	Status        string
+}
+
+// PostSort is one field of the order of a post list.
+type PostSort struct {
+	Field string
+	Desc  bool
+}
+
+// postSortKeys are the fields posts can be sorted by.
+// Only these columns ever end up in the ORDER BY clause.
+var postSortKeys = map[string]sortKey{
+	"created_at": createdAtKey,
+	"updated_at": {
+		column: "posts.updated_at",
+		value: func(post models.Post) string {
+			return post.UpdatedAt.Format(time.RFC3339Nano)
+		},
+		parse: parseTime,
+	},
+	"published_at": {
+		column: publishedAtColumn,
+		value: func(post models.Post) string {
+			if post.PublishedAt == nil {
+				return post.CreatedAt.Format(time.RFC3339Nano)
+			}
+			return post.PublishedAt.Format(time.RFC3339Nano)
+		},
+		parse: parseTime,
+	},
+	"title": {
+		column: "posts.title",
+		value: func(post models.Post) string {
+			return post.Title
+		},
+		parse: func(value string) (interface{}, error) {
+			return value, nil
+		},
+	},
+}
+
+// publishedAtColumn is the publication time of the posts,
+// the same the searches are filtered by.
+const publishedAtColumn = search.PublishedAtColumn
+
+// ParsePostSort parses a comma separated list of sort fields.
+// Fields are ascending unless they are prefixed with a minus sign.
+func ParsePostSort(value string) ([]PostSort, error) {
+	var sorts []PostSort
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		sort := PostSort{Field: field}
+		if strings.HasPrefix(field, "-") {
+			sort = PostSort{Field: field[1:], Desc: true}
+		}
+
+		if _, ok := postSortKeys[sort.Field]; !ok {
+			return nil, errors.New("posts can not be sorted by " + sort.Field)
+		}
+		sorts = append(sorts, sort)
+	}
+
+	return sorts, nil
+}
+
+// keyset builds the order of the query. The id of the posts
+// is always the last key so every post has a distinct position.
+func (q PostQuery) keyset() keyset {
+	if len(q.Sort) == 0 {
+		return newestFirst
+	}
+
+	keys := make(keyset, 0, len(q.Sort)+1)
+	for _, sort := range q.Sort {
+		key := postSortKeys[sort.Field]
+		key.desc = sort.Desc
+		keys = append(keys, key)
+	}
+
+	id := idKey
+	id.desc = q.Sort[0].Desc
+	return append(keys, id)
+}
+
+// findPage method loads one page of the posts matched by tx
+// with the order and the fields of the query.
+func (q PostQuery) findPage(tx *gorm.DB, params pagination.Params) ([]models.Post, pagination.Meta, error) {
+	keys := q.keyset()
+
+	load, err := postProjection(tx, q.Fields, q.Summary, keys.columns()...)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+
+	return findPage(tx.Scopes(q.Filter.scope), load, keys, params)
+}
+
+// ValidateStatus checks the status filter.
+func (f PostFilter) ValidateStatus() error {
+	switch f.Status {
+	case "", StatusPublished, StatusDraft, StatusAll:
+		return nil
+	}
+
+	return errors.New("status must be one of published, draft or all")
+}
+
+// scope is the gorm scope applying the filters.
+func (f PostFilter) scope(db *gorm.DB) *gorm.DB {
+	switch f.Status {
+	case StatusPublished:
+		db = db.Where("posts.is_published = ?", true)
+	case StatusDraft:
+		db = db.Where("posts.is_published = ?", false)
+	}
+
+	if f.AuthorID != 0 {
+		db = db.Where("posts.author_id = ?", f.AuthorID)
+	}
+
+	if f.Tag != "" {
+		tagged := db.Session(&gorm.Session{NewDB: true}).
+			Table("post_tags").
+			Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.name = ?", strings.ToLower(f.Tag))
+		db = db.Where("posts.id IN (?)", tagged)
+	}
+
+	if !f.From.IsZero() {
+		db = db.Where(publishedAtColumn+" >= ?", f.From)
+	}
+
+	if !f.To.IsZero() {
+		db = db.Where(publishedAtColumn+" < ?", f.To)
+	}
+
+	if f.TitleContains != "" {
+		db = db.Where("LOWER(posts.title) LIKE ? ESCAPE '!'", "%"+search.EscapeLike(strings.ToLower(f.TitleContains))+"%")
+	}
+
+	return db
+}
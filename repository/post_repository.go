@@ -1,95 +1,365 @@
 package repository
 
 import (
+	"errors"
 	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/search"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"github.com/nebisin/gopress/utils/pagination"
 	"gorm.io/gorm"
+	"strconv"
+	"time"
 )
 
+// ErrVersionConflict is returned when the post is changed
+// by someone else since it is read.
+var ErrVersionConflict = errors.New("the post is changed by someone else")
+
+var ErrInvalidFeaturedMedia = errors.New("the featured media must be an image uploaded by the author")
+
 type postRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	search search.Engine
 }
 
 func NewPostRepository(db *gorm.DB) *postRepository {
-	return &postRepository{db: db}
+	return &postRepository{db: db, search: search.For(db)}
 }
 
 // Save method takes post model and create that post
 // in the database. It returns error if exist any.
 func (r *postRepository) Save(p *models.Post) error {
+	r, span := r.trace("Save")
+	defer span.End()
+
 	if err := p.Validate("create"); err != nil {
 		return err
 	}
+	p.Summarize()
 
-	if err := r.db.Create(&p).Error; err != nil {
-		return err
-	}
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkFeaturedMedia(tx, *p.AuthorID, p.FeaturedMediaID); err != nil {
+			return err
+		}
+
+		tags, err := findOrCreateTags(tx, p.Tags)
+		if err != nil {
+			return err
+		}
+		p.Tags = tags
+
+		// Imported posts keep the time they are published.
+		if p.IsPublished && p.PublishedAt == nil {
+			now := time.Now()
+			p.PublishedAt = &now
+		}
+
+		if err := tx.Create(&p).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Scopes(withRelations).First(p, p.ID).Error; err != nil {
+			return err
+		}
+
+		return r.index(tx, *p)
+	})
 }
 
 // FindById method find one post by given id.
 func (r *postRepository) FindById(id uint) (models.Post, error) {
+	r, span := r.trace("FindById")
+	defer span.End()
+
 	var post models.Post
-	if err := r.db.Preload("Author").First(&post, id).Error; err != nil {
+	if err := r.db.Scopes(withRelations).First(&post, id).Error; err != nil {
 		return models.Post{}, err
 	}
 
 	return post, nil
 }
 
-// UpdateById method update one post
+// FindByIdWithFields method finds a post by it's id loading
+// only the asked fields and relations.
+func (r *postRepository) FindByIdWithFields(id uint, fields fieldset.Fieldset) (models.Post, error) {
+	r, span := r.trace("FindByIdWithFields")
+	defer span.End()
+
+	load, err := postProjection(r.db, fields, false)
+	if err != nil {
+		return models.Post{}, err
+	}
+
+	var post models.Post
+	if err := r.db.Scopes(load).First(&post, id).Error; err != nil {
+		return models.Post{}, err
+	}
+
+	return post, nil
+}
+
+// UpdateById method replaces one post with the new post.
 // It takes old post and new post and return error if any.
+// Every field is written even if it is empty or false,
+// and the tags of the post are replaced with the new ones.
+// The update only succeeds if the post is still at the version of
+// the old post, otherwise ErrVersionConflict is returned.
 func (r *postRepository) UpdateById(post *models.Post, newPost models.Post) error {
-	if err := newPost.Validate("update"); err != nil {
+	r, span := r.trace("UpdateById")
+	defer span.End()
+
+	if err := newPost.Validate("replace"); err != nil {
 		return err
 	}
+	newPost.Summarize()
 
-	if err := r.db.Model(&post).Updates(newPost).Error; err != nil {
-		return err
+	newPost.PublishedAt = post.PublishedAt
+	if newPost.IsPublished && post.PublishedAt == nil {
+		now := time.Now()
+		newPost.PublishedAt = &now
 	}
 
-	return nil
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkFeaturedMedia(tx, *post.AuthorID, newPost.FeaturedMediaID); err != nil {
+			return err
+		}
+
+		newPost.Version = post.Version + 1
+
+		result := tx.Model(post).
+			Where("version = ?", post.Version).
+			Select("Title", "Body", "IsPublished", "PublishedAt", "Version", "UpdatedAt",
+				"Excerpt", "CustomExcerpt", "WordCount", "ReadingTime", "FeaturedMediaID").
+			Updates(newPost)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+
+		tags, err := findOrCreateTags(tx, newPost.Tags)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Model(post).Association("Tags").Replace(tags); err != nil {
+			return err
+		}
+		post.Tags = tags
+
+		if err := tx.Scopes(withRelations).First(post, post.ID).Error; err != nil {
+			return err
+		}
+
+		return r.index(tx, *post)
+	})
 }
 
 // DeleteById method delete one post by given id.
 func (r *postRepository) DeleteById(id uint) error {
-	if err := r.db.Delete(&models.Post{}, id).Error; err != nil {
-		return err
-	}
+	r, span := r.trace("DeleteById")
+	defer span.End()
 
-	return nil
+	return r.delete(id, 0)
+}
+
+// DeleteByIdAndVersion method delete one post by given id
+// only if it is still at given version.
+// Otherwise it returns ErrVersionConflict.
+func (r *postRepository) DeleteByIdAndVersion(id uint, version uint) error {
+	r, span := r.trace("DeleteByIdAndVersion")
+	defer span.End()
+
+	return r.delete(id, version)
+}
+
+// delete method deletes the post and removes it from the search index.
+// Any version of the post is deleted if version is zero.
+func (r *postRepository) delete(id uint, version uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if version != 0 {
+			query = tx.Where("version = ?", version)
+		}
+
+		result := query.Delete(&models.Post{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 && version != 0 {
+			return ErrVersionConflict
+		}
+
+		if r.search != nil {
+			return r.search.Remove(tx, id)
+		}
+
+		return nil
+	})
 }
 
-// FindMany method gets all published posts in the limits
-// ordered by creation time.
-// If limit is not provided it's 10 by default.
-func (r *postRepository) FindMany(limit int) ([]models.Post, error) {
-	if limit == 0 {
-		limit = 10
+// Search method makes a full-text search over published posts
+// and returns one page of them ordered by relevance with
+// highlighted snippets. Cursors of the search results
+// point to a position in the ranking.
+func (r *postRepository) Search(query search.Query, params pagination.Params) ([]search.Result, pagination.Meta, error) {
+	r, span := r.trace("Search")
+	defer span.End()
+
+	if r.search == nil {
+		return nil, pagination.Meta{}, search.ErrUnavailable
+	}
+
+	query.Offset = params.Offset()
+	if params.Cursor != nil {
+		offset, err := strconv.Atoi(params.Cursor.Values[0])
+		if err != nil || offset < 0 {
+			return nil, pagination.Meta{}, pagination.ErrInvalidCursor
+		}
+		query.Offset = offset
+	}
+	query.Limit = params.PerPage + 1
+
+	hits, err := r.search.Search(r.db, query)
+	if err != nil {
+		return nil, pagination.Meta{}, err
+	}
+
+	meta := pagination.Meta{Page: params.Page, PerPage: params.PerPage}
+	if len(hits) > params.PerPage {
+		hits = hits[:params.PerPage]
+		meta.NextCursor = offsetCursor(query.Offset+params.PerPage, false)
+	}
+	if query.Offset > 0 {
+		prev := query.Offset - params.PerPage
+		if prev < 0 {
+			prev = 0
+		}
+		meta.PrevCursor = offsetCursor(prev, true)
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.PostID
 	}
 
 	var posts []models.Post
-	if err := r.db.
-		Limit(limit).
-		Order("created_at desc").
-		Preload("Author").
-		Where("is_published = ?", true).
-		Find(&posts).Error; err != nil {
-		return nil, err
+	if len(ids) > 0 {
+		if err := r.db.Scopes(withRelations).Find(&posts, ids).Error; err != nil {
+			return nil, pagination.Meta{}, err
+		}
 	}
 
-	return posts, nil
+	byId := make(map[uint]models.Post, len(posts))
+	for _, post := range posts {
+		byId[post.ID] = post
+	}
+
+	results := make([]search.Result, 0, len(hits))
+	for _, hit := range hits {
+		post, ok := byId[hit.PostID]
+		if !ok {
+			continue
+		}
+		results = append(results, search.Result{Post: post, Rank: hit.Rank, Snippet: hit.Snippet})
+	}
+
+	return results, meta, nil
 }
 
-// FindPostsByUserId method gets given users posts
-// just published ones.
-func (r postRepository) FindPostsByUserId(uid uint) ([]models.Post, error) {
+// Each method calls fn with every post and its author and tags
+// in the order they are created. Posts in the trash are skipped.
+func (r *postRepository) Each(fn func(post models.Post) error) error {
+	r, span := r.trace("Each")
+	defer span.End()
+
 	var posts []models.Post
+	return r.db.Scopes(withRelations).Order("posts.id").
+		FindInBatches(&posts, 100, func(tx *gorm.DB, batch int) error {
+			for _, post := range posts {
+				if err := fn(post); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
+
+// Reindex method rebuilds the search index from scratch.
+func (r *postRepository) Reindex() error {
+	r, span := r.trace("Reindex")
+	defer span.End()
 
+	if r.search == nil {
+		return search.ErrUnavailable
+	}
+
+	return r.search.Rebuild(r.db)
+}
+
+// index method keeps the search index up to date with the post.
+func (r *postRepository) index(tx *gorm.DB, post models.Post) error {
+	if r.search == nil {
+		return nil
+	}
+
+	return r.search.Index(tx, post)
+}
+
+// FindMany method gets one page of posts matching the query.
+// Unless the status filter says otherwise it only returns
+// published posts. Posts are ordered by creation time by default.
+func (r *postRepository) FindMany(query PostQuery, params pagination.Params) ([]models.Post, pagination.Meta, error) {
+	r, span := r.trace("FindMany")
+	defer span.End()
+
+	if query.Filter.Status == "" {
+		query.Filter.Status = StatusPublished
+	}
+
+	return query.findPage(r.db, params)
+}
+
+// FindPostsByUserId method gets one page of given users posts
+// just published ones.
+func (r *postRepository) FindPostsByUserId(uid uint, query PostQuery, params pagination.Params) ([]models.Post, pagination.Meta, error) {
+	r, span := r.trace("FindPostsByUserId")
+	defer span.End()
+
+	query.Filter.AuthorID = uid
+	query.Filter.Status = StatusPublished
+
+	return query.findPage(r.db, params)
+}
+
+// FindMyPosts method gets one page of given users posts
+// including both published and unpublished ones
+// unless they are filtered by status.
+func (r *postRepository) FindMyPosts(uid uint, query PostQuery, params pagination.Params) ([]models.Post, pagination.Meta, error) {
+	r, span := r.trace("FindMyPosts")
+	defer span.End()
+
+	query.Filter.AuthorID = uid
+
+	return query.findPage(r.db, params)
+}
+
+// FindRecent method gets the latest published posts matching the filter
+// ordered by publication time, without counting them like FindMany.
+func (r *postRepository) FindRecent(filter PostFilter, limit int) ([]models.Post, error) {
+	r, span := r.trace("FindRecent")
+	defer span.End()
+
+	filter.Status = StatusPublished
+
+	var posts []models.Post
 	if err := r.db.
-		Order("created_at desc").
-		Preload("Author").
-		Where("author_id = ?", uid).
-		Where("is_published = ?", true).
+		Scopes(filter.scope).
+		Order(publishedAtColumn + " desc").
+		Order("posts.id desc").
+		Limit(limit).
+		Scopes(withRelations).
 		Find(&posts).Error; err != nil {
 		return nil, err
 	}
@@ -97,18 +367,58 @@ func (r postRepository) FindPostsByUserId(uid uint) ([]models.Post, error) {
 	return posts, nil
 }
 
-// FindMyPosts method gets given users posts
-// including both published and unpublished ones.
-func (r postRepository) FindMyPosts(uid uint) ([]models.Post, error) {
+// SummarizeAll method computes the excerpt, the word count and the
+// reading time of the posts which were written before they existed.
+// Summarized posts are read in at least a minute, even if their body
+// is empty, so only the ones with a zero reading time are left.
+func (r *postRepository) SummarizeAll() error {
+	r, span := r.trace("SummarizeAll")
+	defer span.End()
+
 	var posts []models.Post
+	return r.db.Unscoped().
+		Where("reading_time = 0").
+		FindInBatches(&posts, 100, func(tx *gorm.DB, batch int) error {
+			for _, post := range posts {
+				post.Summarize()
+				err := r.db.Unscoped().Model(&post).UpdateColumns(map[string]interface{}{
+					"excerpt":      post.Excerpt,
+					"word_count":   post.WordCount,
+					"reading_time": post.ReadingTime,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
 
-	if err := r.db.
-		Order("created_at desc").
-		Preload("Author").
-		Where("author_id = ?", uid).
-		Find(&posts).Error; err != nil {
-		return nil, err
+// withRelations scope loads everything sent along with posts.
+func withRelations(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Author").
+		Preload("Tags").
+		Preload("FeaturedMedia").
+		Preload("FeaturedMedia.Variants", orderById)
+}
+
+// checkFeaturedMedia makes sure the featured media
+// of a post is an image uploaded by its author.
+func checkFeaturedMedia(tx *gorm.DB, authorID uint, mediaID *uint) error {
+	if mediaID == nil {
+		return nil
 	}
 
-	return posts, nil
-}
\ No newline at end of file
+	var count int64
+	err := tx.Model(&models.Media{}).
+		Where("id = ? AND owner_id = ? AND content_type LIKE ?", *mediaID, authorID, "image/%").
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrInvalidFeaturedMedia
+	}
+
+	return nil
+}
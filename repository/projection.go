@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"fmt"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/utils/fieldset"
+	"gorm.io/gorm"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// PostRelations are the fields of posts which are relations.
+// They can be asked with include and their own fields.
+var PostRelations = []string{"author", "tags", "featuredMedia"}
+
+// postRelationModels are the models of the post relations.
+var postRelationModels = map[string]interface{}{
+	"author":        &models.User{},
+	"tags":          &models.Tag{},
+	"featuredMedia": &models.Media{},
+}
+
+// postRequiredColumns are always loaded with posts since they are
+// needed for checking access, making entity tags and loading relations.
+var postRequiredColumns = []string{
+	"id", "author_id", "featured_media_id", "is_published",
+	"published_at", "created_at", "updated_at", "deleted_at", "version",
+}
+
+// postProjection returns the scope loading the asked fields and
+// relations of posts. Summaries leave out the body unless it is
+// asked. Extra columns are the ones the order of a list needs.
+func postProjection(db *gorm.DB, fields fieldset.Fieldset, summary bool, extra ...string) (func(*gorm.DB) *gorm.DB, error) {
+	for _, relation := range fields.Include {
+		if _, ok := postRelationModels[relation]; !ok {
+			return nil, fmt.Errorf("%w: %s can not be included", fieldset.ErrUnknownField, relation)
+		}
+	}
+	for relation := range fields.Nested {
+		if _, ok := postRelationModels[relation]; !ok {
+			return nil, fmt.Errorf("%w: %s", fieldset.ErrUnknownField, relation)
+		}
+	}
+
+	var columns []string
+	switch {
+	case fields.HasFields():
+		var err error
+		required := append(append([]string{}, postRequiredColumns...), extra...)
+		if columns, err = selectColumns(db, &models.Post{}, fields.Fields, PostRelations, required...); err != nil {
+			return nil, err
+		}
+	case summary:
+		known, err := jsonColumns(db, &models.Post{})
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range known {
+			if column != "" && column != "body" {
+				columns = append(columns, column)
+			}
+		}
+		sort.Strings(columns)
+	}
+	for i := range columns {
+		columns[i] = "posts." + columns[i]
+	}
+
+	preloads := make(map[string]func(*gorm.DB) *gorm.DB)
+	for _, relation := range PostRelations {
+		if !fields.Includes(relation) {
+			continue
+		}
+
+		var relationColumns []string
+		asked := fields.FieldsOf(relation)
+		if asked != nil {
+			var err error
+			relationColumns, err = selectColumns(db, postRelationModels[relation], asked, []string{"variants"}, "id")
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		name := strings.ToUpper(relation[:1]) + relation[1:]
+		preloads[name] = selectScope(relationColumns)
+		if relation == "featuredMedia" && (asked == nil || contains(asked, "variants")) {
+			preloads["FeaturedMedia.Variants"] = orderById
+		}
+	}
+
+	return func(tx *gorm.DB) *gorm.DB {
+		if columns != nil {
+			tx = tx.Select(columns)
+		}
+		for name, scope := range preloads {
+			tx = tx.Preload(name, scope)
+		}
+		return tx
+	}, nil
+}
+
+// userProjection returns the scope loading the asked fields of users.
+func userProjection(db *gorm.DB, fields fieldset.Fieldset) (func(*gorm.DB) *gorm.DB, error) {
+	if len(fields.Include) > 0 || len(fields.Nested) > 0 {
+		return nil, fmt.Errorf("%w: users do not have relations", fieldset.ErrUnknownField)
+	}
+
+	var columns []string
+	if fields.HasFields() {
+		var err error
+		if columns, err = selectColumns(db, &models.User{}, fields.Fields, nil, "id"); err != nil {
+			return nil, err
+		}
+	}
+
+	return selectScope(columns), nil
+}
+
+// selectScope selects given columns, or all of them if there is none.
+func selectScope(columns []string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if columns == nil {
+			return tx
+		}
+		return tx.Select(columns)
+	}
+}
+
+// selectColumns returns the columns of the asked fields of a model
+// along with the required columns. Relations and fields without a
+// column are accepted but do not add any column.
+func selectColumns(db *gorm.DB, model interface{}, fields []string, relations []string, required ...string) ([]string, error) {
+	known, err := jsonColumns(db, model)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, 0, len(required)+len(fields))
+	for _, column := range required {
+		if !contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	for _, field := range fields {
+		column, ok := known[field]
+		if !ok && !contains(relations, field) {
+			return nil, fmt.Errorf("%w: %s", fieldset.ErrUnknownField, field)
+		}
+		if column != "" && !contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns, nil
+}
+
+// jsonColumns maps the JSON names of the fields of a model to their
+// columns. Fields which are not stored map to an empty column and
+// the ones hidden from JSON are left out.
+func jsonColumns(db *gorm.DB, model interface{}) (map[string]string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]string)
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous {
+				walk(field.Type)
+				continue
+			}
+
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			columns[name] = ""
+			if f := stmt.Schema.LookUpField(field.Name); f != nil {
+				columns[name] = f.DBName
+			}
+		}
+	}
+	walk(reflect.TypeOf(model).Elem())
+
+	return columns, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
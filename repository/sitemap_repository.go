@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Sitemap sections.
+const (
+	SitemapPosts   = "posts"
+	SitemapAuthors = "authors"
+	SitemapTags    = "tags"
+)
+
+var ErrUnknownSection = errors.New("unknown sitemap section")
+
+// SitemapEntry is one url of a sitemap.
+// Name is only set for tags, which are linked by name.
+type SitemapEntry struct {
+	ID        uint
+	Name      string
+	UpdatedAt time.Time
+}
+
+type sitemapRepository struct {
+	db *gorm.DB
+}
+
+func NewSitemapRepository(db *gorm.DB) *sitemapRepository {
+	return &sitemapRepository{db: db}
+}
+
+// section returns the query of the public rows of a sitemap section:
+// published posts, users with published posts and tags of published posts.
+func (r sitemapRepository) section(name string) (*gorm.DB, string, error) {
+	published := r.db.Session(&gorm.Session{NewDB: true}).
+		Model(&models.Post{}).
+		Where("posts.is_published = ?", true)
+
+	switch name {
+	case SitemapPosts:
+		return r.db.Model(&models.Post{}).Where("posts.is_published = ?", true), "posts", nil
+	case SitemapAuthors:
+		authors := published.Select("posts.author_id")
+		return r.db.Model(&models.User{}).Where("users.id IN (?)", authors), "users", nil
+	case SitemapTags:
+		tagged := published.
+			Select("post_tags.tag_id").
+			Joins("JOIN post_tags ON post_tags.post_id = posts.id")
+		return r.db.Model(&models.Tag{}).Where("tags.id IN (?)", tagged), "tags", nil
+	}
+
+	return nil, "", ErrUnknownSection
+}
+
+// MaxId method returns the greatest id in the sitemap section.
+// Sitemaps are split by id ranges so it tells how many there may be.
+func (r sitemapRepository) MaxId(name string) (uint, error) {
+	r, span := r.trace("MaxId")
+	defer span.End()
+
+	query, table, err := r.section(name)
+	if err != nil {
+		return 0, err
+	}
+
+	var entries []SitemapEntry
+	if err := query.Select(table + ".id").Order(table + ".id desc").Limit(1).Find(&entries).Error; err != nil {
+		return 0, err
+	}
+
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	return entries[0].ID, nil
+}
+
+// LastModified method returns the latest update time
+// of the rows with ids in given range, or false if there are none.
+func (r sitemapRepository) LastModified(name string, from uint, to uint) (time.Time, bool, error) {
+	r, span := r.trace("LastModified")
+	defer span.End()
+
+	query, table, err := r.section(name)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	var entries []SitemapEntry
+	if err := query.
+		Select(table+".id, "+table+".updated_at").
+		Where(table+".id BETWEEN ? AND ?", from, to).
+		Order(table + ".updated_at desc").
+		Limit(1).
+		Find(&entries).Error; err != nil {
+		return time.Time{}, false, err
+	}
+
+	if len(entries) == 0 {
+		return time.Time{}, false, nil
+	}
+
+	return entries[0].UpdatedAt, true, nil
+}
+
+// FindEntries method gets the rows of the sitemap section
+// with ids in given range.
+func (r sitemapRepository) FindEntries(name string, from uint, to uint) ([]SitemapEntry, error) {
+	r, span := r.trace("FindEntries")
+	defer span.End()
+
+	query, table, err := r.section(name)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := table + ".id, " + table + ".updated_at"
+	if name == SitemapTags {
+		columns += ", tags.name"
+	}
+
+	var entries []SitemapEntry
+	if err := query.
+		Select(columns).
+		Where(table+".id BETWEEN ? AND ?", from, to).
+		Order(table + ".id").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+type tagRepository struct {
+	db *gorm.DB
+}
+
+func NewTagRepository(db *gorm.DB) *tagRepository {
+	return &tagRepository{db: db}
+}
+
+// FindByName method find a tag by it's unique name.
+func (r tagRepository) FindByName(name string) (models.Tag, error) {
+	r, span := r.trace("FindByName")
+	defer span.End()
+
+	var tag models.Tag
+	if err := r.db.First(&tag, "name = ?", strings.ToLower(name)).Error; err != nil {
+		return models.Tag{}, err
+	}
+
+	return tag, nil
+}
+
+// findOrCreateTags method finds the given tags by name
+// and creates the ones which do not exist yet.
+func findOrCreateTags(tx *gorm.DB, tags []models.Tag) ([]models.Tag, error) {
+	result := make([]models.Tag, 0, len(tags))
+	for _, tag := range tags {
+		if err := tx.Where(models.Tag{Name: tag.Name}).FirstOrCreate(&tag).Error; err != nil {
+			return nil, err
+		}
+		result = append(result, tag)
+	}
+
+	return result, nil
+}
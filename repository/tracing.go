@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"github.com/nebisin/gopress/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// startSpan starts the span of a repository call as a child of the
+// context of db. Queries of the returned db are children of the span.
+func startSpan(db *gorm.DB, name string) (*gorm.DB, trace.Span) {
+	ctx, span := tracing.Tracer().Start(db.Statement.Context, name)
+	return db.WithContext(ctx), span
+}
+
+// trace methods return a copy of the repository running its queries
+// in the span of the call, so calls between methods are nested too.
+
+func (r *postRepository) trace(name string) (*postRepository, trace.Span) {
+	db, span := startSpan(r.db, "postRepository."+name)
+	return &postRepository{db: db, search: r.search}, span
+}
+
+func (r userRepository) trace(name string) (userRepository, trace.Span) {
+	db, span := startSpan(r.db, "userRepository."+name)
+	return userRepository{db: db}, span
+}
+
+func (r *mediaRepository) trace(name string) (*mediaRepository, trace.Span) {
+	db, span := startSpan(r.db, "mediaRepository."+name)
+	return &mediaRepository{db: db}, span
+}
+
+func (r tagRepository) trace(name string) (tagRepository, trace.Span) {
+	db, span := startSpan(r.db, "tagRepository."+name)
+	return tagRepository{db: db}, span
+}
+
+func (r sitemapRepository) trace(name string) (sitemapRepository, trace.Span) {
+	db, span := startSpan(r.db, "sitemapRepository."+name)
+	return sitemapRepository{db: db}, span
+}
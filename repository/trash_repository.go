@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/utils/pagination"
+	"gorm.io/gorm"
+	"time"
+)
+
+// FindTrashed method gets one page of given users deleted posts
+// ordered by deletion time. Posts are soft deleted so they stay
+// in the trash until they are restored or purged.
+// If uid is zero it gets every users posts.
+func (r *postRepository) FindTrashed(uid uint, params pagination.Params) ([]models.Post, pagination.Meta, error) {
+	r, span := r.trace("FindTrashed")
+	defer span.End()
+
+	tx := r.db.Unscoped().Where("posts.deleted_at IS NOT NULL")
+	if uid != 0 {
+		tx = tx.Where("posts.author_id = ?", uid)
+	}
+
+	return findPage(tx, withRelations, lastDeletedFirst, params)
+}
+
+// FindTrashedById method find one deleted post by given id.
+func (r *postRepository) FindTrashedById(id uint) (models.Post, error) {
+	r, span := r.trace("FindTrashedById")
+	defer span.End()
+
+	var post models.Post
+	if err := r.db.Unscoped().
+		Scopes(withRelations).
+		Where("posts.deleted_at IS NOT NULL").
+		First(&post, id).Error; err != nil {
+		return models.Post{}, err
+	}
+
+	return post, nil
+}
+
+// Restore method takes the deleted post out of the trash.
+func (r *postRepository) Restore(post *models.Post) error {
+	r, span := r.trace("Restore")
+	defer span.End()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(post).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		post.DeletedAt = gorm.DeletedAt{}
+
+		return r.index(tx, *post)
+	})
+}
+
+// Purge method deletes the post with given id permanently.
+func (r *postRepository) Purge(id uint) error {
+	r, span := r.trace("Purge")
+	defer span.End()
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return purge(tx, []uint{id})
+	})
+}
+
+// purgeBatchSize is how many posts are purged in one transaction.
+// It keeps the id lists below the bind parameter limits of the
+// databases however large the trash is.
+var purgeBatchSize = 500
+
+// PurgeTrashedBefore method permanently deletes the posts
+// which are in the trash since before given time.
+// They are deleted in batches, each one in its own transaction,
+// so the batches already deleted stay deleted if one fails.
+// It returns how many posts are deleted.
+func (r *postRepository) PurgeTrashedBefore(t time.Time) (int64, error) {
+	r, span := r.trace("PurgeTrashedBefore")
+	defer span.End()
+
+	var count int64
+	for {
+		var ids []uint
+		if err := r.db.Unscoped().
+			Model(&models.Post{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", t).
+			Order("id").
+			Limit(purgeBatchSize).
+			Pluck("id", &ids).Error; err != nil {
+			return count, err
+		}
+
+		if len(ids) == 0 {
+			return count, nil
+		}
+
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			return purge(tx, ids)
+		})
+		if err != nil {
+			return count, err
+		}
+		count += int64(len(ids))
+
+		if len(ids) < purgeBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// purge deletes the posts with their tag associations.
+func purge(tx *gorm.DB, ids []uint) error {
+	if err := tx.Exec("DELETE FROM post_tags WHERE post_id IN (?)", ids).Error; err != nil {
+		return err
+	}
+
+	return tx.Unscoped().Delete(&models.Post{}, ids).Error
+}
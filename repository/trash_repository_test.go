@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPurgeTrashedBefore(t *testing.T) {
+	defer func(size int) { purgeBatchSize = size }(purgeBatchSize)
+	purgeBatchSize = 2
+
+	forEachDatabase(t, func(t *testing.T, db *gorm.DB) {
+		ann := createUser(t, db, "ann")
+		posts := NewPostRepository(db)
+
+		// The first five posts are in the trash for a long time,
+		// the sixth only since now and the last one is not deleted.
+		var ids []uint
+		for i := 0; i < 7; i++ {
+			post := createPost(t, db, models.Post{
+				Title: "Post", Body: "body", AuthorID: &ann.ID, Tags: models.NamesToTags([]string{"go"}),
+			})
+			ids = append(ids, post.ID)
+			if i == 6 {
+				continue
+			}
+			if err := posts.DeleteById(post.ID); err != nil {
+				t.Fatal(err)
+			}
+			if i < 5 {
+				err := db.Unscoped().Model(&models.Post{}).Where("id = ?", post.ID).
+					UpdateColumn("deleted_at", time.Now().Add(-48*time.Hour)).Error
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		count, err := posts.PurgeTrashedBefore(time.Now().Add(-24 * time.Hour))
+		if err != nil || count != 5 {
+			t.Fatalf("PurgeTrashedBefore = %d, %v, want 5", count, err)
+		}
+
+		var left []uint
+		if err := db.Unscoped().Model(&models.Post{}).Order("id").Pluck("id", &left).Error; err != nil {
+			t.Fatal(err)
+		}
+		if want := ids[5:]; !reflect.DeepEqual(left, want) {
+			t.Errorf("posts left = %v, want %v", left, want)
+		}
+
+		var tagged []uint
+		if err := db.Table("post_tags").Order("post_id").Pluck("post_id", &tagged).Error; err != nil {
+			t.Fatal(err)
+		}
+		if want := ids[5:]; !reflect.DeepEqual(tagged, want) {
+			t.Errorf("tagged posts left = %v, want %v", tagged, want)
+		}
+
+		if count, err := posts.PurgeTrashedBefore(time.Now().Add(-24 * time.Hour)); err != nil || count != 0 {
+			t.Errorf("PurgeTrashedBefore again = %d, %v, want 0", count, err)
+		}
+	})
+}
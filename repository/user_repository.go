@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"errors"
 	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/tracing"
+	"github.com/nebisin/gopress/utils/fieldset"
 	"gorm.io/gorm"
 )
 
@@ -14,19 +17,32 @@ func NewUserRepository(db *gorm.DB) *userRepository {
 }
 
 // Save method create given user in the database.
+// The password of the user is replaced with its hash.
 func (r userRepository) Save(p *models.User) error {
+	r, span := r.trace("Save")
+	defer span.End()
+
 	if err := p.Validate("register"); err != nil {
 		return err
 	}
 
-	if err := r.db.Create(&p).Error; err != nil {
+	hashedPassword, err := r.hashPassword(p.Password)
+	if err != nil {
 		return err
 	}
+	p.Password = hashedPassword
+
+	if err := r.db.Create(&p).Error; err != nil {
+		return userError(err)
+	}
 	return nil
 }
 
 // FindById method find a user by given id.
 func (r userRepository) FindById(id uint) (models.User, error) {
+	r, span := r.trace("FindById")
+	defer span.End()
+
 	var user models.User
 	if err := r.db.First(&user, id).Error; err != nil {
 		return models.User{}, err
@@ -35,22 +51,141 @@ func (r userRepository) FindById(id uint) (models.User, error) {
 	return user, nil
 }
 
-// UpdateById method update one user.
+// FindByIdWithFields method finds a user by given id
+// loading only the asked fields.
+func (r userRepository) FindByIdWithFields(id uint, fields fieldset.Fieldset) (models.User, error) {
+	r, span := r.trace("FindByIdWithFields")
+	defer span.End()
+
+	load, err := userProjection(r.db, fields)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	var user models.User
+	if err := r.db.Scopes(load).First(&user, id).Error; err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdateById method replaces the profile of one user.
 // It takes old and new user and return error if any.
+// Username and display name are always written even if they are empty
+// but the password is only changed if new user has one.
 func (r userRepository) UpdateById(value *models.User, newValue *models.User) error {
+	r, span := r.trace("UpdateById")
+	defer span.End()
+
 	if err := newValue.Validate("update"); err != nil {
 		return err
 	}
 
-	if err := r.db.Model(&value).Updates(&newValue).Error; err != nil {
+	fields := []interface{}{"DisplayName", "UpdatedAt"}
+	if newValue.Password != "" {
+		hashedPassword, err := r.hashPassword(newValue.Password)
+		if err != nil {
+			return err
+		}
+		newValue.Password = hashedPassword
+		fields = append(fields, "Password")
+	}
+
+	if err := r.db.Model(value).Select("Username", fields...).Updates(newValue).Error; err != nil {
+		return userError(err)
+	}
+
+	return nil
+}
+
+// SetAdmin method grants or revokes the admin rights of a user.
+func (r userRepository) SetAdmin(id uint, admin bool) error {
+	r, span := r.trace("SetAdmin")
+	defer span.End()
+
+	return r.updateColumn(id, "is_admin", admin)
+}
+
+// SetLocked method locks or unlocks the account of a user.
+// Locked users can not log in and their tokens are revoked.
+func (r userRepository) SetLocked(id uint, locked bool) error {
+	r, span := r.trace("SetLocked")
+	defer span.End()
+
+	return r.updateColumns(id, map[string]interface{}{
+		"is_locked":     locked,
+		"token_version": gorm.Expr("token_version + 1"),
+	})
+}
+
+// SetPassword method hashes and saves a new password for a user.
+// The tokens given with the old password are revoked.
+func (r userRepository) SetPassword(id uint, password string) error {
+	r, span := r.trace("SetPassword")
+	defer span.End()
+
+	if len(password) < 8 {
+		return errors.New("password must be at least 8 characters")
+	}
+
+	hashedPassword, err := r.hashPassword(password)
+	if err != nil {
 		return err
 	}
 
+	return r.updateColumns(id, map[string]interface{}{
+		"password":      hashedPassword,
+		"token_version": gorm.Expr("token_version + 1"),
+	})
+}
+
+// hashPassword hashes a password in its own span,
+// bcrypt is slow on purpose.
+func (r userRepository) hashPassword(password string) (string, error) {
+	_, span := tracing.Tracer().Start(r.db.Statement.Context, "bcrypt.GenerateFromPassword")
+	defer span.End()
+
+	return models.HashPassword(password)
+}
+
+// FindForToken method finds what decides if the tokens of a user are
+// valid, if the user is locked and the version of the tokens. It is
+// never cached, so locking a user from the command line revokes the
+// tokens right away.
+func (r userRepository) FindForToken(id uint) (models.User, error) {
+	r, span := r.trace("FindForToken")
+	defer span.End()
+
+	var user models.User
+	if err := r.db.Select("id", "is_locked", "token_version").First(&user, id).Error; err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func (r userRepository) updateColumn(id uint, column string, value interface{}) error {
+	return r.updateColumns(id, map[string]interface{}{column: value})
+}
+
+func (r userRepository) updateColumns(id uint, values map[string]interface{}) error {
+	result := r.db.Model(&models.User{}).Where("id = ?", id).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
 	return nil
 }
 
 // DeleteById method delete the user by given id.
 func (r userRepository) DeleteById(id uint) error {
+	r, span := r.trace("DeleteById")
+	defer span.End()
+
 	if err := r.db.Delete(&models.User{}, id).Error; err != nil {
 		return err
 	}
@@ -60,6 +195,9 @@ func (r userRepository) DeleteById(id uint) error {
 
 // FindMany method find users by given id.
 func (r userRepository) FindMany(limit int) ([]models.User, error) {
+	r, span := r.trace("FindMany")
+	defer span.End()
+
 	if limit == 0 {
 		limit = 10
 	}
@@ -74,6 +212,9 @@ func (r userRepository) FindMany(limit int) ([]models.User, error) {
 
 // FindByEmailOrUsername method find a user by it's unique email or username.
 func (r userRepository) FindByEmailOrUsername(email string, username string) (models.User, error) {
+	r, span := r.trace("FindByEmailOrUsername")
+	defer span.End()
+
 	var user models.User
 	if err := r.db.First(&user, "email = ? OR username = ?", email, username).Error; err != nil {
 		return models.User{}, err
@@ -0,0 +1,84 @@
+package search
+
+import (
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// likeEngine works on every database without an index.
+// Every term must appear in the title or the body
+// and title matches rank higher than body matches.
+// Texts are lower cased since LIKE is case sensitive
+// on some databases.
+type likeEngine struct{}
+
+func (e *likeEngine) Name() string {
+	return pluginName
+}
+
+func (e *likeEngine) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+func (e *likeEngine) Index(db *gorm.DB, post models.Post) error {
+	return nil
+}
+
+func (e *likeEngine) Remove(db *gorm.DB, id uint) error {
+	return nil
+}
+
+func (e *likeEngine) Search(db *gorm.DB, query Query) ([]Hit, error) {
+	words := terms(query.Terms)
+	if len(words) == 0 {
+		return []Hit{}, nil
+	}
+
+	var rank []string
+	var args []interface{}
+	tx := db.Table("posts")
+	for _, word := range words {
+		pattern := "%" + EscapeLike(strings.ToLower(strings.Trim(word, "*\""))) + "%"
+		tx = tx.Where("(LOWER(posts.title) LIKE ? ESCAPE '!' OR LOWER(posts.body) LIKE ? ESCAPE '!')", pattern, pattern)
+		rank = append(rank,
+			"CASE WHEN LOWER(posts.title) LIKE ? ESCAPE '!' THEN 10 ELSE 0 END",
+			"CASE WHEN LOWER(posts.body) LIKE ? ESCAPE '!' THEN 1 ELSE 0 END")
+		args = append(args, pattern, pattern)
+	}
+
+	var rows []struct {
+		Hit
+		Title string
+		Body  string
+	}
+	if err := paginate(applyFilters(tx, query), query).
+		Select("posts.id AS post_id, posts.title, posts.body, ("+strings.Join(rank, " + ")+") AS search_rank", args...).
+		Order("search_rank DESC").
+		Order("posts.created_at DESC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		snippet := makeSnippet(row.Body, words, 120)
+		if !strings.Contains(snippet, markOpen) {
+			snippet = makeSnippet(row.Title, words, 120)
+		}
+		hits[i] = row.Hit
+		hits[i].Snippet = highlight(snippet)
+	}
+
+	return hits, nil
+}
+
+func (e *likeEngine) Rebuild(db *gorm.DB) error {
+	return nil
+}
+
+// EscapeLike escapes the wildcards of LIKE patterns with '!'
+// which works the same on every database.
+func EscapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,96 @@
+package search
+
+import (
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"strings"
+	"unicode"
+)
+
+// mysqlEngine uses the FULLTEXT indexes of MySQL. One index covers
+// the title and the body for matching and another one only the
+// title for ranking title matches higher. Both are created by the
+// migrations.
+type mysqlEngine struct{}
+
+func (e *mysqlEngine) Name() string {
+	return pluginName
+}
+
+// Initialize does nothing since the indexes are created by the migrations.
+func (e *mysqlEngine) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+func (e *mysqlEngine) Index(db *gorm.DB, post models.Post) error {
+	return nil
+}
+
+func (e *mysqlEngine) Remove(db *gorm.DB, id uint) error {
+	return nil
+}
+
+// Search ranks the posts by their relevance giving
+// title matches ten times the weight of body matches.
+func (e *mysqlEngine) Search(db *gorm.DB, query Query) ([]Hit, error) {
+	against := mysqlQuery(query.Terms)
+	if against == "" {
+		return []Hit{}, nil
+	}
+
+	tx := db.Table("posts").
+		Select("posts.id AS post_id, posts.title, posts.body, "+
+			"MATCH (posts.title, posts.body) AGAINST (? IN BOOLEAN MODE) + "+
+			"9 * MATCH (posts.title) AGAINST (? IN BOOLEAN MODE) AS search_rank", against, against).
+		Where("MATCH (posts.title, posts.body) AGAINST (? IN BOOLEAN MODE)", against)
+
+	var rows []struct {
+		Hit
+		Title string
+		Body  string
+	}
+	if err := paginate(applyFilters(tx, query), query).
+		Order("search_rank DESC").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	words := terms(query.Terms)
+	hits := make([]Hit, len(rows))
+	for i, row := range rows {
+		snippet := makeSnippet(row.Body, words, 120)
+		if !strings.Contains(snippet, markOpen) {
+			snippet = makeSnippet(row.Title, words, 120)
+		}
+		hits[i] = row.Hit
+		hits[i].Snippet = highlight(snippet)
+	}
+
+	return hits, nil
+}
+
+func (e *mysqlEngine) Rebuild(db *gorm.DB) error {
+	return nil
+}
+
+// mysqlQuery turns the search text into a boolean mode query where
+// every term is required. Only letters and digits of the terms are
+// kept so user input can not use the operators of boolean mode.
+func mysqlQuery(text string) string {
+	var parts []string
+	for _, term := range terms(text) {
+		prefix := strings.HasSuffix(term, "*")
+		words := strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, word := range words {
+			part := "+" + word
+			if prefix && i == len(words)-1 {
+				part += "*"
+			}
+			parts = append(parts, part)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,90 @@
+package search
+
+import (
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"strings"
+	"unicode"
+)
+
+// postgresVector is the text search vector of a post. Title words
+// get the weight A and body words the weight B. The same expression
+// is indexed by the migrations so the index is kept up to date by
+// PostgreSQL itself.
+const postgresVector = "(setweight(to_tsvector('english', coalesce(posts.title, '')), 'A') || " +
+	"setweight(to_tsvector('english', coalesce(posts.body, '')), 'B'))"
+
+// postgresEngine uses the full-text search of PostgreSQL
+// over a GIN index of the text search vectors of the posts.
+type postgresEngine struct{}
+
+func (e *postgresEngine) Name() string {
+	return pluginName
+}
+
+// Initialize does nothing since the index is created by the migrations.
+func (e *postgresEngine) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+func (e *postgresEngine) Index(db *gorm.DB, post models.Post) error {
+	return nil
+}
+
+func (e *postgresEngine) Remove(db *gorm.DB, id uint) error {
+	return nil
+}
+
+// Search ranks the posts with ts_rank giving title matches
+// ten times the weight of body matches.
+func (e *postgresEngine) Search(db *gorm.DB, query Query) ([]Hit, error) {
+	tsquery := postgresQuery(query.Terms)
+	if tsquery == "" {
+		return []Hit{}, nil
+	}
+
+	options := "StartSel=" + markOpen + ", StopSel=" + markClose + ", MinWords=12, MaxWords=24"
+	tx := db.Table("posts").
+		Select("posts.id AS post_id, ts_rank('{0, 0, 0.1, 1}', "+postgresVector+", search_query) AS search_rank, "+
+			"ts_headline('english', posts.body, search_query, ?) AS snippet", options).
+		Joins("CROSS JOIN to_tsquery('english', ?) AS search_query", tsquery).
+		Where(postgresVector + " @@ search_query")
+
+	var hits []Hit
+	if err := paginate(applyFilters(tx, query), query).
+		Order("search_rank DESC").
+		Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		hits[i].Snippet = highlight(hits[i].Snippet)
+	}
+
+	return hits, nil
+}
+
+func (e *postgresEngine) Rebuild(db *gorm.DB) error {
+	return nil
+}
+
+// postgresQuery turns the search text into a tsquery. Only letters
+// and digits of the terms are kept so user input can not use the
+// query syntax, and the terms are combined with AND.
+func postgresQuery(text string) string {
+	var parts []string
+	for _, term := range terms(text) {
+		prefix := strings.HasSuffix(term, "*")
+		words := strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		for i, word := range words {
+			if prefix && i == len(words)-1 {
+				word += ":*"
+			}
+			parts = append(parts, word)
+		}
+	}
+
+	return strings.Join(parts, " & ")
+}
@@ -0,0 +1,242 @@
+package search
+
+import (
+	"errors"
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"html"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// pluginName is the name the engine is registered with
+// on the gorm instance.
+const pluginName = "gopress:search"
+
+// Highlight markers wrapped around the matching terms in snippets.
+// They are control characters so they can not clash with post content
+// and they are turned into <mark> tags after the snippet is escaped.
+const (
+	markOpen  = "\x02"
+	markClose = "\x03"
+)
+
+var ErrUnavailable = errors.New("search is not available")
+
+// PublishedAtColumn is the time a post is published at. It falls back
+// to the creation time for drafts and for posts published before the
+// column existed. The date filters of the searches and the post lists
+// both use it.
+const PublishedAtColumn = "COALESCE(posts.published_at, posts.created_at)"
+
+// Query describes a full-text search over the published posts.
+type Query struct {
+	Terms    string
+	AuthorID uint
+	Tag      string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// Hit is a single matching post with its relevance
+// and a highlighted snippet of the matching text.
+type Hit struct {
+	PostID  uint
+	Rank    float64 `gorm:"column:search_rank"`
+	Snippet string
+}
+
+// Result is a hit with the post it belongs to.
+type Result struct {
+	Post    models.Post `json:"post"`
+	Rank    float64     `json:"rank"`
+	Snippet string      `json:"snippet"`
+}
+
+// Engine is a full-text search engine over posts.
+// Every database can provide an implementation using its own
+// full-text features. Engines are gorm plugins so they are registered
+// once on the connection and found again by the repositories.
+type Engine interface {
+	gorm.Plugin
+
+	// Index adds the post to the index or replaces it.
+	Index(db *gorm.DB, post models.Post) error
+	// Remove drops the post with given id from the index.
+	Remove(db *gorm.DB, id uint) error
+	// Search returns hits ordered by relevance.
+	Search(db *gorm.DB, query Query) ([]Hit, error)
+	// Rebuild recreates the whole index from the posts table.
+	Rebuild(db *gorm.DB) error
+}
+
+// Register picks the engine for the dialect of given database
+// and registers it. If the native engine can not be set up,
+// for example when SQLite is built without FTS5, it falls back
+// to a slower engine built on LIKE queries.
+func Register(db *gorm.DB) error {
+	var engine Engine
+	switch db.Dialector.Name() {
+	case "sqlite":
+		engine = &sqliteEngine{}
+	case "postgres":
+		engine = &postgresEngine{}
+	case "mysql":
+		engine = &mysqlEngine{}
+	default:
+		engine = &likeEngine{}
+	}
+
+	err := db.Use(engine)
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := engine.(*likeEngine); ok {
+		return err
+	}
+
+	log.Printf("full-text search is not available, falling back to LIKE queries: %v", err)
+	return db.Use(&likeEngine{})
+}
+
+// For returns the engine registered on given database
+// or nil if there is not any.
+func For(db *gorm.DB) Engine {
+	plugin, ok := db.Config.Plugins[pluginName]
+	if !ok {
+		return nil
+	}
+
+	engine, _ := plugin.(Engine)
+	return engine
+}
+
+// applyFilters restricts a query joined with posts table
+// to the published posts matching the filters.
+func applyFilters(tx *gorm.DB, query Query) *gorm.DB {
+	tx = tx.Where("posts.is_published = ?", true).Where("posts.deleted_at IS NULL")
+
+	if query.AuthorID != 0 {
+		tx = tx.Where("posts.author_id = ?", query.AuthorID)
+	}
+
+	if query.Tag != "" {
+		tagged := tx.Session(&gorm.Session{NewDB: true}).
+			Table("post_tags").
+			Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.name = ?", strings.ToLower(query.Tag))
+		tx = tx.Where("posts.id IN (?)", tagged)
+	}
+
+	if !query.From.IsZero() {
+		tx = tx.Where(PublishedAtColumn+" >= ?", query.From)
+	}
+
+	if !query.To.IsZero() {
+		tx = tx.Where(PublishedAtColumn+" < ?", query.To)
+	}
+
+	return tx
+}
+
+// paginate applies the limit and offset of the query.
+func paginate(tx *gorm.DB, query Query) *gorm.DB {
+	return tx.Limit(query.Limit).Offset(query.Offset)
+}
+
+// terms splits the search text into its terms.
+// A trailing star marks the term as a prefix.
+func terms(text string) []string {
+	var result []string
+	for _, term := range strings.Fields(text) {
+		if strings.Trim(term, "*\"") == "" {
+			continue
+		}
+		result = append(result, term)
+	}
+
+	return result
+}
+
+// highlight escapes the snippet and turns the markers
+// into mark tags so it can be shown as HTML.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, markOpen, "<mark>")
+	return strings.ReplaceAll(snippet, markClose, "</mark>")
+}
+
+// makeSnippet cuts a window of given width around the first term
+// found in the text and marks all the occurrences of the terms.
+// It is used by the engines which can not make snippets themselves.
+func makeSnippet(text string, words []string, width int) string {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	var needles [][]rune
+	for _, word := range words {
+		word = strings.Trim(word, "*\"")
+		if word != "" {
+			needles = append(needles, []rune(strings.ToLower(word)))
+		}
+	}
+
+	matchAt := func(i int) int {
+		for _, needle := range needles {
+			if i+len(needle) > len(lower) {
+				continue
+			}
+			if string(lower[i:i+len(needle)]) == string(needle) {
+				return len(needle)
+			}
+		}
+		return 0
+	}
+
+	first := -1
+	for i := range lower {
+		if matchAt(i) > 0 {
+			first = i
+			break
+		}
+	}
+
+	start := 0
+	if first > width/2 {
+		start = first - width/2
+	}
+	end := start + width
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		if n := matchAt(i); n > 0 && i+n <= end {
+			b.WriteString(markOpen)
+			b.WriteString(string(runes[i : i+n]))
+			b.WriteString(markClose)
+			i += n
+			continue
+		}
+		b.WriteRune(runes[i])
+		i++
+	}
+	if end < len(runes) {
+		b.WriteString("…")
+	}
+
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package search
+
+import (
+	"github.com/nebisin/gopress/models"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// sqliteEngine uses an FTS5 virtual table which keeps
+// a copy of the title and the body of every post.
+// SQLite must be built with FTS5, which needs
+// the sqlite_fts5 build tag for go-sqlite3.
+type sqliteEngine struct{}
+
+func (e *sqliteEngine) Name() string {
+	return pluginName
+}
+
+// Initialize creates the virtual table and fills it when it is created
+// for the first time. Unlike the indexes of the other databases it is
+// not created by the migrations, since a binary built without FTS5
+// could not apply them, and it only holds copies of the posts.
+func (e *sqliteEngine) Initialize(db *gorm.DB) error {
+	var count int64
+	if err := db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'posts_fts'").
+		Scan(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	if err := db.Exec("CREATE VIRTUAL TABLE posts_fts USING fts5(title, body, tokenize = 'porter unicode61')").
+		Error; err != nil {
+		return err
+	}
+
+	return e.Rebuild(db)
+}
+
+func (e *sqliteEngine) Index(db *gorm.DB, post models.Post) error {
+	if err := e.Remove(db, post.ID); err != nil {
+		return err
+	}
+
+	return db.Exec("INSERT INTO posts_fts (rowid, title, body) VALUES (?, ?, ?)", post.ID, post.Title, post.Body).
+		Error
+}
+
+func (e *sqliteEngine) Remove(db *gorm.DB, id uint) error {
+	return db.Exec("DELETE FROM posts_fts WHERE rowid = ?", id).Error
+}
+
+// Search ranks the posts with bm25 giving title matches
+// ten times the weight of body matches.
+func (e *sqliteEngine) Search(db *gorm.DB, query Query) ([]Hit, error) {
+	match := matchExpression(query.Terms)
+	if match == "" {
+		return []Hit{}, nil
+	}
+
+	tx := db.Table("posts_fts").
+		Select("posts.id AS post_id, -bm25(posts_fts, 10.0, 1.0) AS search_rank, "+
+			"snippet(posts_fts, -1, ?, ?, '…', 24) AS snippet", markOpen, markClose).
+		Joins("JOIN posts ON posts.id = posts_fts.rowid").
+		Where("posts_fts MATCH ?", match)
+
+	var hits []Hit
+	if err := paginate(applyFilters(tx, query), query).
+		Order("search_rank DESC").
+		Scan(&hits).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range hits {
+		hits[i].Snippet = highlight(hits[i].Snippet)
+	}
+
+	return hits, nil
+}
+
+func (e *sqliteEngine) Rebuild(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM posts_fts").Error; err != nil {
+			return err
+		}
+
+		return tx.Exec("INSERT INTO posts_fts (rowid, title, body) " +
+			"SELECT id, title, body FROM posts WHERE deleted_at IS NULL").Error
+	})
+}
+
+// matchExpression turns the search text into an FTS5 query.
+// Every term is quoted so user input can not use the query syntax,
+// and the terms are combined with AND.
+func matchExpression(text string) string {
+	var parts []string
+	for _, term := range terms(text) {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.Trim(term, "*")
+		part := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,247 @@
+// Package sitemaps generates the sitemap index and the sitemaps of
+// posts, authors and tags. Sitemaps are generated when they are first
+// asked for and kept until a change of the posts invalidates them.
+package sitemaps
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/nebisin/gopress/models"
+	"github.com/nebisin/gopress/repository"
+	"gorm.io/gorm"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxURLs is the most urls a sitemap can have. Sections are split
+// into sitemaps by ranges of ids of this size so a change only
+// invalidates the sitemap holding the changed row.
+const MaxURLs = 50000
+
+const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+var sections = []string{repository.SitemapPosts, repository.SitemapAuthors, repository.SitemapTags}
+
+var ErrNotFound = errors.New("sitemap could not found")
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	URLs    []entry  `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Sitemaps []entry  `xml:"sitemap"`
+}
+
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type Generator struct {
+	mu sync.Mutex
+	db *gorm.DB
+	// base is the url every location starts with.
+	base string
+	// docs are the generated documents by name.
+	// The index is named "index" and the sitemaps "posts-1" etc.
+	docs map[string][]byte
+}
+
+// New returns a generator of sitemaps with the urls of the site
+// at given base url, like https://blog.example.com.
+func New(db *gorm.DB, base string) *Generator {
+	return &Generator{db: db, base: strings.TrimRight(base, "/"), docs: make(map[string][]byte)}
+}
+
+// Index returns the sitemap index linking every sitemap.
+func (g *Generator) Index(gzipped bool) ([]byte, error) {
+	return g.document("index", gzipped)
+}
+
+// Sitemap returns the sitemap with given name, e.g. "posts-1".
+func (g *Generator) Sitemap(name string, gzipped bool) ([]byte, error) {
+	return g.document(name, gzipped)
+}
+
+// PostChanged invalidates the sitemaps which may change
+// when the post is published, changed or deleted.
+// Tags of the post may have changed as well so every
+// sitemap of the tags is invalidated.
+func (g *Generator) PostChanged(post models.Post) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.invalidate("index")
+	g.invalidate(name(repository.SitemapPosts, chunk(post.ID)))
+	if post.AuthorID != nil {
+		g.invalidate(name(repository.SitemapAuthors, chunk(*post.AuthorID)))
+	}
+	for key := range g.docs {
+		if strings.HasPrefix(key, repository.SitemapTags+"-") {
+			delete(g.docs, key)
+		}
+	}
+}
+
+func (g *Generator) invalidate(key string) {
+	delete(g.docs, key)
+	delete(g.docs, key+".gz")
+}
+
+func (g *Generator) document(key string, gzipped bool) ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cacheKey := key
+	if gzipped {
+		cacheKey += ".gz"
+	}
+	if doc, ok := g.docs[cacheKey]; ok {
+		return doc, nil
+	}
+
+	doc, ok := g.docs[key]
+	if !ok {
+		var err error
+		if key == "index" {
+			doc, err = g.generateIndex()
+		} else {
+			doc, err = g.generateSitemap(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		g.docs[key] = doc
+	}
+
+	if !gzipped {
+		return doc, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(doc); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	g.docs[cacheKey] = buf.Bytes()
+
+	return buf.Bytes(), nil
+}
+
+func (g *Generator) generateIndex() ([]byte, error) {
+	db := repository.NewSitemapRepository(g.db)
+
+	index := sitemapIndex{Xmlns: xmlns, Sitemaps: []entry{}}
+	for _, section := range sections {
+		maxId, err := db.MaxId(section)
+		if err != nil {
+			return nil, err
+		}
+		if maxId == 0 {
+			continue
+		}
+
+		for i := 1; i <= chunk(maxId); i++ {
+			from, to := bounds(i)
+			modified, ok, err := db.LastModified(section, from, to)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+
+			index.Sitemaps = append(index.Sitemaps, entry{
+				Loc:     fmt.Sprintf("%s/sitemaps/%s.xml", g.base, name(section, i)),
+				LastMod: modified.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	return encode(index)
+}
+
+func (g *Generator) generateSitemap(key string) ([]byte, error) {
+	i := strings.LastIndex(key, "-")
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+	section := key[:i]
+	n, err := strconv.Atoi(key[i+1:])
+	if err != nil || n < 1 {
+		return nil, ErrNotFound
+	}
+
+	db := repository.NewSitemapRepository(g.db)
+
+	from, to := bounds(n)
+	entries, err := db.FindEntries(section, from, to)
+	if err != nil {
+		if errors.Is(err, repository.ErrUnknownSection) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+
+	set := urlSet{Xmlns: xmlns}
+	for _, e := range entries {
+		set.URLs = append(set.URLs, entry{
+			Loc:     g.location(section, e),
+			LastMod: e.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+
+	return encode(set)
+}
+
+// location is the url of a row in a sitemap.
+func (g *Generator) location(section string, e repository.SitemapEntry) string {
+	switch section {
+	case repository.SitemapPosts:
+		return fmt.Sprintf("%s/posts/%d", g.base, e.ID)
+	case repository.SitemapAuthors:
+		return fmt.Sprintf("%s/users/%d", g.base, e.ID)
+	}
+
+	return fmt.Sprintf("%s/posts?tag=%s", g.base, url.QueryEscape(e.Name))
+}
+
+func encode(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// chunk returns the number of the sitemap holding given id.
+func chunk(id uint) int {
+	return int((id-1)/MaxURLs) + 1
+}
+
+// bounds returns the range of ids in the sitemap with given number.
+func bounds(n int) (uint, uint) {
+	return uint(n-1)*MaxURLs + 1, uint(n) * MaxURLs
+}
+
+func name(section string, n int) string {
+	return section + "-" + strconv.Itoa(n)
+}
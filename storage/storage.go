@@ -0,0 +1,23 @@
+// Package storage keeps uploaded files. The local file system
+// and S3 compatible object stores are supported.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("file could not found")
+
+// Storage is a store of files by key. Keys are slash separated
+// paths like "1/photo.jpg" and are made by the application.
+type Storage interface {
+	// Put stores size bytes read from r under the key.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the file with the key. Callers must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file with the key.
+	// Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
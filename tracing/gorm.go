@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// dbSystems are the names of the databases in the semantic conventions.
+var dbSystems = map[string]string{
+	"sqlite":   "sqlite",
+	"postgres": "postgresql",
+	"mysql":    "mysql",
+}
+
+// GormPlugin starts a span for every SQL statement as a child
+// of the span in the context of the query, so queries must be
+// run with db.WithContext to be part of a trace.
+// It is added with db.Use(tracing.GormPlugin{}).
+type GormPlugin struct{}
+
+// Name is the name of the plugin for GORM.
+func (GormPlugin) Name() string {
+	return "gopress:tracing"
+}
+
+// Initialize registers the callbacks of the plugin.
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+
+	errs := []error{
+		callback.Create().Before("*").Register("tracing:before_create", start("create")),
+		callback.Create().After("*").Register("tracing:after_create", end),
+		callback.Query().Before("*").Register("tracing:before_query", start("query")),
+		callback.Query().After("*").Register("tracing:after_query", end),
+		callback.Update().Before("*").Register("tracing:before_update", start("update")),
+		callback.Update().After("*").Register("tracing:after_update", end),
+		callback.Delete().Before("*").Register("tracing:before_delete", start("delete")),
+		callback.Delete().After("*").Register("tracing:after_delete", end),
+		callback.Row().Before("*").Register("tracing:before_row", start("row")),
+		callback.Row().After("*").Register("tracing:after_row", end),
+		callback.Raw().Before("*").Register("tracing:before_raw", start("raw")),
+		callback.Raw().After("*").Register("tracing:after_raw", end),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func start(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			// Queries outside of a trace, like the ones of
+			// background jobs, would only make noise.
+			return
+		}
+
+		_, span := Tracer().Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient))
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+// end describes the statement once it is run and ends the span.
+func end(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	attributes := []attribute.KeyValue{
+		semconv.DBSystemKey.String(dbSystems[db.Dialector.Name()]),
+		semconv.DBStatementKey.String(db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	}
+	if table := db.Statement.Table; table != "" {
+		attributes = append(attributes, semconv.DBSQLTableKey.String(table))
+	}
+	span.SetAttributes(attributes...)
+
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
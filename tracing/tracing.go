@@ -0,0 +1,89 @@
+// Package tracing sends OpenTelemetry traces of gopress to a collector.
+// Requests, repository calls and SQL statements get their own spans
+// and the trace of a caller is continued with the W3C traceparent header.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"github.com/nebisin/gopress/buildinfo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+)
+
+// The exporters spans can be sent with.
+const (
+	None   = "none"
+	OTLP   = "otlp"
+	Stdout = "stdout"
+)
+
+const instrumentation = "github.com/nebisin/gopress"
+
+// Config tells where to send the spans.
+type Config struct {
+	// Exporter is none, otlp or stdout.
+	Exporter string
+	// Endpoint is the host and port of an OTLP/HTTP collector.
+	Endpoint string
+	// Insecure sends the spans over HTTP instead of HTTPS.
+	Insecure bool
+	// SampleRatio is the share of new traces which are recorded.
+	// Traces started by a caller follow the decision of the caller.
+	SampleRatio float64
+}
+
+// Setup installs the tracer provider of the config and the W3C
+// propagators. The returned function sends the spans which are
+// not exported yet and must be called before the program exits.
+func Setup(config Config) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch config.Exporter {
+	case None, "":
+		return func(context.Context) error { return nil }, nil
+	case OTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.Endpoint)}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	case Stdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String("gopress"),
+			semconv.ServiceVersionKey.String(buildinfo.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of gopress. Until Setup is called
+// its spans are not recorded.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
@@ -1,43 +1,56 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func CreateToken(userId uint) (string, error) {
+// ErrRevoked is the error of a token which is signed right but
+// can not be used anymore, like the tokens of locked users.
+var ErrRevoked = errors.New("the token is revoked")
+
+// Tokens creates and checks the tokens of the users.
+type Tokens struct {
+	// Secret signs the tokens.
+	Secret []byte
+	// TTL is how long a token is valid.
+	TTL time.Duration
+	// Check, if it is set, is called with the user and the version of
+	// every token which is signed right. The token is rejected if it
+	// returns an error, so tokens can be revoked before they expire.
+	Check func(ctx context.Context, uid uint, version uint) error
+}
+
+// CreateToken makes a token of the user. The version is given back to
+// Check, changing the version of a user revokes the tokens made before.
+func (t Tokens) CreateToken(userId uint, version uint) (string, error) {
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = userId
-	claims["exp"] = time.Now().Add(time.Hour * 24 * 8).Unix() // 8 days
+	claims["version"] = version
+	claims["exp"] = time.Now().Add(t.TTL).Unix()
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
-	return token.SignedString([]byte(os.Getenv("API_SECRET")))
+	return token.SignedString(t.Secret)
 }
 
-func TokenValid(r *http.Request) error {
-	tokenString := extractToken(r)
-	_, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-
-		_, ok := token.Method.(*jwt.SigningMethodHMAC)
-
-		if !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+func (t Tokens) TokenValid(r *http.Request) error {
+	_, err := t.ExtractTokenID(r)
+	return err
+}
 
-	if err != nil {
-		return err
+func (t Tokens) key(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	}
-
-	return nil
+	return t.Secret, nil
 }
 
 func extractToken(r *http.Request) string {
@@ -48,15 +61,10 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
-func ExtractTokenID(r *http.Request) (uint, error) {
+func (t Tokens) ExtractTokenID(r *http.Request) (uint, error) {
 
 	tokenString := extractToken(r)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("API_SECRET")), nil
-	})
+	token, err := jwt.Parse(tokenString, t.key)
 	if err != nil {
 		return 0, err
 	}
@@ -66,6 +74,14 @@ func ExtractTokenID(r *http.Request) (uint, error) {
 		if err != nil {
 			return 0, err
 		}
+		if t.Check != nil {
+			// Tokens made before the versions have none,
+			// they are the first version of their user.
+			version, _ := claims["version"].(float64)
+			if err := t.Check(r.Context(), uint(uid), uint(version)); err != nil {
+				return 0, err
+			}
+		}
 		return uint(uid), nil
 	}
 	return 0, nil
@@ -0,0 +1,98 @@
+// Package certs keeps a TLS certificate up to date with its files
+// so renewed certificates are used without restarting the server.
+package certs
+
+import (
+	"crypto/tls"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkInterval is how often the files are checked for changes.
+const checkInterval = 30 * time.Second
+
+// Reloader loads a certificate and its key and reads them
+// again when the files change or Reload is called.
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewReloader loads the certificate for the first time.
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the files again. The current certificate
+// is kept if the new one can not be loaded.
+func (r *Reloader) Reload() error {
+	modTime := r.lastModified()
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// GetCertificate is used as the GetCertificate of a tls.Config.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	cert, modTime, checkedAt := r.cert, r.modTime, r.checkedAt
+	r.mu.RUnlock()
+
+	if time.Since(checkedAt) < checkInterval {
+		return cert, nil
+	}
+
+	if r.lastModified().Equal(modTime) {
+		r.mu.Lock()
+		r.checkedAt = time.Now()
+		r.mu.Unlock()
+		return cert, nil
+	}
+
+	if err := r.Reload(); err != nil {
+		log.Printf("Error reloading the TLS certificate, the old one is used: %v", err)
+		r.mu.Lock()
+		r.checkedAt = time.Now()
+		r.mu.Unlock()
+		return cert, nil
+	}
+	log.Println("🔐 TLS certificate is reloaded")
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// lastModified is the newer modification time of the two files.
+func (r *Reloader) lastModified() time.Time {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		if info, err := os.Stat(name); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest
+}
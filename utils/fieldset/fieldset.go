@@ -0,0 +1,179 @@
+// Package fieldset parses the sparse fieldsets and the relations
+// clients ask for with the fields and include query parameters.
+//
+//	?fields=title,author.username&include=tags
+//
+// asks for the title of posts, the username of their authors and
+// their tags. Fields are the JSON names of the resource.
+package fieldset
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var ErrUnknownField = errors.New("unknown field")
+
+// Fieldset is the fields and the relations asked by a client.
+// The zero value asks for everything.
+type Fieldset struct {
+	// Fields are the fields of the resource itself.
+	Fields []string
+	// Nested are the fields of the relations, like
+	// "username" for "author.username".
+	Nested map[string][]string
+	// Include are the relations asked with all their fields.
+	Include []string
+
+	hasFields  bool
+	hasInclude bool
+}
+
+// FromRequest reads the fields and include query parameters.
+func FromRequest(r *http.Request) Fieldset {
+	query := r.URL.Query()
+	_, hasFields := query["fields"]
+	_, hasInclude := query["include"]
+
+	return Parse(query.Get("fields"), query.Get("include"), hasFields, hasInclude)
+}
+
+// Parse parses comma separated lists of fields and relations.
+// An empty list which is given asks for nothing, unlike a missing one.
+func Parse(fields string, include string, hasFields bool, hasInclude bool) Fieldset {
+	f := Fieldset{Nested: make(map[string][]string), hasFields: hasFields, hasInclude: hasInclude}
+
+	for _, field := range split(fields) {
+		if i := strings.Index(field, "."); i > 0 {
+			f.Nested[field[:i]] = append(f.Nested[field[:i]], field[i+1:])
+			continue
+		}
+		f.Fields = append(f.Fields, field)
+	}
+	f.Include = split(include)
+
+	return f
+}
+
+func split(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// IsZero reports if the client did not ask for anything in particular.
+func (f Fieldset) IsZero() bool {
+	return !f.hasFields && !f.hasInclude
+}
+
+// HasFields reports if the fields are limited.
+func (f Fieldset) HasFields() bool {
+	return f.hasFields
+}
+
+// Selects reports if a field of the resource itself is asked.
+func (f Fieldset) Selects(field string) bool {
+	return !f.hasFields || contains(f.Fields, field)
+}
+
+// Includes reports if a relation is asked. All relations are
+// loaded if neither fields nor include are given, otherwise only
+// the ones which are included or have fields asked.
+func (f Fieldset) Includes(relation string) bool {
+	if f.IsZero() {
+		return true
+	}
+
+	_, nested := f.Nested[relation]
+	return nested || contains(f.Include, relation) || contains(f.Fields, relation)
+}
+
+// FieldsOf returns the asked fields of a relation.
+// It returns nil if all of them are asked.
+func (f Fieldset) FieldsOf(relation string) []string {
+	if contains(f.Include, relation) || contains(f.Fields, relation) {
+		return nil
+	}
+
+	return f.Nested[relation]
+}
+
+// Apply removes the fields which are not asked from the JSON form
+// of a resource or a list of them. Relations are the fields which
+// are relations, other fields are removed unless they are selected.
+func (f Fieldset) Apply(v interface{}, relations ...string) (interface{}, error) {
+	if f.IsZero() {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	each(doc, func(object map[string]interface{}) {
+		for key, value := range object {
+			if !contains(relations, key) {
+				if !f.Selects(key) {
+					delete(object, key)
+				}
+				continue
+			}
+
+			if !f.Includes(key) {
+				delete(object, key)
+				continue
+			}
+			if fields := f.FieldsOf(key); fields != nil {
+				each(value, func(related map[string]interface{}) {
+					for k := range related {
+						if !contains(fields, k) {
+							delete(related, k)
+						}
+					}
+				})
+			}
+		}
+	})
+
+	return doc, nil
+}
+
+// each calls fn with the object or with every object in the list.
+func each(doc interface{}, fn func(map[string]interface{})) {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		fn(v)
+	case []interface{}:
+		for _, item := range v {
+			if object, ok := item.(map[string]interface{}); ok {
+				fn(object)
+			}
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,332 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396)
+// and JSON Patch (RFC 6902) documents to JSON documents.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// MergePatch applies the merge patch to the document.
+// Members set to null in the patch are removed from the document,
+// objects are merged recursively and everything else is replaced.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	if len(doc) != 0 {
+		if err := json.Unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+	}
+
+	var p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+
+	return targetObject
+}
+
+// Operation is one operation of a JSON Patch document.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Apply applies the operations of the JSON Patch to the document.
+// Operations are applied in order and if any of them fails,
+// including a failing test, the whole patch fails.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var ops []Operation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+
+	var root interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		var err error
+		if root, err = apply(root, op); err != nil {
+			return nil, fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func apply(root interface{}, op Operation) (interface{}, error) {
+	value := func() (interface{}, error) {
+		if len(op.Value) == 0 {
+			return nil, errors.New(op.Op + " needs a value")
+		}
+		var v interface{}
+		err := json.Unmarshal(op.Value, &v)
+		return v, err
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, v)
+	case "remove":
+		root, _, err := remove(root, op.Path)
+		return root, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		root, _, err = remove(root, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, v)
+	case "move":
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("a value can not be moved into itself")
+		}
+		root, v, err := remove(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, v)
+	case "copy":
+		v, err := get(root, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, op.Path, deepCopy(v))
+	case "test":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		current, err := get(root, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, v) {
+			return nil, errors.New("test failed for " + op.Path)
+		}
+		return root, nil
+	}
+
+	return nil, errors.New("unknown operation " + op.Op)
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("path must start with /: " + pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		token = strings.ReplaceAll(token, "~1", "/")
+		tokens[i] = strings.ReplaceAll(token, "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func get(root interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	current := root
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, errors.New("path does not exist: " + pointer)
+			}
+			current = v
+		case []interface{}:
+			i, err := index(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[i]
+		default:
+			return nil, errors.New("path does not exist: " + pointer)
+		}
+	}
+
+	return current, nil
+}
+
+// add sets the value at the pointer. The parent must exist.
+// Values added into arrays are inserted at the index
+// and "-" appends to the end of the array.
+func add(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := get(root, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return root, nil
+	case []interface{}:
+		i := len(node)
+		if last != "-" {
+			if i, err = index(last, len(node), true); err != nil {
+				return nil, err
+			}
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return set(root, parentPointer, node)
+	}
+
+	return nil, errors.New("path does not exist: " + pointer)
+}
+
+// remove deletes the value at the pointer and returns it.
+func remove(root interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, root, nil
+	}
+
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := get(root, parentPointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		v, ok := node[last]
+		if !ok {
+			return nil, nil, errors.New("path does not exist: " + pointer)
+		}
+		delete(node, last)
+		return root, v, nil
+	case []interface{}:
+		i, err := index(last, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		root, err = set(root, parentPointer, node)
+		return root, v, err
+	}
+
+	return nil, nil, errors.New("path does not exist: " + pointer)
+}
+
+// set replaces the value at an existing pointer.
+// It is needed because arrays are values which change
+// when elements are added or removed.
+func set(root interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(root, pointer[:strings.LastIndex(pointer, "/")])
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return root, nil
+	case []interface{}:
+		i, err := index(last, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = value
+		return root, nil
+	}
+
+	return nil, errors.New("path does not exist: " + pointer)
+}
+
+// index parses an array index. Adding may use the length of the array.
+func index(token string, length int, adding bool) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, errors.New("invalid array index " + token)
+	}
+	if i > length || (i == length && !adding) {
+		return 0, errors.New("array index out of bounds " + token)
+	}
+
+	return i, nil
+}
+
+func deepCopy(v interface{}) interface{} {
+	b, _ := json.Marshal(v)
+	var c interface{}
+	_ = json.Unmarshal(b, &c)
+	return c
+}
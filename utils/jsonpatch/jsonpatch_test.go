@@ -0,0 +1,261 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// equalJSON reports if the documents are the same JSON values.
+func equalJSON(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+// The examples of the appendix A of RFC 7396.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		got, err := MergePatch([]byte(test.doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s, %s): %v", test.doc, test.patch, err)
+			continue
+		}
+		if !equalJSON(t, got, test.want) {
+			t.Errorf("MergePatch(%s, %s) = %s, want %s", test.doc, test.patch, got, test.want)
+		}
+	}
+}
+
+// Members absent from the patch are kept, null removes them
+// and zero values replace them like any other value.
+func TestMergePatchAbsentNullZero(t *testing.T) {
+	doc := `{"title":"Title","body":"Body","isPublished":true,"tags":["go"]}`
+	tests := []struct {
+		patch, want string
+	}{
+		{`{}`, doc},
+		{`{"body":null}`, `{"title":"Title","isPublished":true,"tags":["go"]}`},
+		{`{"body":""}`, `{"title":"Title","body":"","isPublished":true,"tags":["go"]}`},
+		{`{"isPublished":false}`, `{"title":"Title","body":"Body","isPublished":false,"tags":["go"]}`},
+		{`{"tags":[]}`, `{"title":"Title","body":"Body","isPublished":true,"tags":[]}`},
+	}
+
+	for _, test := range tests {
+		got, err := MergePatch([]byte(doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("MergePatch(%s): %v", test.patch, err)
+			continue
+		}
+		if !equalJSON(t, got, test.want) {
+			t.Errorf("MergePatch(%s) = %s, want %s", test.patch, got, test.want)
+		}
+	}
+}
+
+// The examples of the appendix A of RFC 6902.
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{
+			"add an object member",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":"qux"}]`,
+			`{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			"add an array element",
+			`{"foo":["bar","baz"]}`,
+			`[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			`{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			"add to the end of an array",
+			`{"foo":["bar"]}`,
+			`[{"op":"add","path":"/foo/-","value":["abc","def"]}]`,
+			`{"foo":["bar",["abc","def"]]}`,
+		},
+		{
+			"remove an object member",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"remove","path":"/baz"}]`,
+			`{"foo":"bar"}`,
+		},
+		{
+			"remove an array element",
+			`{"foo":["bar","qux","baz"]}`,
+			`[{"op":"remove","path":"/foo/1"}]`,
+			`{"foo":["bar","baz"]}`,
+		},
+		{
+			"replace a value",
+			`{"baz":"qux","foo":"bar"}`,
+			`[{"op":"replace","path":"/baz","value":"boo"}]`,
+			`{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			"move a value",
+			`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			"move an array element",
+			`{"foo":["all","grass","cows","eat"]}`,
+			`[{"op":"move","from":"/foo/1","path":"/foo/3"}]`,
+			`{"foo":["all","cows","eat","grass"]}`,
+		},
+		{
+			"copy a value",
+			`{"foo":{"bar":["a"]}}`,
+			`[{"op":"copy","from":"/foo/bar","path":"/baz"},{"op":"add","path":"/baz/-","value":"b"}]`,
+			`{"foo":{"bar":["a"]},"baz":["a","b"]}`,
+		},
+		{
+			"test a value",
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+			`[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			`{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			"add a nested member",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/child","value":{"grandchild":{}}}]`,
+			`{"foo":"bar","child":{"grandchild":{}}}`,
+		},
+		{
+			"escape ~ and / in paths",
+			`{"/":9,"~1":10}`,
+			`[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`,
+			`{"~1":10}`,
+		},
+		{
+			"add a null value",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz","value":null}]`,
+			`{"foo":"bar","baz":null}`,
+		},
+		{
+			"replace the whole document",
+			`{"foo":"bar"}`,
+			`[{"op":"replace","path":"","value":{"baz":"qux"}}]`,
+			`{"baz":"qux"}`,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Apply([]byte(test.doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !equalJSON(t, got, test.want) {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name, doc, patch string
+	}{
+		{
+			"failed test",
+			`{"baz":"qux"}`,
+			`[{"op":"test","path":"/baz","value":"bar"}]`,
+		},
+		{
+			"failed test of a number against a string",
+			`{"/":9}`,
+			`[{"op":"test","path":"/~1","value":"9"}]`,
+		},
+		{
+			"add to a missing parent",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+		},
+		{
+			"remove a missing member",
+			`{"foo":"bar"}`,
+			`[{"op":"remove","path":"/baz"}]`,
+		},
+		{
+			"add out of the bounds of an array",
+			`{"foo":["bar"]}`,
+			`[{"op":"add","path":"/foo/2","value":"qux"}]`,
+		},
+		{
+			"replace the end of an array",
+			`{"foo":["bar"]}`,
+			`[{"op":"replace","path":"/foo/-","value":"qux"}]`,
+		},
+		{
+			"index with a leading zero",
+			`{"foo":["bar","baz"]}`,
+			`[{"op":"remove","path":"/foo/01"}]`,
+		},
+		{
+			"move into a child",
+			`{"foo":{"bar":{}}}`,
+			`[{"op":"move","from":"/foo","path":"/foo/bar/baz"}]`,
+		},
+		{
+			"add without a value",
+			`{"foo":"bar"}`,
+			`[{"op":"add","path":"/baz"}]`,
+		},
+		{
+			"unknown operation",
+			`{"foo":"bar"}`,
+			`[{"op":"spam","path":"/foo","value":1}]`,
+		},
+	}
+
+	for _, test := range tests {
+		if got, err := Apply([]byte(test.doc), []byte(test.patch)); err == nil {
+			t.Errorf("%s: got %s, want an error", test.name, got)
+		}
+	}
+}
+
+// A failed operation fails the whole patch, leaving
+// the document as it is for the caller.
+func TestApplyIsAtomic(t *testing.T) {
+	doc := []byte(`{"title":"Title","version":1}`)
+	patch := []byte(`[{"op":"replace","path":"/title","value":"New"},{"op":"test","path":"/version","value":2}]`)
+
+	if _, err := Apply(doc, patch); err == nil {
+		t.Fatal("patch with a failed test applied")
+	}
+	if !equalJSON(t, doc, `{"title":"Title","version":1}`) {
+		t.Errorf("document changed to %s", doc)
+	}
+}
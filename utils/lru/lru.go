@@ -0,0 +1,75 @@
+// Package lru keeps values by key up to a size, dropping the least
+// recently used ones when it is full. It is not safe for concurrent
+// use, the caches built on it hold their own locks.
+package lru
+
+import "container/list"
+
+// LRU is a least recently used list of values.
+type LRU struct {
+	size    int
+	entries map[string]*list.Element
+	// order has the most recently used entries at the front.
+	order *list.List
+	// onRemove is called with every value which leaves the list.
+	onRemove func(key string, value interface{})
+}
+
+type entry struct {
+	key   string
+	value interface{}
+}
+
+// New returns a list holding up to size values. onRemove, if it is not
+// nil, is called with every value which is removed, replaced or dropped
+// for a newer one.
+func New(size int, onRemove func(key string, value interface{})) *LRU {
+	return &LRU{
+		size:     size,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		onRemove: onRemove,
+	}
+}
+
+// Get returns the value of key and marks it as the most recently used.
+func (l *LRU) Get(key string) (interface{}, bool) {
+	element, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	l.order.MoveToFront(element)
+
+	return element.Value.(*entry).value, true
+}
+
+// Add stores the value of key replacing the one it had. The least
+// recently used values are dropped when the list is full.
+func (l *LRU) Add(key string, value interface{}) {
+	l.Remove(key)
+	l.entries[key] = l.order.PushFront(&entry{key: key, value: value})
+
+	for l.order.Len() > l.size {
+		l.remove(l.order.Back())
+	}
+}
+
+// Remove drops the value of key if there is one.
+func (l *LRU) Remove(key string) {
+	if element, ok := l.entries[key]; ok {
+		l.remove(element)
+	}
+}
+
+// Len is the number of values in the list.
+func (l *LRU) Len() int {
+	return l.order.Len()
+}
+
+func (l *LRU) remove(element *list.Element) {
+	e := l.order.Remove(element).(*entry)
+	delete(l.entries, e.key)
+	if l.onRemove != nil {
+		l.onRemove(e.key, e.value)
+	}
+}
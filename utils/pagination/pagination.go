@@ -0,0 +1,163 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPerPage = 10
+	MaxPerPage     = 100
+)
+
+var ErrInvalidCursor = errors.New("cursor is not valid")
+
+// Params are the pagination parameters of a list request.
+// If a cursor is given it is used instead of the page number.
+type Params struct {
+	Page    int
+	PerPage int
+	Cursor  *Cursor
+}
+
+// Offset returns how many rows the page skips
+// when offset pagination is used.
+func (p Params) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// Cursor is a position between two rows of a list.
+// Clients get it as an opaque string and send it back as it is.
+type Cursor struct {
+	// Values are the sort key values of the row next to the position.
+	Values []string `json:"v"`
+	// Before is true for the cursors which go back to the previous page.
+	Before bool `json:"b,omitempty"`
+}
+
+// Encode turns the cursor into the opaque string given to the clients.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor string coming from a client.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil || len(c.Values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	return &c, nil
+}
+
+// Meta describes the returned page of a list.
+type Meta struct {
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"perPage"`
+	Total      *int64 `json:"total,omitempty"`
+	TotalPages *int64 `json:"totalPages,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// SetTotal sets the total count and the number of pages.
+func (m *Meta) SetTotal(total int64) {
+	pages := (total + int64(m.PerPage) - 1) / int64(m.PerPage)
+	if pages == 0 {
+		pages = 1
+	}
+	m.Total = &total
+	m.TotalPages = &pages
+}
+
+// FromRequest reads page, per_page and cursor from the query string.
+// The older limit parameter is still understood as per_page.
+func FromRequest(r *http.Request) (Params, error) {
+	keys := r.URL.Query()
+	params := Params{Page: 1, PerPage: DefaultPerPage}
+
+	perPage := keys.Get("per_page")
+	if len(perPage) == 0 {
+		perPage = keys.Get("limit")
+	}
+	if len(perPage) != 0 {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 {
+			return Params{}, errors.New("per_page must be a positive number")
+		}
+		if n > MaxPerPage {
+			n = MaxPerPage
+		}
+		params.PerPage = n
+	}
+
+	if page := keys.Get("page"); len(page) != 0 {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return Params{}, errors.New("page must be a positive number")
+		}
+		params.Page = n
+	}
+
+	if cursor := keys.Get("cursor"); len(cursor) != 0 {
+		c, err := DecodeCursor(cursor)
+		if err != nil {
+			return Params{}, err
+		}
+		params.Cursor = c
+		params.Page = 0
+	}
+
+	return params, nil
+}
+
+// Envelope is the body of every paginated response.
+type Envelope struct {
+	Data       interface{} `json:"data"`
+	Pagination Meta        `json:"pagination"`
+}
+
+// SetLinkHeader sets the RFC 8288 Link header with the next, prev,
+// first and last pages of the list. The links are made on base, the
+// public url of the site, and not on the Host of the request.
+func SetLinkHeader(w http.ResponseWriter, r *http.Request, base string, meta Meta) {
+	var links []string
+
+	link := func(rel string, set map[string]string) {
+		u := *r.URL
+		q := u.Query()
+		q.Del("page")
+		q.Del("cursor")
+		q.Del("limit")
+		q.Set("per_page", strconv.Itoa(meta.PerPage))
+		for k, v := range set {
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf(`<%s%s>; rel="%s"`, base, u.RequestURI(), rel))
+	}
+
+	if meta.NextCursor != "" {
+		link("next", map[string]string{"cursor": meta.NextCursor})
+	}
+	if meta.PrevCursor != "" {
+		link("prev", map[string]string{"cursor": meta.PrevCursor})
+	}
+	link("first", map[string]string{"page": "1"})
+	if meta.TotalPages != nil {
+		link("last", map[string]string{"page": strconv.FormatInt(*meta.TotalPages, 10)})
+	}
+
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
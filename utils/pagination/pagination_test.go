@@ -0,0 +1,133 @@
+package pagination
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []Cursor{
+		{Values: []string{"1"}},
+		{Values: []string{"2021-05-01T10:00:00.5Z", "42"}, Before: true},
+		{Values: []string{"", "a \"quoted\" value"}},
+	}
+
+	for _, cursor := range tests {
+		got, err := DecodeCursor(cursor.Encode())
+		if err != nil {
+			t.Errorf("DecodeCursor(%+v): %v", cursor, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, cursor) {
+			t.Errorf("DecodeCursor = %+v, want %+v", *got, cursor)
+		}
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"not base64!",
+		// Padded base64 is not what Encode gives.
+		"eyJ2IjpbIjEiXX0=",
+		Cursor{}.Encode(),
+		"bm90IGpzb24",
+		"eyJ2IjoxfQ",
+	}
+
+	for _, input := range tests {
+		if _, err := DecodeCursor(input); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q): error %v, want %v", input, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	cursor := Cursor{Values: []string{"7"}, Before: true}
+
+	tests := []struct {
+		query string
+		want  Params
+	}{
+		{"", Params{Page: 1, PerPage: DefaultPerPage}},
+		{"page=3&per_page=20", Params{Page: 3, PerPage: 20}},
+		{"limit=5", Params{Page: 1, PerPage: 5}},
+		{"limit=5&per_page=6", Params{Page: 1, PerPage: 6}},
+		{"per_page=1000", Params{Page: 1, PerPage: MaxPerPage}},
+		{"page=4&cursor=" + cursor.Encode(), Params{PerPage: DefaultPerPage, Cursor: &cursor}},
+	}
+
+	for _, test := range tests {
+		got, err := FromRequest(httptest.NewRequest("GET", "/posts?"+test.query, nil))
+		if err != nil {
+			t.Errorf("FromRequest(%q): %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FromRequest(%q) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestFromRequestErrors(t *testing.T) {
+	tests := []string{
+		"page=0",
+		"page=-1",
+		"page=two",
+		"per_page=0",
+		"limit=-5",
+		"per_page=ten",
+		"cursor=nope",
+	}
+
+	for _, query := range tests {
+		if _, err := FromRequest(httptest.NewRequest("GET", "/posts?"+query, nil)); err == nil {
+			t.Errorf("FromRequest(%q) has no error", query)
+		}
+	}
+}
+
+func TestSetLinkHeader(t *testing.T) {
+	next := Cursor{Values: []string{"3"}}.Encode()
+	prev := Cursor{Values: []string{"4"}, Before: true}.Encode()
+
+	tests := []struct {
+		query string
+		meta  func() Meta
+		want  string
+	}{
+		{
+			"page=2&per_page=2&tag=go",
+			func() Meta {
+				meta := Meta{Page: 2, PerPage: 2}
+				meta.SetTotal(5)
+				return meta
+			},
+			`<https://blog.example/posts?page=1&per_page=2&tag=go>; rel="first", ` +
+				`<https://blog.example/posts?page=3&per_page=2&tag=go>; rel="last"`,
+		},
+		{
+			"cursor=" + prev + "&limit=2",
+			func() Meta {
+				return Meta{PerPage: 2, NextCursor: next, PrevCursor: prev}
+			},
+			`<https://blog.example/posts?cursor=` + next + `&per_page=2>; rel="next", ` +
+				`<https://blog.example/posts?cursor=` + prev + `&per_page=2>; rel="prev", ` +
+				`<https://blog.example/posts?page=1&per_page=2>; rel="first"`,
+		},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/posts?"+test.query, nil)
+		// The links do not follow the host the client sent.
+		r.Host = "evil.example"
+		r.Header.Set("X-Forwarded-Proto", "http")
+		w := httptest.NewRecorder()
+
+		SetLinkHeader(w, r, "https://blog.example", test.meta())
+		if got := w.Header().Get("Link"); got != test.want {
+			t.Errorf("Link of %q = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
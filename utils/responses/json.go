@@ -3,10 +3,12 @@ package responses
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/nebisin/gopress/utils/pagination"
 	"net/http"
 )
 
 func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
 	err := json.NewEncoder(w).Encode(data)
@@ -27,3 +29,14 @@ func ERROR(w http.ResponseWriter, statusCode int, err error) {
 
 	JSON(w, http.StatusBadRequest, nil)
 }
+
+// PAGE writes one page of a list within the pagination envelope
+// and links the neighbouring pages on base with the Link header.
+func PAGE(w http.ResponseWriter, r *http.Request, base string, data interface{}, meta pagination.Meta) {
+	pagination.SetLinkHeader(w, r, base, meta)
+
+	JSON(w, http.StatusOK, pagination.Envelope{
+		Data:       data,
+		Pagination: meta,
+	})
+}